@@ -1,6 +1,204 @@
 package chatmessage
 
+import (
+	"encoding/binary"
+	"encoding/json"
+	"pogchat/user_message"
+)
+
+const (
+	CHALLENGE_MSG = "CHALLENGE_MSG"
+	LOGIN_MSG     = "LOGIN_MSG"
+	PEER_MSG      = "PEER_MSG"
+	STATUS_MSG    = "STATUS_MSG"
+	ROOM_OP_MSG   = "ROOM_OP_MSG"
+	ROOM_MSG      = "ROOM_MSG"
+	ROOM_INFO_MSG = "ROOM_INFO_MSG"
+
+	PRESENCE_SUB_MSG = "PRESENCE_SUB_MSG"
+	PRESENCE_SET_MSG = "PRESENCE_SET_MSG"
+	PRESENCE_MSG     = "PRESENCE_MSG"
+
+	DEVICE_LIST_MSG   = "DEVICE_LIST_MSG"
+	DEVICE_REVOKE_MSG = "DEVICE_REVOKE_MSG"
+
+	PING_MSG = "PING_MSG"
+	PONG_MSG = "PONG_MSG"
+)
+
+type StatusCode string
+
+const (
+	UNKNOWN_TYPE      StatusCode = "UNKNOWN_TYPE"
+	MALFORMED_PAYLOAD StatusCode = "MALFORMED_PAYLOAD"
+	NOT_LOGGED_IN     StatusCode = "NOT_LOGGED_IN"
+	LOGGED_IN         StatusCode = "LOGGED_IN"
+	LOGIN_FAILED      StatusCode = "LOGIN_FAILED"
+	RECIPIENT_OFFLINE StatusCode = "RECIPIENT_OFFLINE"
+	BAD_SIGNATURE     StatusCode = "BAD_SIGNATURE"
+	STALE_MESSAGE     StatusCode = "STALE_MESSAGE"
+	REPLAYED_MESSAGE  StatusCode = "REPLAYED_MESSAGE"
+	RATE_LIMITED      StatusCode = "RATE_LIMITED"
+	MAILBOX_FULL      StatusCode = "MAILBOX_FULL"
+	QUEUED            StatusCode = "QUEUED"
+	ROOM_REJECTED     StatusCode = "ROOM_REJECTED"
+	DEVICE_REVOKED    StatusCode = "DEVICE_REVOKED"
+	SESSION_REFUSED   StatusCode = "SESSION_REFUSED"
+)
+
+const (
+	loginDomain       = "POGCHAT_LOGIN_V1"
+	deviceLoginDomain = "POGCHAT_DEVICE_LOGIN_V1"
+)
+
+// ChatMessage is the envelope of every frame, a peer message read from a
+// binary frame keeps its decoded form in User so the relay routes it without
+// JSON, Payload is then only filled in when a JSON peer or the mailbox
+// needs it
 type ChatMessage struct {
-	Type    string `json:"type"`
-	Payload string `json:"payload"`
+	Type    string                   `json:"type"`
+	Payload string                   `json:"payload"`
+	User    user_message.UserMessage `json:"-"`
+}
+
+// PeerPayload is the JSON form of the peer message, it is only marshalled
+// when the envelope came without one
+func (m *ChatMessage) PeerPayload() (string, error) {
+	if m.Payload != "" || m.User == nil {
+		return m.Payload, nil
+	}
+
+	b, err := m.User.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Envelope is the JSON frame of the message, a decoded peer message gets
+// its payload filled in first, json.Marshal alone would leave it empty
+func (m *ChatMessage) Envelope() ([]byte, error) {
+	if m.Payload != "" || m.User == nil {
+		return json.Marshal(m)
+	}
+
+	payload, err := m.PeerPayload()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&ChatMessage{Type: m.Type, Payload: payload})
+}
+
+type Status struct {
+	Code   StatusCode `json:"code"`
+	Reason string     `json:"reason"`
+}
+
+// IsError reports whether the status describes a failure rather than an
+// acknowledgement
+func (s *Status) IsError() bool {
+	return s.Code != LOGGED_IN && s.Code != QUEUED
+}
+
+// Challenge is sent by the server as soon as a connection is accepted, the
+// client must answer it with a Login signed over the same nonce, Codecs
+// lists the binary frame encodings the server understands
+type Challenge struct {
+	Nonce     []byte   `json:"nonce"`
+	ServerID  string   `json:"server_id"`
+	Timestamp int64    `json:"timestamp"`
+	Codecs    []string `json:"codecs,omitempty"`
+}
+
+// Login answers a Challenge, DeviceID tells apart several connections of
+// the same key and is signed so a relay can not move a login to another
+// device, DeviceKey is the ed25519 key of the device, the identity
+// signature vouches for it and DeviceSignature shows the device holds it
+type Login struct {
+	PublicKey       []byte `json:"public_key"`
+	Nonce           []byte `json:"nonce"`
+	ServerID        string `json:"server_id"`
+	Timestamp       int64  `json:"timestamp"`
+	DeviceID        string `json:"device_id,omitempty"`
+	DeviceKey       []byte `json:"device_key,omitempty"`
+	Signature       []byte `json:"signature"`
+	DeviceSignature []byte `json:"device_signature,omitempty"`
+}
+
+// SigningBytes returns the canonical byte sequence covered by the login
+// signature, every variable length field is length prefixed so that no two
+// distinct logins share the same encoding
+func (l *Login) SigningBytes() []byte {
+	buf := make([]byte, 0, len(loginDomain)+len(l.PublicKey)+len(l.Nonce)+len(l.ServerID)+20)
+	buf = append(buf, loginDomain...)
+	buf = appendField(buf, l.PublicKey)
+	buf = appendField(buf, l.Nonce)
+	buf = appendField(buf, []byte(l.ServerID))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(l.Timestamp))
+	// logins from before devices leave the field out and keep their
+	// encoding
+	if l.DeviceID != "" {
+		buf = appendField(buf, []byte(l.DeviceID))
+	}
+	if len(l.DeviceKey) > 0 {
+		buf = appendField(buf, l.DeviceKey)
+	}
+	return buf
+}
+
+// DeviceSigningBytes is what the device key signs, it has a domain of its
+// own so the signature can never stand in for the identity one
+func (l *Login) DeviceSigningBytes() []byte {
+	return append([]byte(deviceLoginDomain), l.SigningBytes()...)
+}
+
+func appendField(buf []byte, field []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(field)))
+	return append(buf, field...)
+}
+
+func NewChatMessage(msgType string, payload interface{}) (*ChatMessage, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatMessage{
+		Type:    msgType,
+		Payload: string(b),
+	}, nil
+}
+
+func NewStatusMessage(code StatusCode, reason string) (*ChatMessage, error) {
+	return NewChatMessage(STATUS_MSG, &Status{
+		Code:   code,
+		Reason: reason,
+	})
+}
+
+func ParseStatus(msg *ChatMessage) (*Status, error) {
+	status := &Status{}
+	err := json.Unmarshal([]byte(msg.Payload), status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func ParseChallenge(msg *ChatMessage) (*Challenge, error) {
+	challenge := &Challenge{}
+	err := json.Unmarshal([]byte(msg.Payload), challenge)
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+func ParseLogin(msg *ChatMessage) (*Login, error) {
+	login := &Login{}
+	err := json.Unmarshal([]byte(msg.Payload), login)
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
 }
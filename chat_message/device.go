@@ -0,0 +1,43 @@
+package chatmessage
+
+import "encoding/json"
+
+type Device struct {
+	ID        string `json:"id"`
+	FirstSeen int64  `json:"first_seen"`
+	LastSeen  int64  `json:"last_seen"`
+	Online    bool   `json:"online"`
+	Current   bool   `json:"current"`
+	Revoked   bool   `json:"revoked"`
+}
+
+// DeviceList answers an empty DEVICE_LIST_MSG with every device that ever
+// logged in with the sender key
+type DeviceList struct {
+	Devices []*Device `json:"devices"`
+}
+
+// DeviceRevoke disconnects a device of the sender key and refuses its id
+// while the server runs, ids are picked by the clients so this is a kick
+// and not a lock out, anyone holding the key can log in under a new id
+type DeviceRevoke struct {
+	ID string `json:"id"`
+}
+
+func ParseDeviceList(msg *ChatMessage) (*DeviceList, error) {
+	list := &DeviceList{}
+	err := json.Unmarshal([]byte(msg.Payload), list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func ParseDeviceRevoke(msg *ChatMessage) (*DeviceRevoke, error) {
+	revoke := &DeviceRevoke{}
+	err := json.Unmarshal([]byte(msg.Payload), revoke)
+	if err != nil {
+		return nil, err
+	}
+	return revoke, nil
+}
@@ -0,0 +1,28 @@
+package chatmessage
+
+import "encoding/json"
+
+// Heartbeat is the payload of PING_MSG and PONG_MSG, a pong echoes the
+// sequence number of the ping it answers
+type Heartbeat struct {
+	Seq       uint64 `json:"seq"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func NewPing(seq uint64, timestamp int64) (*ChatMessage, error) {
+	return NewChatMessage(PING_MSG, &Heartbeat{Seq: seq, Timestamp: timestamp})
+}
+
+// NewPong answers a ping with the same sequence number
+func NewPong(ping *Heartbeat, timestamp int64) (*ChatMessage, error) {
+	return NewChatMessage(PONG_MSG, &Heartbeat{Seq: ping.Seq, Timestamp: timestamp})
+}
+
+func ParseHeartbeat(msg *ChatMessage) (*Heartbeat, error) {
+	heartbeat := &Heartbeat{}
+	err := json.Unmarshal([]byte(msg.Payload), heartbeat)
+	if err != nil {
+		return nil, err
+	}
+	return heartbeat, nil
+}
@@ -0,0 +1,69 @@
+package chatmessage
+
+import "encoding/json"
+
+type PresenceStatus string
+
+const (
+	ONLINE  PresenceStatus = "ONLINE"
+	AWAY    PresenceStatus = "AWAY"
+	OFFLINE PresenceStatus = "OFFLINE"
+	// UNKNOWN is what a subscriber sees when the key hides its presence
+	// from it, it is also used for keys that never logged in
+	UNKNOWN PresenceStatus = "UNKNOWN"
+)
+
+type Visibility string
+
+const (
+	VISIBLE_TO_EVERYONE Visibility = "EVERYONE"
+	VISIBLE_TO_ALLOWED  Visibility = "ALLOWED"
+	VISIBLE_TO_NOBODY   Visibility = "NOBODY"
+)
+
+// PresenceSubscribe replaces the list of keys a client wants presence
+// events for
+type PresenceSubscribe struct {
+	Keys [][]byte `json:"keys"`
+}
+
+// PresenceSet changes the status of the sender and who may see it, Allowed
+// is only used with VISIBLE_TO_ALLOWED
+type PresenceSet struct {
+	Status     PresenceStatus `json:"status"`
+	Visibility Visibility     `json:"visibility"`
+	Allowed    [][]byte       `json:"allowed,omitempty"`
+}
+
+type Presence struct {
+	Key      []byte         `json:"key"`
+	Status   PresenceStatus `json:"status"`
+	LastSeen int64          `json:"last_seen,omitempty"`
+}
+
+func ParsePresenceSubscribe(msg *ChatMessage) (*PresenceSubscribe, error) {
+	sub := &PresenceSubscribe{}
+	err := json.Unmarshal([]byte(msg.Payload), sub)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func ParsePresenceSet(msg *ChatMessage) (*PresenceSet, error) {
+	set := &PresenceSet{}
+	err := json.Unmarshal([]byte(msg.Payload), set)
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func ParsePresence(msg *ChatMessage) (*Presence, error) {
+	presence := &Presence{}
+	err := json.Unmarshal([]byte(msg.Payload), presence)
+	if err != nil {
+		return nil, err
+	}
+	return presence, nil
+}
@@ -0,0 +1,87 @@
+package chatmessage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+)
+
+type RoomOpType string
+
+const (
+	CREATE_ROOM   RoomOpType = "CREATE_ROOM"
+	INVITE_MEMBER RoomOpType = "INVITE_MEMBER"
+	REMOVE_MEMBER RoomOpType = "REMOVE_MEMBER"
+	LEAVE_ROOM    RoomOpType = "LEAVE_ROOM"
+)
+
+const roomOpDomain = "POGCHAT_ROOM_OP_V1"
+
+// RoomOp is a membership change, it is signed by the member making it so
+// every other member can check the server did not make it up
+type RoomOp struct {
+	Op        RoomOpType `json:"op"`
+	Room      string     `json:"room"`
+	Member    []byte     `json:"member,omitempty"`
+	Actor     []byte     `json:"actor"`
+	ID        string     `json:"id"`
+	Timestamp int64      `json:"timestamp"`
+	Signature []byte     `json:"signature"`
+}
+
+func (o *RoomOp) SigningBytes() []byte {
+	buf := make([]byte, 0, len(roomOpDomain)+len(o.Op)+len(o.Room)+len(o.Member)+len(o.Actor)+len(o.ID)+28)
+	buf = append(buf, roomOpDomain...)
+	buf = appendField(buf, []byte(o.Op))
+	buf = appendField(buf, []byte(o.Room))
+	buf = appendField(buf, o.Member)
+	buf = appendField(buf, o.Actor)
+	buf = appendField(buf, []byte(o.ID))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(o.Timestamp))
+	return buf
+}
+
+// RoomInfo is sent to every member after a membership change together with
+// the operation that caused it, Op is nil when a member is only catching up
+// after login, Ops is the whole signed history starting at CREATE_ROOM and
+// is what members rebuild Owner and Members from
+type RoomInfo struct {
+	Room    string    `json:"room"`
+	Owner   []byte    `json:"owner"`
+	Members [][]byte  `json:"members"`
+	Ops     []*RoomOp `json:"ops"`
+	Op      *RoomOp   `json:"op,omitempty"`
+}
+
+// RoomEnvelope carries one signed user message per member, each copy is
+// encrypted to its own recipient so the server never holds a group key
+type RoomEnvelope struct {
+	Room     string   `json:"room"`
+	Messages []string `json:"messages"`
+}
+
+func ParseRoomOp(msg *ChatMessage) (*RoomOp, error) {
+	op := &RoomOp{}
+	err := json.Unmarshal([]byte(msg.Payload), op)
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func ParseRoomInfo(msg *ChatMessage) (*RoomInfo, error) {
+	info := &RoomInfo{}
+	err := json.Unmarshal([]byte(msg.Payload), info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func ParseRoomEnvelope(msg *ChatMessage) (*RoomEnvelope, error) {
+	envelope := &RoomEnvelope{}
+	err := json.Unmarshal([]byte(msg.Payload), envelope)
+	if err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
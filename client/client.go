@@ -1,118 +1,525 @@
 package client
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	chatmessage "pogchat/chat_message"
 	"pogchat/cryptography"
+	"pogchat/frame"
+	"pogchat/ratchet"
 	"pogchat/user_message"
+	"sync"
+	"time"
 )
 
+// client is shared by the goroutine reading the connection, the one writing
+// it and the connection manager, everything that changes after creation is
+// guarded by mu
 type client struct {
-	loggedIn  bool
+	mu        sync.Mutex
+	state     State
 	publicKey []byte
-	socket    net.Conn
+	deviceID  string
+	deviceKey []byte
+	challenge *chatmessage.Challenge
+	// conn is what frames go through, socket and framer build one for
+	// stream connections
+	conn   Conn
+	socket net.Conn
+	framer frame.Framer
+	// writeMu keeps frames written from several goroutines whole
+	writeMu      sync.Mutex
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	lastRead     time.Time
+	// data is the bounded queue of frames waiting for the writer, callers
+	// decide what to do when it is full
 	data      chan []byte
+	queueSize int
+	// done is closed once the connection starts closing, it stops the
+	// writer, data itself is never closed since it has many writers
+	done     chan struct{}
+	handlers map[string]MessageHandler
+	signer   cryptography.Signer
+	sessions ratchet.Manager
+	// seen outlives the connection when the owner shares one cache across
+	// reconnects, see SetReplayCache
+	seen user_message.ReplayCache
+	// maxAge is how old a message may be, it must cover the time a
+	// message can wait in the mailbox
+	maxAge time.Duration
+	skew   time.Duration
 }
 
 var _ Client = (*client)(nil)
 
+const (
+	REPLAY_CACHE_SIZE  = 4096
+	DEFAULT_QUEUE_SIZE = 256
+	// DEFAULT_MAX_MESSAGE_AGE matches how long the server mailbox keeps
+	// messages for offline keys
+	DEFAULT_MAX_MESSAGE_AGE = 7 * 24 * time.Hour
+	DEFAULT_MESSAGE_SKEW    = 5 * time.Minute
+)
+
+var (
+	InvalidSignatureError   = errors.New("message signature does not match sender key")
+	MisaddressedError       = errors.New("message is addressed to another key")
+	ReplayedMessageError    = errors.New("message was already delivered")
+	StaleMessageError       = errors.New("message timestamp is outside the accepted window")
+	SessionsDisabledError   = errors.New("received a session message but sessions are disabled")
+	UnknownMessageTypeError = errors.New("unknown user message type")
+	InvalidTransitionError  = errors.New("invalid connection state transition")
+	ConnectionClosedError   = errors.New("connection is closed")
+	QueueFullError          = errors.New("send queue is full")
+	ForeignSyncError        = errors.New("sync message was not sent by this key")
+	MalformedFrameError     = errors.New("frame is not a chat message")
+)
+
 func (c *client) Receive() {
 	for {
-		message := make([]byte, 4096)
-		length, err := c.socket.Read(message)
+		message, err := c.ReadFrame()
 		if err != nil {
-			c.socket.Close()
+			c.Close()
 			break
 		}
-		if length > 0 {
-			fmt.Println("RECEIVED: " + string(message))
-		}
+		fmt.Println("RECEIVED: " + string(message))
 	}
 }
 
-func trimByteSeq(seq []byte, delim byte) []byte {
-	finalSeq := make([]byte, 0)
+func (c *client) ReceiveAndDecrypt(private []byte, rec chan *Incoming) {
+	cryptor := cryptography.NewCryptor()
 
-	for _, b := range seq {
-		if b == delim {
-			break
+	c.Handle(chatmessage.PEER_MSG, func(msg *chatmessage.ChatMessage) error {
+		um, err := user_message.ParseFromJSON(msg.Payload, user_message.WithSigner(c.signer))
+		if err != nil {
+			return err
 		}
-		finalSeq = append(finalSeq, b)
-	}
 
-	return finalSeq
-}
+		// the relay is not trusted, a message only counts as coming from
+		// FromPublicKey if that key signed it
+		err = um.Verify()
+		if err != nil {
+			rec <- &Incoming{From: um.FromPublicKey(), Err: InvalidSignatureError}
+			return err
+		}
+
+		if pk := c.PublicKey(); len(pk) > 0 && !bytes.Equal(um.ToPublicKey(), pk) {
+			rec <- &Incoming{From: um.FromPublicKey(), Err: MisaddressedError}
+			return MisaddressedError
+		}
+
+		// a replay older than the window could have fallen out of the
+		// cache, so it is refused on its timestamp alone
+		age := time.Since(time.Unix(um.Timestamp(), 0))
+		if age > c.maxAge || age < -c.skew {
+			rec <- &Incoming{From: um.FromPublicKey(), Err: StaleMessageError}
+			return StaleMessageError
+		}
+
+		if c.seen.Seen(um.ID()) {
+			return ReplayedMessageError
+		}
+
+		dec, err := c.decrypt(cryptor, private, um)
+		if err != nil {
+			rec <- &Incoming{From: um.FromPublicKey(), Err: err}
+			return err
+		}
+
+		rec <- &Incoming{From: um.FromPublicKey(), Type: um.Type(), Room: um.Room(), Message: dec}
+		return nil
+	})
 
-func (c *client) ReceiveAndDecrypt(private []byte, rec chan []byte) {
-	cryptor := cryptography.NewCryptor()
 	for {
-		message := make([]byte, 4096)
-		length, err := c.socket.Read(message)
+		message, err := c.ReadFrame()
 		if err != nil {
-			c.socket.Close()
+			c.Close()
 			break
 		}
-		if length > 0 {
-			processedMsg := trimByteSeq(message, '\x00')
-			um, err := user_message.ParseFromJSON(string(processedMsg))
-			if err != nil {
-				log.Printf("[client.ReceiveAndDecrupt] ParseFromJSON() returned error: %+v\n", err)
-				continue
-			}
 
-			dec, err := cryptor.Decrypt(private, um.Message())
-			if err != nil {
-				log.Printf("[client.ReceiveAndDecrupt] could not decode error: %+v\n", err)
-				return
-			}
+		chatMsg := &chatmessage.ChatMessage{}
+		err = json.Unmarshal(message, chatMsg)
+		if err != nil {
+			log.Printf("[client.ReceiveAndDecrypt] json.Unmarshal() returned error: %+v\n", err)
+			continue
+		}
+
+		handler, ok := c.handlers[chatMsg.Type]
+		if !ok {
+			log.Printf("[client.ReceiveAndDecrypt] unknown message type: %s\n", chatMsg.Type)
+			continue
+		}
+
+		err = handler(chatMsg)
+		if err != nil {
+			log.Printf("[client.ReceiveAndDecrypt] %s handler returned error: %+v\n", chatMsg.Type, err)
+		}
+	}
+}
 
-			rec <- dec
+func (c *client) decrypt(cryptor cryptography.Cryptor, private []byte, um user_message.UserMessage) ([]byte, error) {
+	switch um.Type() {
+	case user_message.TEXT_MESSAGE:
+		return cryptor.Decrypt(private, um.Message())
+	case user_message.SYNC_MESSAGE:
+		// only our own devices may tell us what we sent
+		if !bytes.Equal(um.FromPublicKey(), um.ToPublicKey()) {
+			return nil, ForeignSyncError
+		}
+		return cryptor.Decrypt(private, um.Message())
+	case user_message.RATCHET_MESSAGE:
+		if c.sessions == nil {
+			return nil, SessionsDisabledError
 		}
+		return c.sessions.Decrypt(um.FromPublicKey(), um.Message())
+	default:
+		return nil, UnknownMessageTypeError
+	}
+}
+
+func (c *client) Handle(msgType string, handler MessageHandler) {
+	c.handlers[msgType] = handler
+}
+
+// pong answers heartbeats from the other end
+func (c *client) pong(msg *chatmessage.ChatMessage) error {
+	ping, err := chatmessage.ParseHeartbeat(msg)
+	if err != nil {
+		return err
+	}
+
+	pong, err := chatmessage.NewPong(ping, time.Now().Unix())
+	if err != nil {
+		return err
 	}
+
+	payload, err := json.Marshal(pong)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteFrame(payload)
+}
+
+func logStatus(msg *chatmessage.ChatMessage) error {
+	status, err := chatmessage.ParseStatus(msg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[client.logStatus] server returned status %s: %s\n", status.Code, status.Reason)
+	return nil
 }
 
+// Close moves the connection to CLOSING and shuts the socket, it is safe
+// to call more than once and from any goroutine
 func (c *client) Close() error {
-	return c.socket.Close()
+	c.mu.Lock()
+	if c.state == CLOSING || c.state == CLOSED {
+		c.mu.Unlock()
+		return nil
+	}
+	c.state = CLOSING
+	close(c.done)
+	c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *client) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Transition moves the connection from one state to another, it fails when
+// the connection is not in from anymore or the move is not allowed
+func (c *client) Transition(from State, to State) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != from || !canTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s while %s", InvalidTransitionError, from, to, c.state)
+	}
+	c.state = to
+	return nil
+}
+
+func (c *client) Done() <-chan struct{} {
+	return c.done
+}
+
+// ReadFrame waits at most the read timeout for the next frame, every frame
+// read counts as a sign of life from the other end
+func (c *client) ReadFrame() ([]byte, error) {
+	err := c.readDeadline()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := c.conn.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	c.touch()
+	return payload, nil
+}
+
+// ReadMessage is ReadFrame for the relay, a MessageConn hands over its
+// messages as decoded, a frame that is not an envelope is reported as
+// MalformedFrameError and leaves the connection usable
+func (c *client) ReadMessage() (*chatmessage.ChatMessage, error) {
+	conn, ok := c.conn.(MessageConn)
+	if !ok {
+		payload, err := c.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		return DecodeEnvelope(payload)
+	}
+
+	err := c.readDeadline()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	c.touch()
+	return msg, nil
+}
+
+// EncodeMessage turns msg into a frame for this connection, queued frames
+// are already in the encoding WriteFrame sends
+func (c *client) EncodeMessage(msg *chatmessage.ChatMessage) ([]byte, error) {
+	if conn, ok := c.conn.(MessageConn); ok {
+		return conn.EncodeMessage(msg)
+	}
+	return msg.Envelope()
 }
 
-func (c *client) Read(buf []byte) (int, error) {
-	return c.socket.Read(buf)
+// DecodeMessage reads back a frame made by EncodeMessage
+func (c *client) DecodeMessage(frame []byte) (*chatmessage.ChatMessage, error) {
+	if conn, ok := c.conn.(MessageConn); ok {
+		return conn.DecodeMessage(frame)
+	}
+	return DecodeEnvelope(frame)
 }
 
-func (c *client) Write(b []byte) (int, error) {
-	return c.socket.Write(b)
+func (c *client) readDeadline() error {
+	if c.readTimeout > 0 {
+		return c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	return nil
+}
+
+func (c *client) touch() {
+	c.mu.Lock()
+	c.lastRead = time.Now()
+	c.mu.Unlock()
+}
+
+// DecodeEnvelope parses a JSON frame, failures wrap MalformedFrameError
+func DecodeEnvelope(frame []byte) (*chatmessage.ChatMessage, error) {
+	msg := &chatmessage.ChatMessage{}
+	err := json.Unmarshal(frame, msg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", MalformedFrameError, err)
+	}
+	return msg, nil
+}
+
+func (c *client) WriteFrame(payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.writeTimeout > 0 {
+		err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.conn.WriteFrame(payload)
+}
+
+// LastRead is when the last frame arrived, or when the connection was made
+func (c *client) LastRead() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastRead
 }
 
 func (c *client) WriteToChan() chan []byte {
 	return c.data
 }
 
+// Enqueue hands a frame to the writer goroutine without ever blocking, a
+// full queue is reported so one slow reader can not stall its senders
+func (c *client) Enqueue(payload []byte) error {
+	select {
+	case <-c.done:
+		return ConnectionClosedError
+	default:
+	}
+
+	select {
+	case c.data <- payload:
+		return nil
+	default:
+		return QueueFullError
+	}
+}
+
+// Evict drops the oldest queued frame, it reports false when the writer
+// already took everything
+func (c *client) Evict() bool {
+	select {
+	case <-c.data:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pending empties the queue and returns the frames that were waiting in
+// it, oldest first
+func (c *client) Pending() [][]byte {
+	var frames [][]byte
+	for {
+		select {
+		case frame := <-c.data:
+			frames = append(frames, frame)
+		default:
+			return frames
+		}
+	}
+}
+
+func (c *client) QueueLen() int {
+	return len(c.data)
+}
+
+func (c *client) QueueCap() int {
+	return cap(c.data)
+}
+
 func (c *client) LoggedIn() bool {
-	return c.loggedIn
+	return c.State() == AUTHENTICATED
 }
 
+// SetLoggedIn is kept for callers that only care about being logged in,
+// it is a no-op once the connection is closing
 func (c *client) SetLoggedIn(loggedIn bool) {
-	c.loggedIn = loggedIn
+	if loggedIn {
+		c.Transition(CONNECTED, AUTHENTICATED)
+		return
+	}
+	c.Transition(AUTHENTICATED, CONNECTED)
 }
 
 func (c *client) PublicKey() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.publicKey
 }
 
 func (c *client) SetPublicKey(publicKey []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.publicKey = publicKey
 }
 
+func (c *client) DeviceID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deviceID
+}
+
+func (c *client) SetDeviceID(deviceID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deviceID = deviceID
+}
+
+func (c *client) DeviceKey() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deviceKey
+}
+
+func (c *client) SetDeviceKey(deviceKey []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deviceKey = deviceKey
+}
+
+func (c *client) Challenge() *chatmessage.Challenge {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.challenge
+}
+
+func (c *client) SetChallenge(challenge *chatmessage.Challenge) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.challenge = challenge
+}
+
+func (c *client) SetSessions(sessions ratchet.Manager) {
+	c.sessions = sessions
+}
+
+// SetReplayCache replaces the cache of delivered message ids, sharing one
+// across reconnects keeps a relay from replaying messages on a new
+// connection
+func (c *client) SetReplayCache(seen user_message.ReplayCache) {
+	c.seen = seen
+}
+
 func NewClient(opts ...ClientOpts) Client {
 	c := &client{
-		data: make(chan []byte),
+		state:     CONNECTED,
+		queueSize: DEFAULT_QUEUE_SIZE,
+		lastRead:  time.Now(),
+		done:      make(chan struct{}),
+		framer:    frame.NewFramer(),
+		handlers:  make(map[string]MessageHandler),
+		seen:      user_message.NewReplayCache(REPLAY_CACHE_SIZE),
+		maxAge:    DEFAULT_MAX_MESSAGE_AGE,
+		skew:      DEFAULT_MESSAGE_SKEW,
+		signer: cryptography.NewSigner(
+			cryptography.WithSignerHasher(crypto.SHA256),
+			cryptography.WithSignerRandomizer(rand.Reader)),
 	}
 
+	c.Handle(chatmessage.STATUS_MSG, logStatus)
+	c.Handle(chatmessage.PING_MSG, c.pong)
+	c.Handle(chatmessage.PONG_MSG, func(*chatmessage.ChatMessage) error { return nil })
+
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	c.data = make(chan []byte, c.queueSize)
+	if c.conn == nil && c.socket != nil {
+		c.conn = NewStreamConn(c.socket, c.framer)
+	}
+
 	return c
 }
 
@@ -121,3 +528,57 @@ func WithConnection(conn net.Conn) ClientOpts {
 		c.socket = conn
 	}
 }
+
+// WithMessageWindow sets how old and how far in the future a message
+// timestamp may be before the message is refused
+func WithMessageWindow(maxAge time.Duration, skew time.Duration) ClientOpts {
+	return func(c *client) {
+		c.maxAge = maxAge
+		c.skew = skew
+	}
+}
+
+// WithMessageConn uses a connection that already carries whole frames,
+// such as the ones made by the transport package, instead of a raw socket
+func WithMessageConn(conn Conn) ClientOpts {
+	return func(c *client) {
+		c.conn = conn
+	}
+}
+
+func WithSigner(signer cryptography.Signer) ClientOpts {
+	return func(c *client) {
+		c.signer = signer
+	}
+}
+
+func WithFramer(framer frame.Framer) ClientOpts {
+	return func(c *client) {
+		c.framer = framer
+	}
+}
+
+// WithQueueSize bounds how many frames may wait for the writer
+func WithQueueSize(size int) ClientOpts {
+	return func(c *client) {
+		if size > 0 {
+			c.queueSize = size
+		}
+	}
+}
+
+// WithReadTimeout closes the connection when nothing arrives for d, zero
+// waits forever
+func WithReadTimeout(d time.Duration) ClientOpts {
+	return func(c *client) {
+		c.readTimeout = d
+	}
+}
+
+// WithWriteTimeout gives up on a frame the other end does not take within
+// d, zero waits forever
+func WithWriteTimeout(d time.Duration) ClientOpts {
+	return func(c *client) {
+		c.writeTimeout = d
+	}
+}
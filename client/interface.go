@@ -1,16 +1,78 @@
 package client
 
+import (
+	chatmessage "pogchat/chat_message"
+	"pogchat/ratchet"
+	"pogchat/user_message"
+	"time"
+)
+
+type MessageHandler func(msg *chatmessage.ChatMessage) error
+
+// Conn carries whole frames, a stream like TCP gets them from a
+// frame.Framer while a WebSocket delimits messages itself
+type Conn interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame(payload []byte) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// MessageConn is a Conn that knows the encoding of its frames, the relay
+// reads decoded messages from it and queues frames it encoded so peer
+// messages never go through JSON on their way from one binary frame to
+// another
+type MessageConn interface {
+	Conn
+	ReadMessage() (*chatmessage.ChatMessage, error)
+	EncodeMessage(msg *chatmessage.ChatMessage) ([]byte, error)
+	DecodeMessage(frame []byte) (*chatmessage.ChatMessage, error)
+}
+
+// Incoming is a peer message handed to the user once its signature has been
+// checked against the sender key, Err is set when the message was rejected
+// and Room when it is a copy of a room message
+type Incoming struct {
+	From    []byte
+	Type    string
+	Room    string
+	Message []byte
+	Err     error
+}
+
 type Client interface {
 	LoggedIn() bool
 	PublicKey() []byte
 	SetLoggedIn(loggedIn bool)
 	SetPublicKey(publicKey []byte)
+	DeviceID() string
+	SetDeviceID(deviceID string)
+	DeviceKey() []byte
+	SetDeviceKey(deviceKey []byte)
+	Challenge() *chatmessage.Challenge
+	SetChallenge(challenge *chatmessage.Challenge)
+	SetSessions(sessions ratchet.Manager)
+	SetReplayCache(seen user_message.ReplayCache)
+	State() State
+	Transition(from State, to State) error
+	Done() <-chan struct{}
 	Close() error
-	Read(buf []byte) (int, error)
-	Write(buf []byte) (int, error)
+	ReadFrame() ([]byte, error)
+	WriteFrame(payload []byte) error
+	ReadMessage() (*chatmessage.ChatMessage, error)
+	EncodeMessage(msg *chatmessage.ChatMessage) ([]byte, error)
+	DecodeMessage(frame []byte) (*chatmessage.ChatMessage, error)
+	LastRead() time.Time
 	WriteToChan() chan []byte
+	Enqueue(payload []byte) error
+	Evict() bool
+	Pending() [][]byte
+	QueueLen() int
+	QueueCap() int
+	Handle(msgType string, handler MessageHandler)
 	Receive()
-	ReceiveAndDecrypt(private []byte, rec chan []byte)
+	ReceiveAndDecrypt(private []byte, rec chan *Incoming)
 }
 
 type ClientOpts func(*client)
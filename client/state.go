@@ -0,0 +1,46 @@
+package client
+
+import "fmt"
+
+// State is where a connection is in its lifecycle, it only ever moves
+// forward except for a logout that takes an authenticated connection back
+// to connected
+type State int
+
+const (
+	CONNECTED State = iota
+	AUTHENTICATED
+	CLOSING
+	CLOSED
+)
+
+var stateNames = map[State]string{
+	CONNECTED:     "CONNECTED",
+	AUTHENTICATED: "AUTHENTICATED",
+	CLOSING:       "CLOSING",
+	CLOSED:        "CLOSED",
+}
+
+func (s State) String() string {
+	name, ok := stateNames[s]
+	if !ok {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return name
+}
+
+// transitions lists every allowed move, anything else is refused
+var transitions = map[State][]State{
+	CONNECTED:     {AUTHENTICATED, CLOSING},
+	AUTHENTICATED: {CONNECTED, CLOSING},
+	CLOSING:       {CLOSED},
+}
+
+func canTransition(from State, to State) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"net"
+	"pogchat/frame"
+	"time"
+)
+
+// streamConn frames messages over a byte stream
+type streamConn struct {
+	conn   net.Conn
+	framer frame.Framer
+}
+
+var _ Conn = (*streamConn)(nil)
+
+func NewStreamConn(conn net.Conn, framer frame.Framer) Conn {
+	return &streamConn{conn: conn, framer: framer}
+}
+
+func (s *streamConn) ReadFrame() ([]byte, error) {
+	return s.framer.ReadFrame(s.conn)
+}
+
+func (s *streamConn) WriteFrame(payload []byte) error {
+	return s.framer.WriteFrame(s.conn, payload)
+}
+
+func (s *streamConn) SetReadDeadline(t time.Time) error {
+	return s.conn.SetReadDeadline(t)
+}
+
+func (s *streamConn) SetWriteDeadline(t time.Time) error {
+	return s.conn.SetWriteDeadline(t)
+}
+
+func (s *streamConn) Close() error {
+	return s.conn.Close()
+}
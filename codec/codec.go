@@ -0,0 +1,249 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"pogchat/rpc"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// the server side hands the relay decoded messages and queues frames it
+// encoded itself, a peer message goes from one protobuf frame to another
+// without JSON, see BenchmarkCodec, clients still speak the JSON envelope
+// above their connection
+
+func ParseCodec(codec string) (string, error) {
+	c := strings.ToLower(codec)
+	switch c {
+	case JSON, PROTO:
+		return c, nil
+	default:
+		return "", fmt.Errorf("%w: %q", UnknownCodecError, codec)
+	}
+}
+
+// serverConn reads frames in either encoding and answers in protobuf once
+// the client wrote one, a connection that is a client.MessageConn itself,
+// like a gRPC stream, does the encoding instead
+type serverConn struct {
+	conn  client.Conn
+	proto atomic.Bool
+}
+
+var _ client.MessageConn = (*serverConn)(nil)
+
+func NewServerConn(conn client.Conn) client.Conn {
+	return &serverConn{conn: conn}
+}
+
+func (c *serverConn) ReadFrame() ([]byte, error) {
+	payload, err := c.conn.ReadFrame()
+	if err != nil || rpc.IsJSON(payload) {
+		return payload, err
+	}
+
+	msg, err := c.decodeClientFrame(payload)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Envelope()
+}
+
+func (c *serverConn) ReadMessage() (*chatmessage.ChatMessage, error) {
+	if conn, ok := c.conn.(client.MessageConn); ok {
+		return conn.ReadMessage()
+	}
+
+	payload, err := c.conn.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	if rpc.IsJSON(payload) {
+		return client.DecodeEnvelope(payload)
+	}
+	return c.decodeClientFrame(payload)
+}
+
+func (c *serverConn) decodeClientFrame(payload []byte) (*chatmessage.ChatMessage, error) {
+	frame := &rpc.ClientFrame{}
+	err := proto.Unmarshal(payload, frame)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := rpc.DecodeClientFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	c.proto.Store(true)
+	return msg, nil
+}
+
+// EncodeMessage picks the encoding when the frame is queued, a switch to
+// protobuf while JSON frames wait is handled by WriteFrame
+func (c *serverConn) EncodeMessage(msg *chatmessage.ChatMessage) ([]byte, error) {
+	if conn, ok := c.conn.(client.MessageConn); ok {
+		return conn.EncodeMessage(msg)
+	}
+	if !c.proto.Load() {
+		return msg.Envelope()
+	}
+
+	frame, err := rpc.EncodeServerFrame(msg)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(frame)
+}
+
+func (c *serverConn) DecodeMessage(payload []byte) (*chatmessage.ChatMessage, error) {
+	if conn, ok := c.conn.(client.MessageConn); ok {
+		return conn.DecodeMessage(payload)
+	}
+	if rpc.IsJSON(payload) {
+		return client.DecodeEnvelope(payload)
+	}
+
+	frame := &rpc.ServerFrame{}
+	err := proto.Unmarshal(payload, frame)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.DecodeServerFrame(frame)
+}
+
+// WriteFrame sends frames from EncodeMessage as they are, JSON ones are
+// only converted once the client switched to protobuf
+func (c *serverConn) WriteFrame(payload []byte) error {
+	if !c.proto.Load() || !rpc.IsJSON(payload) {
+		return c.conn.WriteFrame(payload)
+	}
+
+	msg, err := client.DecodeEnvelope(payload)
+	if err != nil {
+		return err
+	}
+	frame, err := rpc.EncodeServerFrame(msg)
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteFrame(b)
+}
+
+func (c *serverConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *serverConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *serverConn) Close() error {
+	return c.conn.Close()
+}
+
+// clientConn writes JSON until the challenge of the server offers the
+// preferred codec, it reads frames in either encoding
+type clientConn struct {
+	conn      client.Conn
+	preferred string
+	// challenged is only touched by the reader, proto is read by writers
+	challenged bool
+	proto      atomic.Bool
+}
+
+var _ client.Conn = (*clientConn)(nil)
+
+// NewClientConn negotiates preferred with the server, JSON never switches
+func NewClientConn(conn client.Conn, preferred string) client.Conn {
+	return &clientConn{conn: conn, preferred: preferred}
+}
+
+func (c *clientConn) ReadFrame() ([]byte, error) {
+	payload, err := c.conn.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	if !rpc.IsJSON(payload) {
+		frame := &rpc.ServerFrame{}
+		err = proto.Unmarshal(payload, frame)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := rpc.DecodeServerFrame(frame)
+		if err != nil {
+			return nil, err
+		}
+		return msg.Envelope()
+	}
+
+	if c.preferred == PROTO && !c.challenged {
+		c.negotiate(payload)
+	}
+	return payload, nil
+}
+
+// negotiate switches to protobuf when the server offers it, the login
+// answering the challenge is the first frame written that way
+func (c *clientConn) negotiate(payload []byte) {
+	msg := &chatmessage.ChatMessage{}
+	if json.Unmarshal(payload, msg) != nil || msg.Type != chatmessage.CHALLENGE_MSG {
+		return
+	}
+	c.challenged = true
+
+	challenge, err := chatmessage.ParseChallenge(msg)
+	if err != nil {
+		return
+	}
+	for _, codec := range challenge.Codecs {
+		if codec == PROTO {
+			c.proto.Store(true)
+			return
+		}
+	}
+}
+
+func (c *clientConn) WriteFrame(payload []byte) error {
+	if !c.proto.Load() {
+		return c.conn.WriteFrame(payload)
+	}
+
+	msg := &chatmessage.ChatMessage{}
+	err := json.Unmarshal(payload, msg)
+	if err != nil {
+		return err
+	}
+	frame, err := rpc.EncodeClientFrame(msg)
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteFrame(b)
+}
+
+func (c *clientConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *clientConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *clientConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,278 @@
+package codec
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	chatmessage "pogchat/chat_message"
+	"pogchat/rpc"
+	"pogchat/user_message"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+// memConn is one end of an in memory connection
+type memConn struct {
+	in  chan []byte
+	out chan []byte
+}
+
+func pair() (*memConn, *memConn) {
+	a, b := make(chan []byte, 16), make(chan []byte, 16)
+	return &memConn{in: a, out: b}, &memConn{in: b, out: a}
+}
+
+func (c *memConn) ReadFrame() ([]byte, error) {
+	payload, ok := <-c.in
+	if !ok {
+		return nil, io.EOF
+	}
+	return payload, nil
+}
+
+func (c *memConn) WriteFrame(payload []byte) error {
+	c.out <- payload
+	return nil
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *memConn) SetWriteDeadline(t time.Time) error { return nil }
+func (c *memConn) Close() error                       { return nil }
+
+// stubConn reads the same frame forever and keeps the last one written
+type stubConn struct {
+	frame []byte
+}
+
+func (c *stubConn) ReadFrame() ([]byte, error)         { return c.frame, nil }
+func (c *stubConn) WriteFrame(payload []byte) error    { c.frame = payload; return nil }
+func (c *stubConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *stubConn) SetWriteDeadline(t time.Time) error { return nil }
+func (c *stubConn) Close() error                       { return nil }
+
+// peerMessage is a direct message the size of a short text wrapped for an
+// RSA key
+func peerMessage(t testing.TB) *chatmessage.ChatMessage {
+	random := func(size int) []byte {
+		b := make([]byte, size)
+		_, err := rand.Read(b)
+		assert.Nil(t, err)
+		return b
+	}
+
+	um := user_message.NewUserMessage(
+		user_message.WithFromPublicKey(random(32)),
+		user_message.WithToPublicKey(random(32)),
+		user_message.WithMessage(random(512)),
+		user_message.WithSignature(random(64)))
+	payload, err := um.MarshalJSON()
+	assert.Nil(t, err)
+	return &chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, Payload: string(payload)}
+}
+
+func encode(t testing.TB, msg *chatmessage.ChatMessage) []byte {
+	b, err := json.Marshal(msg)
+	assert.Nil(t, err)
+	return b
+}
+
+func challenge(t testing.TB, codecs ...string) []byte {
+	msg, err := chatmessage.NewChatMessage(chatmessage.CHALLENGE_MSG, &chatmessage.Challenge{
+		Nonce:    []byte("nonce"),
+		ServerID: "server",
+		Codecs:   codecs,
+	})
+	assert.Nil(t, err)
+	return encode(t, msg)
+}
+
+func TestCodec(t *testing.T) {
+	ping, err := chatmessage.NewPing(1, 2)
+	assert.Nil(t, err)
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "client switches to proto once offered",
+			f: func(t *testing.T) {
+				server, raw := pair()
+				c := NewClientConn(raw, PROTO)
+
+				assert.Nil(t, c.WriteFrame(encode(t, ping)))
+				frame, _ := server.ReadFrame()
+				assert.True(t, rpc.IsJSON(frame))
+
+				assert.Nil(t, server.WriteFrame(challenge(t, PROTO)))
+				_, err := c.ReadFrame()
+				assert.Nil(t, err)
+
+				assert.Nil(t, c.WriteFrame(encode(t, ping)))
+				frame, _ = server.ReadFrame()
+				assert.False(t, rpc.IsJSON(frame))
+				got := &rpc.ClientFrame{}
+				assert.Nil(t, proto.Unmarshal(frame, got))
+				assert.Equal(t, uint64(1), got.GetPing().GetSeq())
+			},
+		},
+		{
+			name: "client keeps json when the server offers nothing",
+			f: func(t *testing.T) {
+				server, raw := pair()
+				c := NewClientConn(raw, PROTO)
+
+				assert.Nil(t, server.WriteFrame(challenge(t)))
+				_, err := c.ReadFrame()
+				assert.Nil(t, err)
+
+				assert.Nil(t, c.WriteFrame(encode(t, ping)))
+				frame, _ := server.ReadFrame()
+				assert.True(t, rpc.IsJSON(frame))
+			},
+		},
+		{
+			name: "json client never switches",
+			f: func(t *testing.T) {
+				server, raw := pair()
+				c := NewClientConn(raw, JSON)
+
+				assert.Nil(t, server.WriteFrame(challenge(t, PROTO)))
+				_, err := c.ReadFrame()
+				assert.Nil(t, err)
+
+				assert.Nil(t, c.WriteFrame(encode(t, ping)))
+				frame, _ := server.ReadFrame()
+				assert.True(t, rpc.IsJSON(frame))
+			},
+		},
+		{
+			name: "server answers in proto once the client used it",
+			f: func(t *testing.T) {
+				raw, peer := pair()
+				s := NewServerConn(raw)
+
+				assert.Nil(t, peer.WriteFrame(encode(t, ping)))
+				_, err := s.ReadFrame()
+				assert.Nil(t, err)
+				assert.Nil(t, s.WriteFrame(encode(t, ping)))
+				frame, _ := peer.ReadFrame()
+				assert.True(t, rpc.IsJSON(frame))
+
+				b, err := proto.Marshal(&rpc.ClientFrame{Frame: &rpc.ClientFrame_Ping{Ping: &rpc.Heartbeat{Seq: 1, Timestamp: 2}}})
+				assert.Nil(t, err)
+				assert.Nil(t, peer.WriteFrame(b))
+				got, err := s.ReadFrame()
+				assert.Nil(t, err)
+				assert.Equal(t, encode(t, ping), got)
+
+				assert.Nil(t, s.WriteFrame(encode(t, ping)))
+				frame, _ = peer.ReadFrame()
+				assert.False(t, rpc.IsJSON(frame))
+			},
+		},
+		{
+			name: "peer messages cross negotiated connections unchanged",
+			f: func(t *testing.T) {
+				rawServer, rawClient := pair()
+				s, c := NewServerConn(rawServer), NewClientConn(rawClient, PROTO)
+
+				assert.Nil(t, s.WriteFrame(challenge(t, PROTO)))
+				_, err := c.ReadFrame()
+				assert.Nil(t, err)
+
+				msg := encode(t, peerMessage(t))
+				assert.Nil(t, c.WriteFrame(msg))
+				got, err := s.ReadFrame()
+				assert.Nil(t, err)
+				assert.Equal(t, msg, got)
+
+				assert.Nil(t, s.WriteFrame(msg))
+				got, err = c.ReadFrame()
+				assert.Nil(t, err)
+				assert.Equal(t, msg, got)
+			},
+		},
+		{
+			name: "codec is parsed",
+			f: func(t *testing.T) {
+				codec, err := ParseCodec("PROTO")
+				assert.Nil(t, err)
+				assert.Equal(t, PROTO, codec)
+
+				_, err = ParseCodec("xml")
+				assert.ErrorIs(t, err, UnknownCodecError)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
+
+// BenchmarkCodec measures the server side of a connection for a direct
+// message, read is the frame on the wire to the message the relay routes and
+// write is that message back to a frame, a stub connection keeps the wire
+// out of the numbers
+func BenchmarkCodec(b *testing.B) {
+	msg := peerMessage(b)
+	clientFrame, err := rpc.EncodeClientFrame(msg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	decoded, err := rpc.DecodeClientFrame(clientFrame)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	frames := map[string][]byte{JSON: encode(b, msg)}
+	frames[PROTO], err = proto.Marshal(clientFrame)
+	if err != nil {
+		b.Fatal(err)
+	}
+	// each codec writes the message as it came in through that codec
+	routed := map[string]*chatmessage.ChatMessage{JSON: msg, PROTO: decoded}
+
+	for _, codec := range []string{JSON, PROTO} {
+		codec := codec
+
+		b.Run(codec+"/read", func(b *testing.B) {
+			b.ReportAllocs()
+			s := NewServerConn(&stubConn{frame: frames[codec]}).(*serverConn)
+			for i := 0; i < b.N; i++ {
+				chatMsg, err := s.ReadMessage()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if chatMsg.User == nil {
+					_, err = user_message.ParseFromJSON(chatMsg.Payload)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+
+		b.Run(codec+"/write", func(b *testing.B) {
+			b.ReportAllocs()
+			stub := &stubConn{}
+			s := NewServerConn(stub).(*serverConn)
+			s.proto.Store(codec == PROTO)
+			for i := 0; i < b.N; i++ {
+				frame, err := s.EncodeMessage(routed[codec])
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = s.WriteFrame(frame)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(stub.frame)), "bytes/frame")
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package codec
+
+import "errors"
+
+const (
+	// JSON is the envelope every peer understands, it is never offered
+	// since it is always there to fall back to
+	JSON = "json"
+	// PROTO encodes frames as the ClientFrame and ServerFrame messages of
+	// rpc/pogchat.proto
+	PROTO = "proto"
+)
+
+var UnknownCodecError = errors.New("unknown codec")
@@ -2,44 +2,165 @@ package cryptography
 
 import (
 	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/binary"
 	"hash"
 	"io"
+	"pogchat/key"
 )
 
 type cryptor struct {
-	r      io.Reader
-	hasher hash.Hash
+	r       io.Reader
+	hasher  hash.Hash
+	version EnvelopeVersion
 }
 
 var _ Encryptor = (*cryptor)(nil)
 var _ Decryptor = (*cryptor)(nil)
 
+const (
+	contentKeySize = 32
+	envelopeLabel  = "POGCHAT_ENVELOPE_V2"
+)
+
 func (e *cryptor) Encrypt(otherPublic []byte, msg []byte) ([]byte, error) {
+	switch key.PublicKeyType(otherPublic) {
+	case key.RSA_PUBLIC_KEY:
+		return e.encryptRSA(otherPublic, msg)
+	default:
+		curvePublic, err := CurvePublicKey(otherPublic)
+		if err != nil {
+			return nil, err
+		}
+		return e.sealX25519(curvePublic, msg)
+	}
+}
+
+func (e *cryptor) Decrypt(myPrivate []byte, encryptedMsg []byte) ([]byte, error) {
+	switch key.PrivateKeyType(myPrivate) {
+	case key.RSA_PRIVATE_KEY:
+		return e.decryptRSA(myPrivate, encryptedMsg)
+	default:
+		curvePrivate, err := CurvePrivateKey(myPrivate)
+		if err != nil {
+			return nil, err
+		}
+		return e.openX25519(curvePrivate, encryptedMsg)
+	}
+}
+
+func (e *cryptor) encryptRSA(otherPublic []byte, msg []byte) ([]byte, error) {
 	publicKey, err := x509.ParsePKCS1PublicKey(otherPublic)
 	if err != nil {
 		return nil, err
 	}
-	encryptedMsg, err := rsa.EncryptOAEP(e.hasher, e.r, publicKey, msg, []byte(""))
+
+	switch e.version {
+	case ENVELOPE_V1:
+		return rsa.EncryptOAEP(e.hasher, e.r, publicKey, msg, []byte(""))
+	case ENVELOPE_V2:
+		return e.seal(publicKey, msg)
+	default:
+		return nil, UnknownEnvelopeVersionError
+	}
+}
+
+func (e *cryptor) decryptRSA(myPrivate []byte, encryptedMsg []byte) ([]byte, error) {
+	privateKey, err := x509.ParsePKCS1PrivateKey(myPrivate)
 	if err != nil {
 		return nil, err
 	}
-	return encryptedMsg, nil
+
+	// a v1 ciphertext is always exactly one RSA block long while a v2
+	// envelope always carries a wrapped key plus header, so the length
+	// alone tells them apart
+	if len(encryptedMsg) == privateKey.Size() {
+		return rsa.DecryptOAEP(e.hasher, e.r, privateKey, encryptedMsg, []byte(""))
+	}
+
+	if len(encryptedMsg) == 0 || EnvelopeVersion(encryptedMsg[0]) != ENVELOPE_V2 {
+		return nil, UnknownEnvelopeVersionError
+	}
+
+	return e.open(privateKey, encryptedMsg)
 }
 
-func (e *cryptor) Decrypt(myPrivate []byte, encryptedMsg []byte) ([]byte, error) {
-	privateKey, err := x509.ParsePKCS1PrivateKey(myPrivate)
+// seal builds a v2 envelope laid out as
+// version | wrapped key length (2 bytes) | wrapped key | nonce | ciphertext
+func (e *cryptor) seal(publicKey *rsa.PublicKey, msg []byte) ([]byte, error) {
+	contentKey := make([]byte, contentKeySize)
+	_, err := io.ReadFull(e.r, contentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(e.hasher, e.r, publicKey, contentKey, []byte(envelopeLabel))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 3, 3+len(wrappedKey)+aead.NonceSize())
+	header[0] = byte(ENVELOPE_V2)
+	binary.BigEndian.PutUint16(header[1:], uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(e.r, nonce)
 	if err != nil {
 		return nil, err
 	}
-	decryptedMsg, err := rsa.DecryptOAEP(e.hasher, e.r, privateKey, encryptedMsg, []byte(""))
+
+	envelope := append(header, nonce...)
+	return aead.Seal(envelope, nonce, msg, header), nil
+}
+
+func (e *cryptor) open(privateKey *rsa.PrivateKey, envelope []byte) ([]byte, error) {
+	if len(envelope) < 3 {
+		return nil, MalformedEnvelopeError
+	}
+
+	wrappedKeyLen := int(binary.BigEndian.Uint16(envelope[1:3]))
+	headerLen := 3 + wrappedKeyLen
+	if len(envelope) < headerLen {
+		return nil, MalformedEnvelopeError
+	}
+
+	header := envelope[:headerLen]
+	contentKey, err := rsa.DecryptOAEP(e.hasher, e.r, privateKey, header[3:], []byte(envelopeLabel))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	body := envelope[headerLen:]
+	if len(body) < aead.NonceSize()+aead.Overhead() {
+		return nil, MalformedEnvelopeError
+	}
+
+	return aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], header)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return decryptedMsg, err
+		return nil, err
 	}
-	return decryptedMsg, nil
+	return cipher.NewGCM(block)
 }
 
 func WithHasher(hasher hash.Hash) CryptorOpts {
@@ -54,10 +175,19 @@ func WithRandomizer(r io.Reader) CryptorOpts {
 	}
 }
 
+// WithEnvelopeVersion selects the format used by Encrypt, Decrypt always
+// accepts every known version
+func WithEnvelopeVersion(version EnvelopeVersion) CryptorOpts {
+	return func(c *cryptor) {
+		c.version = version
+	}
+}
+
 func NewCryptor(opts ...CryptorOpts) Cryptor {
 	c := &cryptor{
-		r:      rand.Reader,
-		hasher: sha256.New(),
+		r:       rand.Reader,
+		hasher:  sha256.New(),
+		version: ENVELOPE_V2,
 	}
 
 	for _, opt := range opts {
@@ -99,6 +229,39 @@ func NewSigner(opts ...SignerOpts) Signer {
 	return c
 }
 func (s *signer) Sign(myPrivate []byte, msg []byte) ([]byte, error) {
+	switch key.PrivateKeyType(myPrivate) {
+	case key.RSA_PRIVATE_KEY:
+		return s.signRSA(myPrivate, msg)
+	case key.ED25519_PRIVATE_KEY:
+		privateKey, err := key.ParseEd25519PrivateKey(myPrivate)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.Sign(privateKey, msg), nil
+	default:
+		return nil, UnsupportedKeyTypeError
+	}
+}
+
+func (s *signer) Verify(otherPublic []byte, msg []byte, signature []byte) (bool, error) {
+	switch key.PublicKeyType(otherPublic) {
+	case key.RSA_PUBLIC_KEY:
+		return s.verifyRSA(otherPublic, msg, signature)
+	case key.ED25519_PUBLIC_KEY:
+		publicKey, err := key.ParseEd25519PublicKey(otherPublic)
+		if err != nil {
+			return false, err
+		}
+		if !ed25519.Verify(publicKey, msg, signature) {
+			return false, InvalidSignatureError
+		}
+		return true, nil
+	default:
+		return false, UnsupportedKeyTypeError
+	}
+}
+
+func (s *signer) signRSA(myPrivate []byte, msg []byte) ([]byte, error) {
 	privateKey, err := x509.ParsePKCS1PrivateKey(myPrivate)
 	if err != nil {
 		return nil, err
@@ -114,7 +277,7 @@ func (s *signer) Sign(myPrivate []byte, msg []byte) ([]byte, error) {
 	return signature, nil
 }
 
-func (s *signer) Verify(otherPublic []byte, msg []byte, signature []byte) (bool, error) {
+func (s *signer) verifyRSA(otherPublic []byte, msg []byte, signature []byte) (bool, error) {
 	publicKey, err := x509.ParsePKCS1PublicKey(otherPublic)
 	if err != nil {
 		return false, err
@@ -1,6 +1,7 @@
 package cryptography
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rand"
 	"crypto/sha1"
@@ -8,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/curve25519"
 )
 
 func TestEncryptMessage(t *testing.T) {
@@ -93,3 +95,151 @@ func TestSignMessage(t *testing.T) {
 
 	assert.NotNil(t, encryptedMsg, "encryption failed")
 }
+
+func TestEnvelopeVersions(t *testing.T) {
+	pair, err := key.NewKeyPair(2048)
+	assert.Nil(t, err, "could not generate pair keys")
+
+	longMsg := bytes.Repeat([]byte("TIRAICHBADFTHR"), 500)
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "hybrid envelope encrypts messages longer than one rsa block",
+			f: func(t *testing.T) {
+				cryptor := NewCryptor()
+				encryptedMsg, err := cryptor.Encrypt(pair.PublicKey(), longMsg)
+				assert.Nil(t, err, "could not encrypt long message")
+				assert.Equal(t, byte(ENVELOPE_V2), encryptedMsg[0], "envelope must be versioned")
+
+				decryptedMsg, err := cryptor.Decrypt(pair.PrivateKey(), encryptedMsg)
+				assert.Nil(t, err, "could not decrypt long message")
+				assert.Equal(t, longMsg, decryptedMsg, "both messages must be equal")
+			},
+		},
+		{
+			name: "v1 messages still decrypt",
+			f: func(t *testing.T) {
+				legacy := NewCryptor(WithEnvelopeVersion(ENVELOPE_V1))
+				encryptedMsg, err := legacy.Encrypt(pair.PublicKey(), []byte("TIRAICHBADFTHR"))
+				assert.Nil(t, err, "could not encrypt v1 message")
+
+				decryptedMsg, err := NewCryptor().Decrypt(pair.PrivateKey(), encryptedMsg)
+				assert.Nil(t, err, "could not decrypt v1 message")
+				assert.Equal(t, []byte("TIRAICHBADFTHR"), decryptedMsg, "both messages must be equal")
+			},
+		},
+		{
+			name: "tampered envelope is rejected",
+			f: func(t *testing.T) {
+				cryptor := NewCryptor()
+				encryptedMsg, err := cryptor.Encrypt(pair.PublicKey(), []byte("TIRAICHBADFTHR"))
+				assert.Nil(t, err, "could not encrypt message")
+
+				encryptedMsg[len(encryptedMsg)-1] ^= 0xff
+				_, err = cryptor.Decrypt(pair.PrivateKey(), encryptedMsg)
+				assert.NotNil(t, err, "decryption must fail")
+			},
+		},
+		{
+			name: "unknown envelope version is rejected",
+			f: func(t *testing.T) {
+				_, err := NewCryptor().Decrypt(pair.PrivateKey(), []byte{0x7f, 0x00, 0x01})
+				assert.Equal(t, UnknownEnvelopeVersionError, err)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
+
+func TestKeyTypes(t *testing.T) {
+	rsaPair, err := key.NewKeyPair(2048)
+	assert.Nil(t, err, "could not generate pair keys")
+	edPair, err := key.NewEd25519KeyPair()
+	assert.Nil(t, err, "could not generate pair keys")
+	xPair, err := key.NewX25519KeyPair()
+	assert.Nil(t, err, "could not generate pair keys")
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "ed25519 sign and verify",
+			f: func(t *testing.T) {
+				signer := NewSigner()
+				signature, err := signer.Sign(edPair.PrivateKey(), []byte("TIRAICHBADFTHR"))
+				assert.Nil(t, err, "could not sign message")
+
+				valid, err := signer.Verify(edPair.PublicKey(), []byte("TIRAICHBADFTHR"), signature)
+				assert.Nil(t, err, "error during verification")
+				assert.True(t, valid, "verification failed")
+
+				valid, err = signer.Verify(edPair.PublicKey(), []byte("TIRAICHBADFTHR DEVE FALHAR"), signature)
+				assert.Equal(t, InvalidSignatureError, err)
+				assert.False(t, valid, "verification must fail")
+			},
+		},
+		{
+			name: "x25519 keys can not sign",
+			f: func(t *testing.T) {
+				_, err := NewSigner().Sign(xPair.PrivateKey(), []byte("TIRAICHBADFTHR"))
+				assert.Equal(t, UnsupportedKeyTypeError, err)
+			},
+		},
+		{
+			name: "ed25519 key maps onto its x25519 point",
+			f: func(t *testing.T) {
+				publicKey, err := key.ParseEd25519PublicKey(edPair.PublicKey())
+				assert.Nil(t, err, "could not parse public key")
+				privateKey, err := key.ParseEd25519PrivateKey(edPair.PrivateKey())
+				assert.Nil(t, err, "could not parse private key")
+
+				curvePublic, err := ed25519PublicToX25519(publicKey)
+				assert.Nil(t, err, "could not convert public key")
+				derived, err := curve25519.X25519(ed25519PrivateToX25519(privateKey), curve25519.Basepoint)
+				assert.Nil(t, err, "could not derive public key")
+				assert.Equal(t, curvePublic, derived, "both points must be equal")
+			},
+		},
+		{
+			name: "encrypt to every key type",
+			f: func(t *testing.T) {
+				msg := bytes.Repeat([]byte("TIRAICHBADFTHR"), 100)
+				for _, pair := range []key.KeyPair{rsaPair, edPair, xPair} {
+					cryptor := NewCryptor()
+					encryptedMsg, err := cryptor.Encrypt(pair.PublicKey(), msg)
+					assert.Nil(t, err, "could not encrypt message")
+
+					decryptedMsg, err := cryptor.Decrypt(pair.PrivateKey(), encryptedMsg)
+					assert.Nil(t, err, "could not decrypt message")
+					assert.Equal(t, msg, decryptedMsg, "both messages must be equal")
+				}
+			},
+		},
+		{
+			name: "curve envelope for someone else does not open",
+			f: func(t *testing.T) {
+				cryptor := NewCryptor()
+				encryptedMsg, err := cryptor.Encrypt(edPair.PublicKey(), []byte("TIRAICHBADFTHR"))
+				assert.Nil(t, err, "could not encrypt message")
+
+				_, err = cryptor.Decrypt(xPair.PrivateKey(), encryptedMsg)
+				assert.NotNil(t, err, "decryption must fail")
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
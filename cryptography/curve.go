@@ -0,0 +1,187 @@
+package cryptography
+
+import (
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io"
+	"math/big"
+	"pogchat/key"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const curveEnvelopeInfo = "POGCHAT_ENVELOPE_V3"
+
+var curvePrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// sealX25519 builds a v3 envelope laid out as
+// version | ephemeral public key | nonce | ciphertext
+func (e *cryptor) sealX25519(publicKey []byte, msg []byte) ([]byte, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	_, err := io.ReadFull(e.r, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralPublic, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := curve25519.X25519(ephemeral, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newCurveAEAD(shared, ephemeralPublic, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, 1+len(ephemeralPublic)+aead.NonceSize())
+	header = append(header, byte(ENVELOPE_V3))
+	header = append(header, ephemeralPublic...)
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(e.r, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := append(header, nonce...)
+	return aead.Seal(envelope, nonce, msg, header), nil
+}
+
+func (e *cryptor) openX25519(privateKey []byte, envelope []byte) ([]byte, error) {
+	headerLen := 1 + curve25519.PointSize
+	if len(envelope) < headerLen {
+		return nil, MalformedEnvelopeError
+	}
+
+	if EnvelopeVersion(envelope[0]) != ENVELOPE_V3 {
+		return nil, UnknownEnvelopeVersionError
+	}
+
+	header := envelope[:headerLen]
+	ephemeralPublic := header[1:]
+
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := curve25519.X25519(privateKey, ephemeralPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newCurveAEAD(shared, ephemeralPublic, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	body := envelope[headerLen:]
+	if len(body) < aead.NonceSize()+aead.Overhead() {
+		return nil, MalformedEnvelopeError
+	}
+
+	return aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], header)
+}
+
+func newCurveAEAD(shared []byte, ephemeralPublic []byte, recipientPublic []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeralPublic...), recipientPublic...)
+
+	contentKey := make([]byte, contentKeySize)
+	_, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(curveEnvelopeInfo)), contentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGCM(contentKey)
+}
+
+// ed25519PublicToX25519 maps an Edwards point onto the birationally
+// equivalent Montgomery u coordinate, u = (1 + y) / (1 - y) mod p
+func ed25519PublicToX25519(publicKey ed25519.PublicKey) ([]byte, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, InvalidCurvePointError
+	}
+
+	le := make([]byte, len(publicKey))
+	copy(le, publicKey)
+	le[len(le)-1] &= 0x7f
+
+	y := new(big.Int).SetBytes(reverse(le))
+	if y.Cmp(curvePrime) >= 0 {
+		return nil, InvalidCurvePointError
+	}
+
+	one := big.NewInt(1)
+	num := new(big.Int).Add(one, y)
+	den := new(big.Int).Sub(one, y)
+	den.Mod(den, curvePrime)
+	if den.Sign() == 0 {
+		return nil, InvalidCurvePointError
+	}
+
+	u := num.Mul(num, den.ModInverse(den, curvePrime))
+	u.Mod(u, curvePrime)
+
+	out := make([]byte, curve25519.PointSize)
+	return reverse(u.FillBytes(out)), nil
+}
+
+// ed25519PrivateToX25519 derives the X25519 scalar the same way Ed25519
+// derives its signing scalar so both keys share one public point
+func ed25519PrivateToX25519(privateKey ed25519.PrivateKey) []byte {
+	h := sha512.Sum512(privateKey.Seed())
+	scalar := h[:curve25519.ScalarSize]
+	scalar[0] &= 248
+	scalar[31] &= 127
+	scalar[31] |= 64
+	return scalar
+}
+
+func reverse(b []byte) []byte {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
+
+// CurvePublicKey returns the X25519 point behind an X25519 or Ed25519
+// public key, RSA keys can not take part in a key agreement
+func CurvePublicKey(publicKey []byte) ([]byte, error) {
+	switch key.PublicKeyType(publicKey) {
+	case key.X25519_PUBLIC_KEY:
+		return key.ParseX25519PublicKey(publicKey)
+	case key.ED25519_PUBLIC_KEY:
+		edPublic, err := key.ParseEd25519PublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519PublicToX25519(edPublic)
+	default:
+		return nil, UnsupportedKeyTypeError
+	}
+}
+
+// CurvePrivateKey returns the X25519 scalar behind an X25519 or Ed25519
+// private key
+func CurvePrivateKey(privateKey []byte) ([]byte, error) {
+	switch key.PrivateKeyType(privateKey) {
+	case key.X25519_PRIVATE_KEY:
+		return key.ParseX25519PrivateKey(privateKey)
+	case key.ED25519_PRIVATE_KEY:
+		edPrivate, err := key.ParseEd25519PrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519PrivateToX25519(edPrivate), nil
+	default:
+		return nil, UnsupportedKeyTypeError
+	}
+}
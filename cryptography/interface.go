@@ -1,5 +1,28 @@
 package cryptography
 
+import "errors"
+
+var (
+	UnknownEnvelopeVersionError = errors.New("unknown envelope version")
+	MalformedEnvelopeError      = errors.New("malformed envelope")
+	UnsupportedKeyTypeError     = errors.New("key type not supported by this operation")
+	InvalidSignatureError       = errors.New("invalid signature")
+	InvalidCurvePointError      = errors.New("public key is not a valid curve point")
+)
+
+type EnvelopeVersion byte
+
+const (
+	// ENVELOPE_V1 is the plaintext encrypted straight with RSA-OAEP, it has
+	// no header and is only recognised by its length
+	ENVELOPE_V1 EnvelopeVersion = iota + 1
+	// ENVELOPE_V2 wraps a random AES-256-GCM content key with RSA-OAEP
+	ENVELOPE_V2
+	// ENVELOPE_V3 derives the AES-256-GCM key from an ephemeral X25519
+	// exchange with the recipient, used for X25519 and Ed25519 keys
+	ENVELOPE_V3
+)
+
 type Encryptor interface {
 	Encrypt(otherPublic []byte, msg []byte) ([]byte, error)
 }
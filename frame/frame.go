@@ -0,0 +1,84 @@
+package frame
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// framer delimits messages on a stream with a 4 byte big endian length
+// prefix so that every payload written with WriteFrame is returned whole
+// and exactly once by ReadFrame, no matter how the stream splits it
+type framer struct {
+	maxFrameSize uint32
+}
+
+var _ Framer = (*framer)(nil)
+
+func (f *framer) MaxFrameSize() uint32 {
+	return f.maxFrameSize
+}
+
+func (f *framer) ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, HEADER_SIZE)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	if length == 0 {
+		return nil, EmptyFrameError
+	}
+
+	if length > f.maxFrameSize {
+		return nil, FrameTooLargeError
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (f *framer) WriteFrame(w io.Writer, payload []byte) error {
+	if len(payload) == 0 {
+		return EmptyFrameError
+	}
+
+	if uint64(len(payload)) > uint64(f.maxFrameSize) {
+		return FrameTooLargeError
+	}
+
+	// header and payload go out in a single write so concurrent writers
+	// guarded by the caller never interleave a frame
+	buf := make([]byte, HEADER_SIZE+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[HEADER_SIZE:], payload)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func WithMaxFrameSize(size uint32) FramerOpts {
+	return func(f *framer) {
+		f.maxFrameSize = size
+	}
+}
+
+func NewFramer(opts ...FramerOpts) Framer {
+	f := &framer{
+		maxFrameSize: DEFAULT_MAX_FRAME_SIZE,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
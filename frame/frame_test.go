@@ -0,0 +1,96 @@
+package frame
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFramer(t *testing.T) {
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "round trip message bigger than old read buffer",
+			f: func(t *testing.T) {
+				f := NewFramer()
+				msg := bytes.Repeat([]byte("TIRAICHBADFTHR"), 1000)
+				buf := &bytes.Buffer{}
+				err := f.WriteFrame(buf, msg)
+				assert.Nil(t, err, "could not write frame")
+
+				payload, err := f.ReadFrame(buf)
+				assert.Nil(t, err, "could not read frame")
+				assert.Equal(t, msg, payload, "payload must be equal")
+			},
+		},
+		{
+			name: "coalesced frames are read one at a time",
+			f: func(t *testing.T) {
+				f := NewFramer()
+				buf := &bytes.Buffer{}
+				assert.Nil(t, f.WriteFrame(buf, []byte("first")))
+				assert.Nil(t, f.WriteFrame(buf, []byte("second")))
+
+				first, err := f.ReadFrame(buf)
+				assert.Nil(t, err, "could not read first frame")
+				assert.Equal(t, []byte("first"), first)
+
+				second, err := f.ReadFrame(buf)
+				assert.Nil(t, err, "could not read second frame")
+				assert.Equal(t, []byte("second"), second)
+
+				_, err = f.ReadFrame(buf)
+				assert.Equal(t, io.EOF, err, "stream must be drained")
+			},
+		},
+		{
+			name: "split frames are reassembled",
+			f: func(t *testing.T) {
+				f := NewFramer()
+				buf := &bytes.Buffer{}
+				assert.Nil(t, f.WriteFrame(buf, []byte("TIRAICHBADFTHR")))
+
+				payload, err := f.ReadFrame(iotest.OneByteReader(buf))
+				assert.Nil(t, err, "could not read split frame")
+				assert.Equal(t, []byte("TIRAICHBADFTHR"), payload)
+			},
+		},
+		{
+			name: "frames over max size are rejected",
+			f: func(t *testing.T) {
+				f := NewFramer(WithMaxFrameSize(4))
+				buf := &bytes.Buffer{}
+				err := f.WriteFrame(buf, []byte("TIRAICHBADFTHR"))
+				assert.Equal(t, FrameTooLargeError, err)
+
+				big := NewFramer()
+				assert.Nil(t, big.WriteFrame(buf, []byte("TIRAICHBADFTHR")))
+				_, err = f.ReadFrame(buf)
+				assert.Equal(t, FrameTooLargeError, err)
+			},
+		},
+		{
+			name: "truncated frame returns unexpected eof",
+			f: func(t *testing.T) {
+				f := NewFramer()
+				buf := &bytes.Buffer{}
+				assert.Nil(t, f.WriteFrame(buf, []byte("TIRAICHBADFTHR")))
+				buf.Truncate(buf.Len() - 2)
+
+				_, err := f.ReadFrame(buf)
+				assert.Equal(t, io.ErrUnexpectedEOF, err)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package frame
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	FrameTooLargeError = errors.New("frame exceeds max frame size")
+	EmptyFrameError    = errors.New("frame has no payload")
+)
+
+const (
+	HEADER_SIZE            = 4
+	DEFAULT_MAX_FRAME_SIZE = 1 << 20
+)
+
+type FrameReader interface {
+	ReadFrame(r io.Reader) ([]byte, error)
+}
+
+type FrameWriter interface {
+	WriteFrame(w io.Writer, payload []byte) error
+}
+
+type Framer interface {
+	FrameReader
+	FrameWriter
+	MaxFrameSize() uint32
+}
+
+type FramerOpts func(*framer)
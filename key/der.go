@@ -0,0 +1,183 @@
+package key
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+// RSA keys travel as PKCS#1 while Ed25519 and X25519 keys travel as PKIX
+// and PKCS#8, every encoding names its algorithm so the raw bytes alone are
+// enough to pick the right primitive
+
+const X25519_KEY_SIZE = 32
+
+var (
+	oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidX25519  = asn1.ObjectIdentifier{1, 3, 101, 110}
+)
+
+type publicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type privateKeyInfo struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// PublicKeyType tells which algorithm an encoded public key belongs to,
+// NOT_IMPLEMENTED_KEY is returned for anything else
+func PublicKeyType(der []byte) KeyType {
+	if _, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return RSA_PUBLIC_KEY
+	}
+
+	info := &publicKeyInfo{}
+	rest, err := asn1.Unmarshal(der, info)
+	if err != nil || len(rest) != 0 {
+		return NOT_IMPLEMENTED_KEY
+	}
+
+	switch {
+	case info.Algorithm.Algorithm.Equal(oidEd25519):
+		return ED25519_PUBLIC_KEY
+	case info.Algorithm.Algorithm.Equal(oidX25519):
+		return X25519_PUBLIC_KEY
+	default:
+		return NOT_IMPLEMENTED_KEY
+	}
+}
+
+// PrivateKeyType tells which algorithm an encoded private key belongs to,
+// NOT_IMPLEMENTED_KEY is returned for anything else
+func PrivateKeyType(der []byte) KeyType {
+	if _, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return RSA_PRIVATE_KEY
+	}
+
+	info := &privateKeyInfo{}
+	rest, err := asn1.Unmarshal(der, info)
+	if err != nil || len(rest) != 0 {
+		return NOT_IMPLEMENTED_KEY
+	}
+
+	switch {
+	case info.Algorithm.Algorithm.Equal(oidEd25519):
+		return ED25519_PRIVATE_KEY
+	case info.Algorithm.Algorithm.Equal(oidX25519):
+		return X25519_PRIVATE_KEY
+	default:
+		return NOT_IMPLEMENTED_KEY
+	}
+}
+
+func MarshalEd25519PublicKey(pub ed25519.PublicKey) ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(pub)
+}
+
+func ParseEd25519PublicKey(der []byte) (ed25519.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, UnsupportedKeyTypeError
+	}
+
+	return key, nil
+}
+
+func MarshalEd25519PrivateKey(priv ed25519.PrivateKey) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(priv)
+}
+
+func ParseEd25519PrivateKey(der []byte) (ed25519.PrivateKey, error) {
+	priv, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := priv.(ed25519.PrivateKey)
+	if !ok {
+		return nil, UnsupportedKeyTypeError
+	}
+
+	return key, nil
+}
+
+func MarshalX25519PublicKey(pub []byte) ([]byte, error) {
+	if len(pub) != X25519_KEY_SIZE {
+		return nil, MalformedKeyError
+	}
+
+	return asn1.Marshal(publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidX25519},
+		PublicKey: asn1.BitString{Bytes: pub, BitLength: 8 * len(pub)},
+	})
+}
+
+func ParseX25519PublicKey(der []byte) ([]byte, error) {
+	info := &publicKeyInfo{}
+	rest, err := asn1.Unmarshal(der, info)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) != 0 || !info.Algorithm.Algorithm.Equal(oidX25519) {
+		return nil, UnsupportedKeyTypeError
+	}
+
+	if len(info.PublicKey.Bytes) != X25519_KEY_SIZE {
+		return nil, MalformedKeyError
+	}
+
+	return info.PublicKey.Bytes, nil
+}
+
+func MarshalX25519PrivateKey(priv []byte) ([]byte, error) {
+	if len(priv) != X25519_KEY_SIZE {
+		return nil, MalformedKeyError
+	}
+
+	// like Ed25519 in RFC 8410 the private key is wrapped in an OCTET STRING
+	// inside the PKCS#8 OCTET STRING
+	inner, err := asn1.Marshal(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(privateKeyInfo{
+		Algorithm:  pkix.AlgorithmIdentifier{Algorithm: oidX25519},
+		PrivateKey: inner,
+	})
+}
+
+func ParseX25519PrivateKey(der []byte) ([]byte, error) {
+	info := &privateKeyInfo{}
+	rest, err := asn1.Unmarshal(der, info)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) != 0 || !info.Algorithm.Algorithm.Equal(oidX25519) {
+		return nil, UnsupportedKeyTypeError
+	}
+
+	var priv []byte
+	rest, err = asn1.Unmarshal(info.PrivateKey, &priv)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) != 0 || len(priv) != X25519_KEY_SIZE {
+		return nil, MalformedKeyError
+	}
+
+	return priv, nil
+}
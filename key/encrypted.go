@@ -0,0 +1,274 @@
+package key
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted private keys are stored as a PEM block of type
+// ENCRYPTED_KEY_PEM_TYPE, the headers carry the format version, the wrapped
+// key type and the KDF parameters, all of them are authenticated together
+// with the ciphertext
+
+const (
+	ENCRYPTED_KEY_PEM_TYPE = "POGCHAT ENCRYPTED PRIVATE KEY"
+	ENCRYPTED_KEY_VERSION  = "1"
+
+	SCRYPT_N = 1 << 15
+	SCRYPT_R = 8
+	SCRYPT_P = 1
+
+	// the parameters are read back from the file before anything is
+	// authenticated, these caps keep a crafted header from making scrypt
+	// allocate gigabytes or run for hours, 128*N*r bytes is at most 256MiB
+	MAX_SCRYPT_N = 1 << 18
+	MAX_SCRYPT_R = 8
+	MAX_SCRYPT_P = 4
+
+	saltSize = 16
+)
+
+const (
+	headerVersion = "Version"
+	headerKeyType = "Key-Type"
+	headerKDF     = "KDF"
+	headerN       = "Scrypt-N"
+	headerR       = "Scrypt-R"
+	headerP       = "Scrypt-P"
+	headerSalt    = "Salt"
+	headerCipher  = "Cipher"
+	headerNonce   = "Nonce"
+)
+
+func encryptKey(kt KeyType, key []byte, passphrase []byte) (*pem.Block, error) {
+	if len(passphrase) == 0 {
+		return nil, PassphraseRequiredError
+	}
+
+	salt := make([]byte, saltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		headerVersion: ENCRYPTED_KEY_VERSION,
+		headerKeyType: kt.String(),
+		headerKDF:     "scrypt",
+		headerN:       strconv.Itoa(SCRYPT_N),
+		headerR:       strconv.Itoa(SCRYPT_R),
+		headerP:       strconv.Itoa(SCRYPT_P),
+		headerSalt:    base64.StdEncoding.EncodeToString(salt),
+		headerCipher:  "AES-256-GCM",
+	}
+
+	aead, err := keyAEAD(passphrase, salt, SCRYPT_N, SCRYPT_R, SCRYPT_P)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	headers[headerNonce] = base64.StdEncoding.EncodeToString(nonce)
+
+	return &pem.Block{
+		Type:    ENCRYPTED_KEY_PEM_TYPE,
+		Headers: headers,
+		Bytes:   aead.Seal(nil, nonce, key, authenticatedHeaders(headers)),
+	}, nil
+}
+
+func decryptKey(blk *pem.Block, passphrase []byte) (KeyType, []byte, error) {
+	if len(passphrase) == 0 {
+		return NOT_IMPLEMENTED_KEY, nil, PassphraseRequiredError
+	}
+
+	h := blk.Headers
+	if h[headerVersion] != ENCRYPTED_KEY_VERSION {
+		return NOT_IMPLEMENTED_KEY, nil, UnsupportedEncryptedKeyError
+	}
+
+	if h[headerKDF] != "scrypt" || h[headerCipher] != "AES-256-GCM" {
+		return NOT_IMPLEMENTED_KEY, nil, UnsupportedEncryptedKeyError
+	}
+
+	kt, err := blockKeyType(privateKeyTypes, &pem.Block{Type: h[headerKeyType]})
+	if err != nil {
+		return NOT_IMPLEMENTED_KEY, nil, err
+	}
+
+	n, errN := strconv.Atoi(h[headerN])
+	r, errR := strconv.Atoi(h[headerR])
+	p, errP := strconv.Atoi(h[headerP])
+	salt, errSalt := base64.StdEncoding.DecodeString(h[headerSalt])
+	nonce, errNonce := base64.StdEncoding.DecodeString(h[headerNonce])
+	for _, err := range []error{errN, errR, errP, errSalt, errNonce} {
+		if err != nil {
+			return NOT_IMPLEMENTED_KEY, nil, ParsePemError
+		}
+	}
+
+	// scrypt divides by p and needs N to be a power of two, a corrupt file
+	// must come back as an error and not a panic
+	if n < 2 || n&(n-1) != 0 || r < 1 || p < 1 {
+		return NOT_IMPLEMENTED_KEY, nil, UnsupportedEncryptedKeyError
+	}
+	if n > MAX_SCRYPT_N || r > MAX_SCRYPT_R || p > MAX_SCRYPT_P {
+		return NOT_IMPLEMENTED_KEY, nil, UnsupportedEncryptedKeyError
+	}
+
+	aead, err := keyAEAD(passphrase, salt, n, r, p)
+	if err != nil {
+		return NOT_IMPLEMENTED_KEY, nil, err
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return NOT_IMPLEMENTED_KEY, nil, ParsePemError
+	}
+
+	key, err := aead.Open(nil, nonce, blk.Bytes, authenticatedHeaders(h))
+	if err != nil {
+		return NOT_IMPLEMENTED_KEY, nil, WrongPassphraseError
+	}
+
+	return kt, key, nil
+}
+
+func keyAEAD(passphrase []byte, salt []byte, n int, r int, p int) (cipher.AEAD, error) {
+	derived, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// authenticatedHeaders encodes every header but the nonce in a fixed order
+// so none of them can be swapped without breaking decryption
+func authenticatedHeaders(headers map[string]string) []byte {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if name == headerNonce {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(ENCRYPTED_KEY_PEM_TYPE)
+	for _, name := range names {
+		b.WriteString("\n" + name + ": " + headers[name])
+	}
+	return []byte(b.String())
+}
+
+func (p *keyPair) StoreEncryptedPrivateKey(fileName string, passphrase []byte) error {
+	blk, err := encryptKey(p.privateKeyType, p.privateKey, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return writePem(blk, fileName)
+}
+
+// ChangePassphrase re-encrypts a private key file under a new passphrase,
+// a plain private key file can be protected by passing an empty old
+// passphrase
+func ChangePassphrase(fileName string, oldPassphrase []byte, newPassphrase []byte) error {
+	blk, err := readPem(fileName)
+	if err != nil {
+		return err
+	}
+
+	var kt KeyType
+	var key []byte
+	if blk.Type == ENCRYPTED_KEY_PEM_TYPE {
+		kt, key, err = decryptKey(blk, oldPassphrase)
+		if err != nil {
+			return err
+		}
+	} else {
+		kt, err = blockKeyType(privateKeyTypes, blk)
+		if err != nil {
+			return err
+		}
+		key = blk.Bytes
+	}
+
+	encrypted, err := encryptKey(kt, key, newPassphrase)
+	if err != nil {
+		return err
+	}
+
+	// write next to the old file and swap so a failure never loses the key
+	tmp := fileName + ".tmp"
+	err = writePem(encrypted, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, fileName)
+}
+
+func IsEncryptedPrivateKey(fileName string) (bool, error) {
+	blk, err := readPem(fileName)
+	if err != nil {
+		return false, err
+	}
+	return blk.Type == ENCRYPTED_KEY_PEM_TYPE, nil
+}
+
+func readPem(fileName string) (*pem.Block, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, CreateFileError
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, ReadFileError
+	}
+
+	blk, _ := pem.Decode(b)
+	if blk == nil {
+		return nil, ParsePemError
+	}
+
+	return blk, nil
+}
+
+func writePem(blk *pem.Block, fileName string) error {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return CreateFileError
+	}
+	defer file.Close()
+
+	err = pem.Encode(file, blk)
+	if err != nil {
+		return EncodePemFileError
+	}
+
+	return nil
+}
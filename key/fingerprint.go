@@ -0,0 +1,85 @@
+package key
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	FINGERPRINT_VERSION = 0
+
+	// SAFETY_NUMBER_ITERATIONS makes brute forcing a key with a colliding
+	// safety number expensive, the value matches what Signal uses
+	SAFETY_NUMBER_ITERATIONS = 5200
+
+	// SHORT_FINGERPRINT_GROUPS is how many groups of the fingerprint are
+	// used when a key only needs a label
+	SHORT_FINGERPRINT_GROUPS = 4
+)
+
+// Fingerprint hashes a public key, the full 32 bytes are what should be
+// compared, FormatFingerprint renders them for humans
+func Fingerprint(publicKey []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("POGCHAT_FINGERPRINT"))
+	h.Write([]byte{FINGERPRINT_VERSION})
+	h.Write(publicKey)
+	return h.Sum(nil)
+}
+
+// FormatFingerprint renders a fingerprint as groups of four hex digits
+func FormatFingerprint(fingerprint []byte) string {
+	return group(hex.EncodeToString(fingerprint), 4)
+}
+
+// ShortFingerprint is a label for a public key, it is good enough to tell
+// contacts apart but not to verify them
+func ShortFingerprint(publicKey []byte) string {
+	return FormatFingerprint(Fingerprint(publicKey)[:SHORT_FINGERPRINT_GROUPS*2])
+}
+
+// SafetyNumber derives the number two parties compare out of band to make
+// sure nobody sits between them, both sides get the same number no matter
+// who computes it
+func SafetyNumber(publicKey []byte, peerPublicKey []byte) string {
+	a := safetyDigits(publicKey)
+	b := safetyDigits(peerPublicKey)
+	if bytes.Compare(publicKey, peerPublicKey) > 0 {
+		a, b = b, a
+	}
+	return group(a+b, 5)
+}
+
+// safetyDigits iterates a hash over the key and turns the first 30 bytes
+// into 30 decimal digits, five digits for every five bytes
+func safetyDigits(publicKey []byte) string {
+	h := sha512.Sum512(append([]byte{FINGERPRINT_VERSION}, publicKey...))
+	digest := h[:]
+	for i := 0; i < SAFETY_NUMBER_ITERATIONS; i++ {
+		h = sha512.Sum512(append(digest, publicKey...))
+		digest = h[:]
+	}
+
+	var digits strings.Builder
+	for i := 0; i < 30; i += 5 {
+		chunk := make([]byte, 8)
+		copy(chunk[3:], digest[i:i+5])
+		fmt.Fprintf(&digits, "%05d", binary.BigEndian.Uint64(chunk)%100000)
+	}
+	return digits.String()
+}
+
+func group(s string, size int) string {
+	groups := make([]string, 0, len(s)/size+1)
+	for len(s) > size {
+		groups = append(groups, s[:size])
+		s = s[size:]
+	}
+	groups = append(groups, s)
+	return strings.Join(groups, " ")
+}
@@ -8,6 +8,12 @@ var (
 	ReadFileError            = errors.New("read file returned error")
 	ParsePemError            = errors.New("could not parse pem key from file")
 	DiffKeyTypesLoadingError = errors.New("wrong key types during load")
+	UnsupportedKeyTypeError  = errors.New("unsupported key type")
+	MalformedKeyError        = errors.New("malformed key")
+
+	PassphraseRequiredError      = errors.New("private key is encrypted and no passphrase was given")
+	WrongPassphraseError         = errors.New("wrong passphrase or corrupted private key")
+	UnsupportedEncryptedKeyError = errors.New("unsupported encrypted private key format")
 )
 
 type KeyType int
@@ -15,11 +21,19 @@ type KeyType int
 const (
 	RSA_PRIVATE_KEY KeyType = iota
 	RSA_PUBLIC_KEY
+	ED25519_PRIVATE_KEY
+	ED25519_PUBLIC_KEY
+	X25519_PRIVATE_KEY
+	X25519_PUBLIC_KEY
 	NOT_IMPLEMENTED_KEY
 )
 
 type KeyPairOpts func(*keyPair) error
 
+// PassphrasePrompt returns the passphrase protecting the given private key
+// file, it is only called when the file is actually encrypted
+type PassphrasePrompt func(fileName string) ([]byte, error)
+
 type KeyPairLoader interface {
 	LoadPrivateKey(fileName string) error
 	LoadPublicKey(fileName string) error
@@ -28,6 +42,7 @@ type KeyPairLoader interface {
 type KeyPairSerializer interface {
 	StorePrivateKey(fileName string) error
 	StorePublicKey(fileName string) error
+	StoreEncryptedPrivateKey(fileName string, passphrase []byte) error
 }
 
 type KeyPair interface {
@@ -35,6 +50,8 @@ type KeyPair interface {
 	KeyPairSerializer
 	PrivateKey() []byte
 	PublicKey() []byte
+	PrivateKeyType() KeyType
+	PublicKeyType() KeyType
 }
 
 type KeyPairFactory interface {
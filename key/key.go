@@ -1,19 +1,30 @@
 package key
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
-	"io/ioutil"
 	"os"
+
+	"golang.org/x/crypto/curve25519"
 )
 
 var keyType = map[KeyType]string{
-	RSA_PRIVATE_KEY: "RSA PRIVATE KEY",
-	RSA_PUBLIC_KEY:  "RSA PUBLIC KEY",
+	RSA_PRIVATE_KEY:     "RSA PRIVATE KEY",
+	RSA_PUBLIC_KEY:      "RSA PUBLIC KEY",
+	ED25519_PRIVATE_KEY: "ED25519 PRIVATE KEY",
+	ED25519_PUBLIC_KEY:  "ED25519 PUBLIC KEY",
+	X25519_PRIVATE_KEY:  "X25519 PRIVATE KEY",
+	X25519_PUBLIC_KEY:   "X25519 PUBLIC KEY",
 }
 
+var (
+	privateKeyTypes = []KeyType{RSA_PRIVATE_KEY, ED25519_PRIVATE_KEY, X25519_PRIVATE_KEY}
+	publicKeyTypes  = []KeyType{RSA_PUBLIC_KEY, ED25519_PUBLIC_KEY, X25519_PUBLIC_KEY}
+)
+
 func (kt KeyType) String() string {
 	k, ok := keyType[kt]
 	if !ok {
@@ -23,8 +34,11 @@ func (kt KeyType) String() string {
 }
 
 type keyPair struct {
-	publicKey  []byte
-	privateKey []byte
+	publicKey      []byte
+	privateKey     []byte
+	publicKeyType  KeyType
+	privateKeyType KeyType
+	passphrase     PassphrasePrompt
 }
 
 func (p *keyPair) PublicKey() []byte {
@@ -35,49 +49,90 @@ func (p *keyPair) PrivateKey() []byte {
 	return p.privateKey
 }
 
+func (p *keyPair) PublicKeyType() KeyType {
+	return p.publicKeyType
+}
+
+func (p *keyPair) PrivateKeyType() KeyType {
+	return p.privateKeyType
+}
+
 func (p *keyPair) LoadPrivateKey(fileName string) error {
-	blk, err := loadKey(RSA_PRIVATE_KEY, fileName)
+	blk, err := readPem(fileName)
+	if err != nil {
+		return err
+	}
+
+	if blk.Type == ENCRYPTED_KEY_PEM_TYPE {
+		return p.loadEncryptedPrivateKey(blk, fileName)
+	}
+
+	kt, err := blockKeyType(privateKeyTypes, blk)
 	if err != nil {
 		return err
 	}
 
 	p.privateKey = blk.Bytes
+	p.privateKeyType = kt
+
+	return nil
+}
+
+func (p *keyPair) loadEncryptedPrivateKey(blk *pem.Block, fileName string) error {
+	if p.passphrase == nil {
+		return PassphraseRequiredError
+	}
+
+	passphrase, err := p.passphrase(fileName)
+	if err != nil {
+		return err
+	}
+
+	kt, key, err := decryptKey(blk, passphrase)
+	if err != nil {
+		return err
+	}
+
+	p.privateKey = key
+	p.privateKeyType = kt
 
 	return nil
 }
 
 func (p *keyPair) LoadPublicKey(fileName string) error {
-	blk, err := loadKey(RSA_PUBLIC_KEY, fileName)
+	blk, kt, err := loadKey(publicKeyTypes, fileName)
 	if err != nil {
 		return err
 	}
 
 	p.publicKey = blk.Bytes
+	p.publicKeyType = kt
 
 	return nil
 }
 
-func loadKey(kt KeyType, fileName string) (*pem.Block, error) {
-	file, err := os.Open(fileName)
+func loadKey(allowed []KeyType, fileName string) (*pem.Block, KeyType, error) {
+	blk, err := readPem(fileName)
 	if err != nil {
-		return nil, CreateFileError
+		return nil, NOT_IMPLEMENTED_KEY, err
 	}
 
-	privateKey, err := ioutil.ReadAll(file)
+	kt, err := blockKeyType(allowed, blk)
 	if err != nil {
-		return nil, ReadFileError
+		return nil, NOT_IMPLEMENTED_KEY, err
 	}
 
-	blk, _ := pem.Decode(privateKey)
-	if blk == nil {
-		return nil, ParsePemError
-	}
+	return blk, kt, nil
+}
 
-	if keyType[kt] != blk.Type {
-		return nil, DiffKeyTypesLoadingError
+func blockKeyType(allowed []KeyType, blk *pem.Block) (KeyType, error) {
+	for _, kt := range allowed {
+		if keyType[kt] == blk.Type {
+			return kt, nil
+		}
 	}
 
-	return blk, nil
+	return NOT_IMPLEMENTED_KEY, DiffKeyTypesLoadingError
 }
 
 func storeKey(keyType KeyType, key []byte, fileName string) error {
@@ -100,15 +155,18 @@ func storeKey(keyType KeyType, key []byte, fileName string) error {
 }
 
 func (p *keyPair) StorePrivateKey(fileName string) error {
-	return storeKey(RSA_PRIVATE_KEY, p.privateKey, fileName)
+	return storeKey(p.privateKeyType, p.privateKey, fileName)
 }
 
 func (p *keyPair) StorePublicKey(fileName string) error {
-	return storeKey(RSA_PUBLIC_KEY, p.publicKey, fileName)
+	return storeKey(p.publicKeyType, p.publicKey, fileName)
 }
 
 func LoadKeyPair(opts ...KeyPairOpts) (KeyPair, error) {
-	pair := &keyPair{}
+	pair := &keyPair{
+		publicKeyType:  NOT_IMPLEMENTED_KEY,
+		privateKeyType: NOT_IMPLEMENTED_KEY,
+	}
 
 	for _, opt := range opts {
 		err := opt(pair)
@@ -127,7 +185,67 @@ func NewKeyPair(bitSize int) (KeyPair, error) {
 	}
 
 	return &keyPair{
-		privateKey: x509.MarshalPKCS1PrivateKey(key),
-		publicKey:  x509.MarshalPKCS1PublicKey(&key.PublicKey),
+		privateKey:     x509.MarshalPKCS1PrivateKey(key),
+		publicKey:      x509.MarshalPKCS1PublicKey(&key.PublicKey),
+		privateKeyType: RSA_PRIVATE_KEY,
+		publicKeyType:  RSA_PUBLIC_KEY,
+	}, nil
+}
+
+// NewEd25519KeyPair creates a signing identity, the same key can receive
+// messages since Cryptor maps it onto its X25519 counterpart
+func NewEd25519KeyPair() (KeyPair, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := MarshalEd25519PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	publicDER, err := MarshalEd25519PublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyPair{
+		privateKey:     privateDER,
+		publicKey:      publicDER,
+		privateKeyType: ED25519_PRIVATE_KEY,
+		publicKeyType:  ED25519_PUBLIC_KEY,
+	}, nil
+}
+
+// NewX25519KeyPair creates a key agreement only key pair, it can receive
+// messages but can not sign them
+func NewX25519KeyPair() (KeyPair, error) {
+	private := make([]byte, X25519_KEY_SIZE)
+	_, err := rand.Read(private)
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := MarshalX25519PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	publicDER, err := MarshalX25519PublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyPair{
+		privateKey:     privateDER,
+		publicKey:      publicDER,
+		privateKeyType: X25519_PRIVATE_KEY,
+		publicKeyType:  X25519_PUBLIC_KEY,
 	}, nil
 }
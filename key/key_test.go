@@ -3,6 +3,7 @@ package key
 import (
 	"github.com/stretchr/testify/assert"
 	"os"
+	"strconv"
 	"testing"
 )
 
@@ -78,6 +79,255 @@ func TestLoadKeys(t *testing.T) {
 	}
 }
 
+func TestKeyTypes(t *testing.T) {
+	test := []struct {
+		name        string
+		generate    func() (KeyPair, error)
+		privateType KeyType
+		publicType  KeyType
+	}{
+		{
+			name:        "rsa key pair",
+			generate:    func() (KeyPair, error) { return NewKeyPair(2048) },
+			privateType: RSA_PRIVATE_KEY,
+			publicType:  RSA_PUBLIC_KEY,
+		},
+		{
+			name:        "ed25519 key pair",
+			generate:    NewEd25519KeyPair,
+			privateType: ED25519_PRIVATE_KEY,
+			publicType:  ED25519_PUBLIC_KEY,
+		},
+		{
+			name:        "x25519 key pair",
+			generate:    NewX25519KeyPair,
+			privateType: X25519_PRIVATE_KEY,
+			publicType:  X25519_PUBLIC_KEY,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			pair, err := tt.generate()
+			assert.Nil(t, err, "could not generate pair keys")
+			assert.Equal(t, tt.privateType, PrivateKeyType(pair.PrivateKey()), "private key type must be detected")
+			assert.Equal(t, tt.publicType, PublicKeyType(pair.PublicKey()), "public key type must be detected")
+
+			dir := t.TempDir()
+			assert.Nil(t, pair.StorePrivateKey(dir+"/private.key"), "could not store private key")
+			assert.Nil(t, pair.StorePublicKey(dir+"/public.key"), "could not store public key")
+
+			loaded, err := LoadKeyPair(WithPrivateKey(dir+"/private.key"), WithPublicKey(dir+"/public.key"))
+			assert.Nil(t, err, "could not load key pair")
+			assert.Equal(t, pair.PrivateKey(), loaded.PrivateKey(), "private keys must be equal")
+			assert.Equal(t, pair.PublicKey(), loaded.PublicKey(), "public keys must be equal")
+			assert.Equal(t, tt.privateType, loaded.PrivateKeyType(), "private key type must survive a reload")
+			assert.Equal(t, tt.publicType, loaded.PublicKeyType(), "public key type must survive a reload")
+		})
+	}
+}
+
+func TestEncryptedPrivateKey(t *testing.T) {
+	pair, err := NewEd25519KeyPair()
+	assert.Nil(t, err, "could not generate pair keys")
+
+	dir := t.TempDir()
+	fileName := dir + "/private.key"
+	assert.Nil(t, pair.StoreEncryptedPrivateKey(fileName, []byte("hunter2")), "could not store encrypted private key")
+
+	// badParameter rewrites one KDF header, the file must be refused
+	// before scrypt ever sees the value
+	badParameter := func(header string, value int) func(*testing.T) {
+		return func(t *testing.T) {
+			blk, err := readPem(fileName)
+			assert.Nil(t, err, "could not read encrypted private key")
+			blk.Headers[header] = strconv.Itoa(value)
+			assert.Nil(t, writePem(blk, dir+"/bad_parameter.key"))
+
+			_, err = LoadKeyPair(WithPassphrase([]byte("hunter2")), WithPrivateKey(dir+"/bad_parameter.key"))
+			assert.Equal(t, UnsupportedEncryptedKeyError, err)
+		}
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "load with passphrase",
+			f: func(t *testing.T) {
+				loaded, err := LoadKeyPair(WithPassphrase([]byte("hunter2")), WithPrivateKey(fileName))
+				assert.Nil(t, err, "could not load encrypted private key")
+				assert.Equal(t, pair.PrivateKey(), loaded.PrivateKey(), "private keys must be equal")
+				assert.Equal(t, ED25519_PRIVATE_KEY, loaded.PrivateKeyType(), "private key type must survive encryption")
+			},
+		},
+		{
+			name: "load without passphrase",
+			f: func(t *testing.T) {
+				_, err := LoadKeyPair(WithPrivateKey(fileName))
+				assert.Equal(t, PassphraseRequiredError, err)
+			},
+		},
+		{
+			name: "load with wrong passphrase",
+			f: func(t *testing.T) {
+				_, err := LoadKeyPair(WithPassphrase([]byte("hunter3")), WithPrivateKey(fileName))
+				assert.Equal(t, WrongPassphraseError, err)
+			},
+		},
+		{
+			name: "prompt is only asked for encrypted keys",
+			f: func(t *testing.T) {
+				asked := 0
+				prompt := func(string) ([]byte, error) {
+					asked++
+					return []byte("hunter2"), nil
+				}
+
+				assert.Nil(t, pair.StorePrivateKey(dir+"/plain.key"), "could not store private key")
+				_, err := LoadKeyPair(WithPassphrasePrompt(prompt), WithPrivateKey(dir+"/plain.key"))
+				assert.Nil(t, err, "could not load plain private key")
+				assert.Equal(t, 0, asked, "plain key must not prompt")
+
+				_, err = LoadKeyPair(WithPassphrasePrompt(prompt), WithPrivateKey(fileName))
+				assert.Nil(t, err, "could not load encrypted private key")
+				assert.Equal(t, 1, asked, "encrypted key must prompt once")
+			},
+		},
+		{
+			name: "tampered headers are rejected",
+			f: func(t *testing.T) {
+				blk, err := readPem(fileName)
+				assert.Nil(t, err, "could not read encrypted private key")
+				blk.Headers[headerKeyType] = RSA_PRIVATE_KEY.String()
+				assert.Nil(t, writePem(blk, dir+"/tampered.key"))
+
+				_, err = LoadKeyPair(WithPassphrase([]byte("hunter2")), WithPrivateKey(dir+"/tampered.key"))
+				assert.Equal(t, WrongPassphraseError, err)
+			},
+		},
+		{
+			name: "scrypt N above the cap is rejected",
+			f:    badParameter(headerN, 1<<30),
+		},
+		{
+			name: "scrypt N below 2 is rejected",
+			f:    badParameter(headerN, 1),
+		},
+		{
+			name: "scrypt N of zero is rejected",
+			f:    badParameter(headerN, 0),
+		},
+		{
+			name: "scrypt N that is not a power of two is rejected",
+			f:    badParameter(headerN, 3<<10),
+		},
+		{
+			name: "scrypt r of zero is rejected",
+			f:    badParameter(headerR, 0),
+		},
+		{
+			name: "scrypt r above the cap is rejected",
+			f:    badParameter(headerR, 1<<10),
+		},
+		{
+			name: "scrypt p of zero is rejected",
+			f:    badParameter(headerP, 0),
+		},
+		{
+			name: "negative scrypt p is rejected",
+			f:    badParameter(headerP, -1),
+		},
+		{
+			name: "scrypt p above the cap is rejected",
+			f:    badParameter(headerP, 1<<10),
+		},
+		{
+			name: "change passphrase",
+			f: func(t *testing.T) {
+				assert.Equal(t, WrongPassphraseError, ChangePassphrase(fileName, []byte("hunter3"), []byte("swordfish")))
+				assert.Nil(t, ChangePassphrase(fileName, []byte("hunter2"), []byte("swordfish")), "could not change passphrase")
+
+				_, err := LoadKeyPair(WithPassphrase([]byte("hunter2")), WithPrivateKey(fileName))
+				assert.Equal(t, WrongPassphraseError, err, "old passphrase must stop working")
+
+				loaded, err := LoadKeyPair(WithPassphrase([]byte("swordfish")), WithPrivateKey(fileName))
+				assert.Nil(t, err, "could not load re-encrypted private key")
+				assert.Equal(t, pair.PrivateKey(), loaded.PrivateKey(), "private keys must be equal")
+			},
+		},
+		{
+			name: "protect a plain key",
+			f: func(t *testing.T) {
+				assert.Nil(t, pair.StorePrivateKey(dir+"/plain.key"), "could not store private key")
+				assert.Nil(t, ChangePassphrase(dir+"/plain.key", nil, []byte("hunter2")), "could not encrypt plain key")
+
+				encrypted, err := IsEncryptedPrivateKey(dir + "/plain.key")
+				assert.Nil(t, err)
+				assert.True(t, encrypted, "plain key must now be encrypted")
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	alice, err := NewEd25519KeyPair()
+	assert.Nil(t, err, "could not generate pair keys")
+	bob, err := NewKeyPair(2048)
+	assert.Nil(t, err, "could not generate pair keys")
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "fingerprint is stable and grouped",
+			f: func(t *testing.T) {
+				fp := FormatFingerprint(Fingerprint(alice.PublicKey()))
+				assert.Equal(t, fp, FormatFingerprint(Fingerprint(alice.PublicKey())), "fingerprint must be stable")
+				assert.Len(t, fp, 64+15, "fingerprint must be 16 groups of 4 hex digits")
+				assert.NotEqual(t, fp, FormatFingerprint(Fingerprint(bob.PublicKey())), "different keys must have different fingerprints")
+			},
+		},
+		{
+			name: "short fingerprint is a prefix",
+			f: func(t *testing.T) {
+				fp := FormatFingerprint(Fingerprint(alice.PublicKey()))
+				assert.Equal(t, fp[:len(ShortFingerprint(alice.PublicKey()))], ShortFingerprint(alice.PublicKey()))
+			},
+		},
+		{
+			name: "safety number is the same on both sides",
+			f: func(t *testing.T) {
+				number := SafetyNumber(alice.PublicKey(), bob.PublicKey())
+				assert.Equal(t, number, SafetyNumber(bob.PublicKey(), alice.PublicKey()), "safety number must not depend on who computes it")
+				assert.Len(t, number, 60+11, "safety number must be 12 groups of 5 digits")
+			},
+		},
+		{
+			name: "safety number changes with a key",
+			f: func(t *testing.T) {
+				mallory, err := NewEd25519KeyPair()
+				assert.Nil(t, err, "could not generate pair keys")
+				assert.NotEqual(t, SafetyNumber(alice.PublicKey(), bob.PublicKey()), SafetyNumber(mallory.PublicKey(), bob.PublicKey()))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
+
 func TestClean(t *testing.T) {
 	os.Remove("public.key")
 	os.Remove("private.key")
@@ -11,3 +11,23 @@ func WithPublicKey(fileName string) KeyPairOpts {
 		return kp.LoadPublicKey(fileName)
 	}
 }
+
+// WithPassphrase unlocks encrypted private keys, it must come before
+// WithPrivateKey
+func WithPassphrase(passphrase []byte) KeyPairOpts {
+	return func(kp *keyPair) error {
+		kp.passphrase = func(string) ([]byte, error) {
+			return passphrase, nil
+		}
+		return nil
+	}
+}
+
+// WithPassphrasePrompt asks for the passphrase only when an encrypted
+// private key is loaded, it must come before WithPrivateKey
+func WithPassphrasePrompt(prompt PassphrasePrompt) KeyPairOpts {
+	return func(kp *keyPair) error {
+		kp.passphrase = prompt
+		return nil
+	}
+}
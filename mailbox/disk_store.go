@@ -0,0 +1,111 @@
+package mailbox
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// diskStore keeps one append only file per recipient, each line holds a
+// JSON encoded Item, file names are hashed so recipient keys never reach
+// the file system as is
+type diskStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+var _ Store = (*diskStore)(nil)
+
+func (s *diskStore) path(recipient string) string {
+	sum := sha256.Sum256([]byte(recipient))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".jsonl")
+}
+
+func (s *diskStore) Append(recipient string, item *Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path(recipient), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *diskStore) Take(recipient string) ([]*Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, err := s.read(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Remove(s.path(recipient))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (s *diskStore) Count(recipient string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, err := s.read(recipient)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(items), nil
+}
+
+func (s *diskStore) read(recipient string) ([]*Item, error) {
+	file, err := os.Open(s.path(recipient))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	items := make([]*Item, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		item := &Item{}
+		err := json.Unmarshal(scanner.Bytes(), item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, scanner.Err()
+}
+
+func NewDiskStore(dir string) (Store, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskStore{
+		dir: dir,
+	}, nil
+}
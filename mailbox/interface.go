@@ -0,0 +1,36 @@
+package mailbox
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	MailboxFullError = errors.New("recipient mailbox is full")
+)
+
+const (
+	DEFAULT_MAX_QUEUE_SIZE = 100
+	DEFAULT_MAX_AGE        = 7 * 24 * time.Hour
+)
+
+type Item struct {
+	Payload  []byte    `json:"payload"`
+	StoredAt time.Time `json:"stored_at"`
+}
+
+// Store is the storage backend behind a Mailbox, implementations only need
+// to keep items in insertion order, size and age limits are enforced by the
+// Mailbox itself
+type Store interface {
+	Append(recipient string, item *Item) error
+	Take(recipient string) ([]*Item, error)
+	Count(recipient string) (int, error)
+}
+
+type Mailbox interface {
+	Push(recipient string, payload []byte) error
+	Drain(recipient string) ([][]byte, error)
+}
+
+type MailboxOpts func(*mailbox)
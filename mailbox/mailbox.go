@@ -0,0 +1,126 @@
+package mailbox
+
+import (
+	"sync"
+	"time"
+)
+
+type mailbox struct {
+	mu           sync.Mutex
+	store        Store
+	maxQueueSize int
+	maxAge       time.Duration
+	now          func() time.Time
+}
+
+var _ Mailbox = (*mailbox)(nil)
+
+func (m *mailbox) Push(recipient string, payload []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count, err := m.store.Count(recipient)
+	if err != nil {
+		return err
+	}
+
+	if count >= m.maxQueueSize {
+		// expired items still count against the limit until they are
+		// pruned, so give them a chance to go before refusing
+		count, err = m.prune(recipient)
+		if err != nil {
+			return err
+		}
+
+		if count >= m.maxQueueSize {
+			return MailboxFullError
+		}
+	}
+
+	return m.store.Append(recipient, &Item{
+		Payload:  payload,
+		StoredAt: m.now(),
+	})
+}
+
+func (m *mailbox) Drain(recipient string) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items, err := m.store.Take(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make([][]byte, 0, len(items))
+	for _, item := range m.fresh(items) {
+		payloads = append(payloads, item.Payload)
+	}
+
+	return payloads, nil
+}
+
+func (m *mailbox) prune(recipient string) (int, error) {
+	items, err := m.store.Take(recipient)
+	if err != nil {
+		return 0, err
+	}
+
+	items = m.fresh(items)
+	for _, item := range items {
+		err := m.store.Append(recipient, item)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(items), nil
+}
+
+func (m *mailbox) fresh(items []*Item) []*Item {
+	now := m.now()
+	fresh := make([]*Item, 0, len(items))
+	for _, item := range items {
+		if now.Sub(item.StoredAt) > m.maxAge {
+			continue
+		}
+		fresh = append(fresh, item)
+	}
+	return fresh
+}
+
+func WithStore(store Store) MailboxOpts {
+	return func(m *mailbox) {
+		m.store = store
+	}
+}
+
+func WithMaxQueueSize(size int) MailboxOpts {
+	return func(m *mailbox) {
+		m.maxQueueSize = size
+	}
+}
+
+func WithMaxAge(age time.Duration) MailboxOpts {
+	return func(m *mailbox) {
+		m.maxAge = age
+	}
+}
+
+func NewMailbox(opts ...MailboxOpts) Mailbox {
+	m := &mailbox{
+		maxQueueSize: DEFAULT_MAX_QUEUE_SIZE,
+		maxAge:       DEFAULT_MAX_AGE,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.store == nil {
+		m.store = NewMemoryStore()
+	}
+
+	return m
+}
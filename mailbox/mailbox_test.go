@@ -0,0 +1,104 @@
+package mailbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMailbox(t *testing.T) {
+	disk, err := NewDiskStore(t.TempDir())
+	assert.Nil(t, err, "could not create disk store")
+
+	stores := []struct {
+		name  string
+		store Store
+	}{
+		{
+			name:  "memory store",
+			store: NewMemoryStore(),
+		},
+		{
+			name:  "disk store",
+			store: disk,
+		},
+	}
+
+	test := []struct {
+		name string
+		f    func(Store, *testing.T)
+	}{
+		{
+			name: "drain returns items in order",
+			f: func(store Store, t *testing.T) {
+				m := NewMailbox(WithStore(store))
+				assert.Nil(t, m.Push("bob", []byte("first")))
+				assert.Nil(t, m.Push("bob", []byte("second")))
+				assert.Nil(t, m.Push("alice", []byte("other")))
+
+				payloads, err := m.Drain("bob")
+				assert.Nil(t, err, "could not drain mailbox")
+				assert.Equal(t, [][]byte{[]byte("first"), []byte("second")}, payloads)
+
+				payloads, err = m.Drain("bob")
+				assert.Nil(t, err, "could not drain empty mailbox")
+				assert.Empty(t, payloads, "mailbox must be empty after drain")
+
+				payloads, err = m.Drain("alice")
+				assert.Nil(t, err, "could not drain mailbox")
+				assert.Equal(t, [][]byte{[]byte("other")}, payloads)
+			},
+		},
+		{
+			name: "push fails when queue is full",
+			f: func(store Store, t *testing.T) {
+				m := NewMailbox(WithStore(store), WithMaxQueueSize(2))
+				assert.Nil(t, m.Push("bob", []byte("first")))
+				assert.Nil(t, m.Push("bob", []byte("second")))
+				assert.Equal(t, MailboxFullError, m.Push("bob", []byte("third")))
+
+				payloads, err := m.Drain("bob")
+				assert.Nil(t, err, "could not drain mailbox")
+				assert.Len(t, payloads, 2)
+			},
+		},
+		{
+			name: "expired items are dropped",
+			f: func(store Store, t *testing.T) {
+				now := time.Now()
+				m := NewMailbox(WithStore(store), WithMaxQueueSize(1), WithMaxAge(time.Minute)).(*mailbox)
+				m.now = func() time.Time { return now }
+				assert.Nil(t, m.Push("bob", []byte("old")))
+
+				now = now.Add(2 * time.Minute)
+				assert.Nil(t, m.Push("bob", []byte("new")), "expired item must not count against the limit")
+
+				payloads, err := m.Drain("bob")
+				assert.Nil(t, err, "could not drain mailbox")
+				assert.Equal(t, [][]byte{[]byte("new")}, payloads)
+			},
+		},
+	}
+
+	for _, s := range stores {
+		for _, tt := range test {
+			t.Run(s.name+"/"+tt.name, func(t *testing.T) {
+				tt.f(s.store, t)
+			})
+		}
+	}
+}
+
+func TestDiskStorePersists(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir)
+	assert.Nil(t, err, "could not create disk store")
+	assert.Nil(t, NewMailbox(WithStore(store)).Push("bob", []byte("TIRAICHBADFTHR")))
+
+	reopened, err := NewDiskStore(dir)
+	assert.Nil(t, err, "could not reopen disk store")
+	payloads, err := NewMailbox(WithStore(reopened)).Drain("bob")
+	assert.Nil(t, err, "could not drain mailbox")
+	assert.Equal(t, [][]byte{[]byte("TIRAICHBADFTHR")}, payloads)
+}
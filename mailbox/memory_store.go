@@ -0,0 +1,40 @@
+package mailbox
+
+import "sync"
+
+type memoryStore struct {
+	mu    sync.Mutex
+	items map[string][]*Item
+}
+
+var _ Store = (*memoryStore)(nil)
+
+func (s *memoryStore) Append(recipient string, item *Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[recipient] = append(s.items[recipient], item)
+	return nil
+}
+
+func (s *memoryStore) Take(recipient string) ([]*Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.items[recipient]
+	delete(s.items, recipient)
+	return items, nil
+}
+
+func (s *memoryStore) Count(recipient string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items[recipient]), nil
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		items: make(map[string][]*Item),
+	}
+}
@@ -1,29 +1,404 @@
 package main
 
 import (
+	"crypto/tls"
+	"fmt"
 	"log"
-	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"pogchat/client"
+	"pogchat/codec"
 	"pogchat/key"
+	"pogchat/mailbox"
 	"pogchat/server"
+	"pogchat/tlsutil"
+	"pogchat/transport"
+	"pogchat/trust"
 	"pogchat/user_client"
+	"strconv"
+	"strings"
 )
 
+const SERVER_URL = "tcp://localhost:42069"
+
+// tlsConfig is set when the server is reached over TLS, TLS_PIN trusts one
+// server key, TLS_CA a CA file and SERVER_TLS=1 the system roots, host is
+// the name checked unless TLS_SERVER_NAME overrides it
+func tlsConfig(host string) (*tls.Config, error) {
+	opts := []tlsutil.ClientOpts{}
+
+	if v := os.Getenv("TLS_PIN"); v != "" {
+		pin, err := tlsutil.ParsePin(v)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, tlsutil.WithPin(pin))
+	}
+
+	if v := os.Getenv("TLS_CA"); v != "" {
+		opts = append(opts, tlsutil.WithCAFile(v))
+	}
+
+	if len(opts) == 0 && os.Getenv("SERVER_TLS") != "1" {
+		return nil, nil
+	}
+
+	if v := os.Getenv("TLS_SERVER_NAME"); v != "" {
+		host = v
+	}
+	opts = append(opts, tlsutil.WithServerName(host))
+
+	return tlsutil.ClientConfig(opts...)
+}
+
+// dial connects to SERVER_URL, see transport.Dial for the schemes, the user
+// client calls it again whenever the connection drops, tcp and grpc urls go
+// over TLS when any of the TLS settings is given and CODEC=json turns the
+// binary encoding down
+func dial() (client.Client, error) {
+	rawURL := os.Getenv("SERVER_URL")
+	if rawURL == "" {
+		rawURL = SERVER_URL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := tlsConfig(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if config != nil && u.Scheme == transport.TCP_SCHEME {
+		u.Scheme = transport.TLS_SCHEME
+	}
+	if config != nil && u.Scheme == transport.GRPC_SCHEME {
+		u.Scheme = transport.GRPCS_SCHEME
+	}
+
+	opts := []transport.TransportOpts{transport.WithTLSConfig(config)}
+	if v := os.Getenv("CODEC"); v != "" {
+		preferred, err := codec.ParseCodec(v)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, transport.WithCodec(preferred))
+	}
+
+	conn, err := transport.Dial(u.String(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.NewClient(
+		client.WithMessageConn(conn),
+		client.WithReadTimeout(userclient.DEFAULT_READ_TIMEOUT),
+		client.WithWriteTimeout(server.DEFAULT_WRITE_TIMEOUT)), nil
+}
+
+// listeners opens every url in LISTEN, a comma separated list such as
+// tcp://:42069,unix:///run/pogchat.sock,wss://:8443/ws,grpc://:42071, tls,
+// wss and grpcs use TLS_CERT and TLS_KEY
+func listeners(urls string) []transport.Listener {
+	opts := []transport.TransportOpts{}
+	if cert := os.Getenv("TLS_CERT"); cert != "" {
+		config, err := tlsutil.ServerConfig(cert, os.Getenv("TLS_KEY"))
+		if err != nil {
+			log.Fatalf("[main.listeners] tlsutil.ServerConfig() returned error: %+v\n", err)
+		}
+		opts = append(opts, transport.WithTLSConfig(config))
+	}
+
+	listeners := []transport.Listener{}
+	for _, u := range strings.Split(urls, ",") {
+		listener, err := transport.Listen(strings.TrimSpace(u), opts...)
+		if err != nil {
+			log.Fatalf("[main.listeners] transport.Listen() returned error: %+v\n", err)
+		}
+		log.Printf("[main.listeners] listening on %s\n", u)
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
+func tlscert(args []string) {
+	if len(args) < 1 {
+		log.Fatalln("[main.tlscert] usage: tlscert <output prefix> [host...]")
+	}
+
+	hosts := args[1:]
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1"}
+	}
+
+	certFile, keyFile := args[0]+"Cert.pem", args[0]+"Key.pem"
+	err := tlsutil.WriteSelfSigned(certFile, keyFile, hosts)
+	if err != nil {
+		log.Fatalf("[main.tlscert] tlsutil.WriteSelfSigned() returned error: %+v\n", err)
+	}
+
+	pin, err := tlsutil.Fingerprint(certFile)
+	if err != nil {
+		log.Fatalf("[main.tlscert] tlsutil.Fingerprint() returned error: %+v\n", err)
+	}
+
+	fmt.Printf("wrote %s and %s for %s\n", certFile, keyFile, strings.Join(hosts, ", "))
+	fmt.Printf("TLS_PIN=%s\n", tlsutil.FormatPin(pin))
+}
+
+func keygen(args []string) {
+	if len(args) != 2 {
+		log.Fatalln("[main.keygen] usage: keygen <rsa|ed25519> <output prefix>")
+	}
+
+	var pair key.KeyPair
+	var err error
+	switch args[0] {
+	case "rsa":
+		pair, err = key.NewKeyPair(2048)
+	case "ed25519":
+		pair, err = key.NewEd25519KeyPair()
+	default:
+		log.Fatalf("[main.keygen] unknown key type %s\n", args[0])
+	}
+	if err != nil {
+		log.Fatalf("[main.keygen] could not generate key pair: %+v\n", err)
+	}
+
+	err = pair.StorePrivateKey(args[1] + "Private.key")
+	if err != nil {
+		log.Fatalf("[main.keygen] pair.StorePrivateKey() returned error: %+v\n", err)
+	}
+
+	err = pair.StorePublicKey(args[1] + "Public.key")
+	if err != nil {
+		log.Fatalf("[main.keygen] pair.StorePublicKey() returned error: %+v\n", err)
+	}
+}
+
+// passwd encrypts a private key file or changes its passphrase, leave the
+// current passphrase empty for a key that is not encrypted yet
+func passwd(args []string) {
+	if len(args) != 1 {
+		log.Fatalln("[main.passwd] usage: passwd <private key file>")
+	}
+
+	var oldPassphrase []byte
+	encrypted, err := key.IsEncryptedPrivateKey(args[0])
+	if err != nil {
+		log.Fatalf("[main.passwd] could not read %s: %+v\n", args[0], err)
+	}
+
+	if encrypted {
+		oldPassphrase, err = userclient.ReadPassphrase("current passphrase: ")
+		if err != nil {
+			log.Fatalf("[main.passwd] could not read passphrase: %+v\n", err)
+		}
+	}
+
+	newPassphrase, err := userclient.ReadPassphrase("new passphrase: ")
+	if err != nil {
+		log.Fatalf("[main.passwd] could not read passphrase: %+v\n", err)
+	}
+
+	confirm, err := userclient.ReadPassphrase("repeat new passphrase: ")
+	if err != nil {
+		log.Fatalf("[main.passwd] could not read passphrase: %+v\n", err)
+	}
+
+	if string(newPassphrase) != string(confirm) {
+		log.Fatalln("[main.passwd] passphrases do not match")
+	}
+
+	err = key.ChangePassphrase(args[0], oldPassphrase, newPassphrase)
+	if err != nil {
+		log.Fatalf("[main.passwd] key.ChangePassphrase() returned error: %+v\n", err)
+	}
+}
+
+// fingerprint prints the fingerprint of a public key, with a second key it
+// prints the safety number of the conversation between both keys instead
+func fingerprint(args []string) {
+	if len(args) != 1 && len(args) != 2 {
+		log.Fatalln("[main.fingerprint] usage: fingerprint <publicKeyFile.key> [peerPublicKeyFile.key]")
+	}
+
+	pair, err := key.LoadKeyPair(key.WithPublicKey(args[0]))
+	if err != nil {
+		log.Fatalf("[main.fingerprint] could not load %s: %+v\n", args[0], err)
+	}
+
+	if len(args) == 1 {
+		fmt.Println(key.FormatFingerprint(key.Fingerprint(pair.PublicKey())))
+		return
+	}
+
+	peer, err := key.LoadKeyPair(key.WithPublicKey(args[1]))
+	if err != nil {
+		log.Fatalf("[main.fingerprint] could not load %s: %+v\n", args[1], err)
+	}
+
+	fmt.Println(key.SafetyNumber(pair.PublicKey(), peer.PublicKey()))
+}
+
+// receiverName is the name the receiver key is pinned under, it defaults to
+// the key file name
+func receiverName() string {
+	if name := os.Getenv("RECEIVER_NAME"); name != "" {
+		return name
+	}
+
+	base := filepath.Base(os.Getenv("RECEIVER_PUBLIC"))
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func knownPeers() trust.KnownPeers {
+	fileName, err := trust.DefaultFile()
+	if err != nil {
+		log.Fatalf("[main.knownPeers] trust.DefaultFile() returned error: %+v\n", err)
+	}
+
+	peers, err := trust.NewKnownPeers(fileName)
+	if err != nil {
+		log.Fatalf("[main.knownPeers] trust.NewKnownPeers() returned error: %+v\n", err)
+	}
+	return peers
+}
+
+// verify marks a contact key as compared out of band, this is also how a
+// changed key is accepted, without arguments it lists every known contact
+func verify(args []string) {
+	peers := knownPeers()
+
+	if len(args) == 0 {
+		list, err := peers.Peers()
+		if err != nil {
+			log.Fatalf("[main.verify] peers.Peers() returned error: %+v\n", err)
+		}
+		for _, peer := range list {
+			state := "unverified"
+			if peer.Verified {
+				state = "verified"
+			}
+			fmt.Printf("%s\t%s\t%s\n", peer.Name, state, peer.Fingerprint)
+		}
+		return
+	}
+
+	if len(args) != 2 {
+		log.Fatalln("[main.verify] usage: verify [<name> <peerPublicKeyFile.key>]")
+	}
+
+	pair, err := key.LoadKeyPair(key.WithPublicKey(args[1]))
+	if err != nil {
+		log.Fatalf("[main.verify] could not load %s: %+v\n", args[1], err)
+	}
+
+	err = peers.Verify(args[0], pair.PublicKey())
+	if err != nil {
+		log.Fatalf("[main.verify] peers.Verify() returned error: %+v\n", err)
+	}
+
+	fmt.Printf("%s verified with fingerprint %s\n", args[0], key.FormatFingerprint(key.Fingerprint(pair.PublicKey())))
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		keygen(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "fingerprint" {
+		fingerprint(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		verify(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "tlscert" {
+		tlscert(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "passwd" {
+		passwd(os.Args[2:])
+		return
+	}
+
 	v := os.Getenv("SERVER")
 
 	if v == "server" {
-		server.NewServer().Start()
+		opts := []server.ConnManagerOpts{}
+
+		if dir := os.Getenv("MAILBOX_DIR"); dir != "" {
+			store, err := mailbox.NewDiskStore(dir)
+			if err != nil {
+				log.Fatalf("[main] mailbox.NewDiskStore() returned error: %+v\n", err)
+			}
+			opts = append(opts, server.WithMailbox(mailbox.NewMailbox(mailbox.WithStore(store))))
+		}
+
+		if fileName := os.Getenv("REVOCATION_FILE"); fileName != "" {
+			revocations, err := server.NewRevocations(fileName)
+			if err != nil {
+				log.Fatalf("[main] server.NewRevocations() returned error: %+v\n", err)
+			}
+			opts = append(opts, server.WithRevocations(revocations))
+		}
+
+		if v := os.Getenv("SEND_QUEUE_POLICY"); v != "" {
+			policy, err := server.ParseOverflowPolicy(v)
+			if err != nil {
+				log.Fatalf("[main] server.ParseOverflowPolicy() returned error: %+v\n", err)
+			}
+			opts = append(opts, server.WithOverflowPolicy(policy))
+		}
+
+		serverOpts := []server.ServerOpts{}
+		if urls := os.Getenv("LISTEN"); urls != "" {
+			serverOpts = append(serverOpts, server.WithListeners(listeners(urls)...))
+		}
+		if addr := os.Getenv("WS_ADDRESS"); addr != "" {
+			serverOpts = append(serverOpts, server.WithWebSocket(addr))
+		}
+		if cert := os.Getenv("TLS_CERT"); cert != "" {
+			serverOpts = append(serverOpts, server.WithTLS(cert, os.Getenv("TLS_KEY")))
+		}
+		if v := os.Getenv("SEND_QUEUE_SIZE"); v != "" {
+			size, err := strconv.Atoi(v)
+			if err != nil {
+				log.Fatalf("[main] strconv.Atoi() returned error: %+v\n", err)
+			}
+			serverOpts = append(serverOpts, server.WithQueueSize(size))
+		}
+
+		// expvar serves the queue metrics on /debug/vars
+		if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+			go func() {
+				err := http.ListenAndServe(addr, nil)
+				log.Printf("[main] http.ListenAndServe() returned error: %+v\n", err)
+			}()
+		}
+
+		serverOpts = append(serverOpts, server.WithConnectionManager(server.NewConnectionManager(opts...)))
+		server.NewServer(serverOpts...).Start()
 	}
 
-	connection, err := net.Dial("tcp", "localhost:42069")
+	client, err := dial()
 	if err != nil {
-		log.Fatalf("[main] net.Dial() returned error: %+v\n", err)
+		log.Fatalf("[main] dial() returned error: %+v\n", err)
 	}
 
-	client := client.NewClient(client.WithConnection(connection))
-	userClient, err := userclient.NewUserClient(userclient.WithClient(client))
+	userClient, err := userclient.NewUserClient(
+		userclient.WithClient(client),
+		userclient.WithDialer(dial),
+		userclient.WithReceiverName(receiverName()))
 	if err != nil {
 		log.Printf("[main.NewUserClient] NewUserMessage() returned error %+v\n", err)
 		return
@@ -0,0 +1,65 @@
+package ratchet
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	NoSessionError        = errors.New("there is no session with this peer")
+	TooManySkippedError   = errors.New("too many skipped messages in chain")
+	MalformedMessageError = errors.New("malformed ratchet message")
+	DecryptionError       = errors.New("could not decrypt ratchet message")
+	StaleInitError        = errors.New("session init is older than the current session")
+)
+
+const (
+	KEY_SIZE = 32
+	// MAX_SKIP bounds how many message keys a single header may force us to
+	// derive and keep around for out of order delivery
+	MAX_SKIP = 1000
+	// MAX_SKIPPED_KEYS bounds the skipped message keys kept over every
+	// chain of a session, the oldest go first
+	MAX_SKIPPED_KEYS = 2000
+	// INIT_SKEW is how far the peer clock may drift from ours when an init
+	// is weighed against the established session
+	INIT_SKEW = 5 * time.Minute
+)
+
+type Header struct {
+	DH []byte `json:"dh"`
+	PN uint32 `json:"pn"`
+	N  uint32 `json:"n"`
+}
+
+// Init lets the peer derive the session root key, it only carries public
+// values, Created travels inside the signed user message so the relay can
+// not make an old init look fresh
+type Init struct {
+	SessionID string `json:"session_id"`
+	Ephemeral []byte `json:"ephemeral"`
+	Created   int64  `json:"created"`
+}
+
+// Message is what travels inside a user_message of type RATCHET, Init is
+// attached by the initiator until the peer has answered in the session
+type Message struct {
+	Init       *Init  `json:"init,omitempty"`
+	Header     Header `json:"header"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Store persists one session per peer, peers are identified by their long
+// term public key
+type Store interface {
+	Load(peer []byte) (*Session, error)
+	Save(peer []byte, session *Session) error
+	Delete(peer []byte) error
+}
+
+type Manager interface {
+	Encrypt(peer []byte, plaintext []byte) ([]byte, error)
+	Decrypt(peer []byte, message []byte) ([]byte, error)
+}
+
+type ManagerOpts func(*manager)
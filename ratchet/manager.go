@@ -0,0 +1,275 @@
+package ratchet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"pogchat/cryptography"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const agreementInfo = "POGCHAT_RATCHET_X3DH"
+
+type manager struct {
+	mu         sync.Mutex
+	store      Store
+	publicKey  []byte
+	privateKey []byte
+	now        func() time.Time
+}
+
+var _ Manager = (*manager)(nil)
+
+func (m *manager) Encrypt(peer []byte, plaintext []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.store.Load(peer)
+	if err == NoSessionError {
+		s, err = m.newSession(peer)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := s.encrypt(plaintext, associatedData(m.publicKey, peer))
+	if err != nil {
+		return nil, err
+	}
+	msg.Init = s.PendingInit
+
+	err = m.store.Save(peer, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(msg)
+}
+
+func (m *manager) Decrypt(peer []byte, message []byte) ([]byte, error) {
+	msg := &Message{}
+	err := json.Unmarshal(message, msg)
+	if err != nil {
+		return nil, MalformedMessageError
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.store.Load(peer)
+	if err != nil && err != NoSessionError {
+		return nil, err
+	}
+
+	ad := associatedData(peer, m.publicKey)
+
+	if msg.Init != nil {
+		init := msg.Init
+		if len(init.Ephemeral) != KEY_SIZE || init.SessionID == "" {
+			return nil, MalformedMessageError
+		}
+
+		if s == nil || s.ID != init.SessionID {
+			if !m.fresh(s, init) {
+				return nil, StaleInitError
+			}
+
+			incoming, err := m.acceptSession(peer, init)
+			if err != nil {
+				return nil, err
+			}
+
+			if !adopt(s, init.SessionID) {
+				// both sides started a session at once and ours wins, the
+				// peer will switch over so this message is read once
+				// without keeping its session around
+				return incoming.decrypt(msg, ad)
+			}
+
+			s = incoming
+		}
+	}
+
+	if s == nil {
+		return nil, NoSessionError
+	}
+
+	work := s.clone()
+	plaintext, err := work.decrypt(msg, ad)
+	if err != nil {
+		return nil, err
+	}
+
+	// anything decrypting in this session proves the peer holds it, the
+	// init no longer needs to travel with our messages
+	work.PendingInit = nil
+	work.LastReceived = m.now().Unix()
+
+	err = m.store.Save(peer, work)
+	if err != nil {
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+// fresh tells whether an init may replace the session we have, a pending
+// session can always be raced, an established one is only given up for an
+// init created after the last message it carried, anything older is a
+// replay of a session the peer already left
+func (m *manager) fresh(current *Session, init *Init) bool {
+	now := m.now()
+	if time.Unix(init.Created, 0).After(now.Add(INIT_SKEW)) {
+		return false
+	}
+
+	if current == nil || current.PendingInit != nil {
+		return true
+	}
+
+	return time.Unix(init.Created, 0).Add(INIT_SKEW).After(time.Unix(current.LastReceived, 0))
+}
+
+// adopt decides whether a session offered by the peer replaces ours, an
+// established session is replaced once fresh has shown the peer lost it,
+// when both inits are still pending the smaller id wins on both sides
+func adopt(current *Session, offered string) bool {
+	if current == nil || current.PendingInit == nil {
+		return true
+	}
+	return offered < current.ID
+}
+
+// newSession starts a session the X3DH way without prekeys, the root key
+// comes from DH(IKa, IKb) and DH(EKa, IKb) and the peer identity key is its
+// first ratchet key, only the ephemeral public key travels in the init so
+// nothing secret is ever sealed to a long term key
+func (m *manager) newSession(peer []byte) (*Session, error) {
+	identity, err := cryptography.CurvePrivateKey(m.privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	peerIdentity, err := cryptography.CurvePublicKey(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralPrivate, ephemeralPublic, err := generateDH()
+	if err != nil {
+		return nil, err
+	}
+
+	sk, err := agree(identity, peerIdentity, ephemeralPrivate, peerIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	_, err = io.ReadFull(rand.Reader, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := initSender(hex.EncodeToString(id), sk, peerIdentity)
+	if err != nil {
+		return nil, err
+	}
+	s.PendingInit = &Init{
+		SessionID: hex.EncodeToString(id),
+		Ephemeral: ephemeralPublic,
+		Created:   m.now().Unix(),
+	}
+
+	return s, nil
+}
+
+// acceptSession derives the root key of a session the peer started, our
+// identity key answers both DH and is the first ratchet key, decrypting the
+// first message steps the ratchet so it is never saved with the session
+func (m *manager) acceptSession(peer []byte, init *Init) (*Session, error) {
+	identity, err := cryptography.CurvePrivateKey(m.privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	peerIdentity, err := cryptography.CurvePublicKey(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	sk, err := agree(identity, peerIdentity, identity, init.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	return initReceiver(init.SessionID, sk, identity)
+}
+
+// agree mixes the static and the ephemeral DH into the session root key,
+// both sides pass their halves of the same two exchanges
+func agree(private1 []byte, public1 []byte, private2 []byte, public2 []byte) ([]byte, error) {
+	dh1, err := curve25519.X25519(private1, public1)
+	if err != nil {
+		return nil, err
+	}
+
+	dh2, err := curve25519.X25519(private2, public2)
+	if err != nil {
+		return nil, err
+	}
+
+	ikm := append(append(bytes.Repeat([]byte{0xff}, KEY_SIZE), dh1...), dh2...)
+	sk := make([]byte, KEY_SIZE)
+	_, err = io.ReadFull(hkdf.New(sha256.New, ikm, make([]byte, KEY_SIZE), []byte(agreementInfo)), sk)
+	if err != nil {
+		return nil, err
+	}
+
+	return sk, nil
+}
+
+// associatedData binds every ratchet message to the direction it travels
+func associatedData(from []byte, to []byte) []byte {
+	fromSum := sha256.Sum256(from)
+	toSum := sha256.Sum256(to)
+	return append(fromSum[:], toSum[:]...)
+}
+
+func WithStore(store Store) ManagerOpts {
+	return func(m *manager) {
+		m.store = store
+	}
+}
+
+// WithIdentity sets the long term key pair sessions are agreed with, it
+// must be an Ed25519 or X25519 key since RSA can not do DH
+func WithIdentity(publicKey []byte, privateKey []byte) ManagerOpts {
+	return func(m *manager) {
+		m.publicKey = publicKey
+		m.privateKey = privateKey
+	}
+}
+
+func NewManager(opts ...ManagerOpts) Manager {
+	m := &manager{
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.store == nil {
+		m.store = NewMemoryStore()
+	}
+
+	return m
+}
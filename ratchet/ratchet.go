@@ -0,0 +1,329 @@
+package ratchet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	rootInfo    = "POGCHAT_RATCHET_ROOT"
+	messageInfo = "POGCHAT_RATCHET_MESSAGE"
+)
+
+// Session is the double ratchet state shared with a single peer, it is
+// serialised as is by the stores so every field must stay exported
+type Session struct {
+	ID          string            `json:"id"`
+	PendingInit *Init             `json:"init,omitempty"`
+	DHsPrivate  []byte            `json:"dhs_private"`
+	DHsPublic   []byte            `json:"dhs_public"`
+	DHr         []byte            `json:"dhr,omitempty"`
+	RK          []byte            `json:"rk"`
+	CKs         []byte            `json:"cks,omitempty"`
+	CKr         []byte            `json:"ckr,omitempty"`
+	Ns          uint32            `json:"ns"`
+	Nr          uint32            `json:"nr"`
+	PN          uint32            `json:"pn"`
+	Skipped     map[string][]byte `json:"skipped,omitempty"`
+	// SkippedOrder lists the keys of Skipped oldest first so the total can
+	// be capped across DH ratchet steps
+	SkippedOrder []string `json:"skipped_order,omitempty"`
+	// LastReceived is when a message last decrypted in this session, an
+	// init created before it can not replace the session
+	LastReceived int64 `json:"last_received,omitempty"`
+}
+
+func generateDH() ([]byte, []byte, error) {
+	private := make([]byte, KEY_SIZE)
+	_, err := io.ReadFull(rand.Reader, private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return private, public, nil
+}
+
+// initSender starts a session for the side that knows the peer ratchet
+// public key and can therefore send right away
+func initSender(id string, sk []byte, peerDH []byte) (*Session, error) {
+	private, public, err := generateDH()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		ID:         id,
+		DHsPrivate: private,
+		DHsPublic:  public,
+		DHr:        peerDH,
+		Skipped:    make(map[string][]byte),
+	}
+
+	dh, err := curve25519.X25519(private, peerDH)
+	if err != nil {
+		return nil, err
+	}
+
+	s.RK, s.CKs, err = kdfRK(sk, dh)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// initReceiver starts a session for the side owning the first ratchet key
+// pair, it can only send once it has received
+func initReceiver(id string, sk []byte, private []byte) (*Session, error) {
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		ID:         id,
+		DHsPrivate: private,
+		DHsPublic:  public,
+		RK:         sk,
+		Skipped:    make(map[string][]byte),
+	}, nil
+}
+
+func kdfRK(rk []byte, dh []byte) ([]byte, []byte, error) {
+	out := make([]byte, 2*KEY_SIZE)
+	_, err := io.ReadFull(hkdf.New(sha256.New, dh, rk, []byte(rootInfo)), out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out[:KEY_SIZE], out[KEY_SIZE:], nil
+}
+
+func kdfCK(ck []byte) ([]byte, []byte) {
+	mac := hmac.New(sha256.New, ck)
+	mac.Write([]byte{0x01})
+	mk := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, ck)
+	mac.Write([]byte{0x02})
+	return mac.Sum(nil), mk
+}
+
+// messageAEAD expands a message key into an AES-GCM key and nonce, every
+// message key is used exactly once so a derived nonce is safe
+func messageAEAD(mk []byte) (cipher.AEAD, []byte, error) {
+	out := make([]byte, KEY_SIZE+12)
+	_, err := io.ReadFull(hkdf.New(sha256.New, mk, nil, []byte(messageInfo)), out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, err := aes.NewCipher(out[:KEY_SIZE])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return aead, out[KEY_SIZE:], nil
+}
+
+func (h *Header) encode(ad []byte) []byte {
+	buf := make([]byte, 0, len(ad)+len(h.DH)+8)
+	buf = append(buf, ad...)
+	buf = append(buf, h.DH...)
+	buf = binary.BigEndian.AppendUint32(buf, h.PN)
+	buf = binary.BigEndian.AppendUint32(buf, h.N)
+	return buf
+}
+
+func skippedKey(dh []byte, n uint32) string {
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(dh), n)
+}
+
+func (s *Session) encrypt(plaintext []byte, ad []byte) (*Message, error) {
+	if s.CKs == nil {
+		return nil, NoSessionError
+	}
+
+	var mk []byte
+	s.CKs, mk = kdfCK(s.CKs)
+
+	header := Header{
+		DH: s.DHsPublic,
+		PN: s.PN,
+		N:  s.Ns,
+	}
+	s.Ns++
+
+	aead, nonce, err := messageAEAD(mk)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Header:     header,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, header.encode(ad)),
+	}, nil
+}
+
+// decrypt advances the session, callers must work on a copy and only keep
+// it when decrypt succeeds so a forged message cannot corrupt the state
+func (s *Session) decrypt(msg *Message, ad []byte) ([]byte, error) {
+	if len(msg.Header.DH) != KEY_SIZE {
+		return nil, MalformedMessageError
+	}
+
+	key := skippedKey(msg.Header.DH, msg.Header.N)
+	if mk, ok := s.Skipped[key]; ok {
+		plaintext, err := open(mk, msg, ad)
+		if err != nil {
+			return nil, err
+		}
+		s.forget(key)
+		return plaintext, nil
+	}
+
+	if !hmac.Equal(msg.Header.DH, s.DHr) {
+		err := s.skip(msg.Header.PN)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.dhRatchet(msg.Header.DH)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.skip(msg.Header.N)
+	if err != nil {
+		return nil, err
+	}
+
+	var mk []byte
+	s.CKr, mk = kdfCK(s.CKr)
+	s.Nr++
+
+	return open(mk, msg, ad)
+}
+
+func open(mk []byte, msg *Message, ad []byte) ([]byte, error) {
+	aead, nonce, err := messageAEAD(mk)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, nonce, msg.Ciphertext, msg.Header.encode(ad))
+	if err != nil {
+		return nil, DecryptionError
+	}
+
+	return plaintext, nil
+}
+
+func (s *Session) skip(until uint32) error {
+	if s.CKr == nil {
+		return nil
+	}
+
+	if until > s.Nr+MAX_SKIP {
+		return TooManySkippedError
+	}
+
+	for s.Nr < until {
+		var mk []byte
+		s.CKr, mk = kdfCK(s.CKr)
+		s.remember(skippedKey(s.DHr, s.Nr), mk)
+		s.Nr++
+	}
+
+	return nil
+}
+
+// remember keeps a skipped message key, past MAX_SKIPPED_KEYS the oldest
+// one is dropped so a peer rotating keys can not grow the session forever
+func (s *Session) remember(key string, mk []byte) {
+	// sessions saved before the order was kept list their keys in no
+	// particular order
+	if len(s.SkippedOrder) != len(s.Skipped) {
+		s.SkippedOrder = s.SkippedOrder[:0]
+		for k := range s.Skipped {
+			s.SkippedOrder = append(s.SkippedOrder, k)
+		}
+	}
+
+	s.Skipped[key] = mk
+	s.SkippedOrder = append(s.SkippedOrder, key)
+	for len(s.SkippedOrder) > MAX_SKIPPED_KEYS {
+		delete(s.Skipped, s.SkippedOrder[0])
+		s.SkippedOrder = s.SkippedOrder[1:]
+	}
+}
+
+func (s *Session) forget(key string) {
+	delete(s.Skipped, key)
+	for i, k := range s.SkippedOrder {
+		if k == key {
+			s.SkippedOrder = append(s.SkippedOrder[:i:i], s.SkippedOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *Session) dhRatchet(peerDH []byte) error {
+	s.PN = s.Ns
+	s.Ns = 0
+	s.Nr = 0
+	s.DHr = peerDH
+
+	dh, err := curve25519.X25519(s.DHsPrivate, s.DHr)
+	if err != nil {
+		return err
+	}
+
+	s.RK, s.CKr, err = kdfRK(s.RK, dh)
+	if err != nil {
+		return err
+	}
+
+	s.DHsPrivate, s.DHsPublic, err = generateDH()
+	if err != nil {
+		return err
+	}
+
+	dh, err = curve25519.X25519(s.DHsPrivate, s.DHr)
+	if err != nil {
+		return err
+	}
+
+	s.RK, s.CKs, err = kdfRK(s.RK, dh)
+	return err
+}
+
+func (s *Session) clone() *Session {
+	c := *s
+	c.Skipped = make(map[string][]byte, len(s.Skipped))
+	for k, v := range s.Skipped {
+		c.Skipped[k] = v
+	}
+	c.SkippedOrder = append([]string(nil), s.SkippedOrder...)
+	return &c
+}
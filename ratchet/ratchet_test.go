@@ -0,0 +1,207 @@
+package ratchet
+
+import (
+	"fmt"
+	"pogchat/cryptography"
+	"pogchat/key"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRatchet(t *testing.T) {
+	alicePair, err := key.NewEd25519KeyPair()
+	assert.Nil(t, err, "could not generate pair keys")
+	bobPair, err := key.NewEd25519KeyPair()
+	assert.Nil(t, err, "could not generate pair keys")
+
+	alice := func(store Store) Manager {
+		return NewManager(WithStore(store), WithIdentity(alicePair.PublicKey(), alicePair.PrivateKey()))
+	}
+	bob := func(store Store) Manager {
+		return NewManager(WithStore(store), WithIdentity(bobPair.PublicKey(), bobPair.PrivateKey()))
+	}
+
+	send := func(t *testing.T, from Manager, to []byte, text string) []byte {
+		msg, err := from.Encrypt(to, []byte(text))
+		assert.Nil(t, err, "could not encrypt message")
+		return msg
+	}
+
+	receive := func(t *testing.T, at Manager, from []byte, msg []byte, text string) {
+		plaintext, err := at.Decrypt(from, msg)
+		assert.Nil(t, err, "could not decrypt message")
+		assert.Equal(t, text, string(plaintext), "both messages must be equal")
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "conversation in both directions",
+			f: func(t *testing.T) {
+				a, b := alice(NewMemoryStore()), bob(NewMemoryStore())
+				for i := 0; i < 3; i++ {
+					text := fmt.Sprintf("alice %d", i)
+					receive(t, b, alicePair.PublicKey(), send(t, a, bobPair.PublicKey(), text), text)
+					text = fmt.Sprintf("bob %d", i)
+					receive(t, a, bobPair.PublicKey(), send(t, b, alicePair.PublicKey(), text), text)
+				}
+			},
+		},
+		{
+			name: "out of order delivery",
+			f: func(t *testing.T) {
+				a, b := alice(NewMemoryStore()), bob(NewMemoryStore())
+				first := send(t, a, bobPair.PublicKey(), "first")
+				second := send(t, a, bobPair.PublicKey(), "second")
+				third := send(t, a, bobPair.PublicKey(), "third")
+
+				receive(t, b, alicePair.PublicKey(), third, "third")
+				receive(t, b, alicePair.PublicKey(), first, "first")
+
+				reply := send(t, b, alicePair.PublicKey(), "reply")
+				fourth := send(t, a, bobPair.PublicKey(), "fourth")
+				receive(t, a, bobPair.PublicKey(), reply, "reply")
+				late := send(t, a, bobPair.PublicKey(), "after reply")
+
+				receive(t, b, alicePair.PublicKey(), late, "after reply")
+				receive(t, b, alicePair.PublicKey(), fourth, "fourth")
+				receive(t, b, alicePair.PublicKey(), second, "second")
+			},
+		},
+		{
+			name: "message keys are used only once",
+			f: func(t *testing.T) {
+				a, b := alice(NewMemoryStore()), bob(NewMemoryStore())
+				msg := send(t, a, bobPair.PublicKey(), "TIRAICHBADFTHR")
+				receive(t, b, alicePair.PublicKey(), msg, "TIRAICHBADFTHR")
+
+				_, err := b.Decrypt(alicePair.PublicKey(), msg)
+				assert.NotNil(t, err, "replayed message must not decrypt")
+			},
+		},
+		{
+			name: "tampered message leaves session intact",
+			f: func(t *testing.T) {
+				a, b := alice(NewMemoryStore()), bob(NewMemoryStore())
+				receive(t, b, alicePair.PublicKey(), send(t, a, bobPair.PublicKey(), "hello"), "hello")
+
+				msg := send(t, a, bobPair.PublicKey(), "TIRAICHBADFTHR")
+				tampered := append([]byte{}, msg...)
+				tampered[len(tampered)-3] ^= 0x01
+				_, err := b.Decrypt(alicePair.PublicKey(), tampered)
+				assert.NotNil(t, err, "tampered message must not decrypt")
+
+				receive(t, b, alicePair.PublicKey(), msg, "TIRAICHBADFTHR")
+			},
+		},
+		{
+			name: "simultaneous session start converges",
+			f: func(t *testing.T) {
+				a, b := alice(NewMemoryStore()), bob(NewMemoryStore())
+				fromAlice := send(t, a, bobPair.PublicKey(), "from alice")
+				fromBob := send(t, b, alicePair.PublicKey(), "from bob")
+
+				receive(t, b, alicePair.PublicKey(), fromAlice, "from alice")
+				receive(t, a, bobPair.PublicKey(), fromBob, "from bob")
+
+				receive(t, b, alicePair.PublicKey(), send(t, a, bobPair.PublicKey(), "again alice"), "again alice")
+				receive(t, a, bobPair.PublicKey(), send(t, b, alicePair.PublicKey(), "again bob"), "again bob")
+			},
+		},
+		{
+			name: "old init does not replace an established session",
+			f: func(t *testing.T) {
+				now := time.Now()
+				clock := func(m Manager) Manager {
+					m.(*manager).now = func() time.Time { return now }
+					return m
+				}
+
+				a, b := clock(alice(NewMemoryStore())), clock(bob(NewMemoryStore()))
+				first := send(t, a, bobPair.PublicKey(), "first")
+				receive(t, b, alicePair.PublicKey(), first, "first")
+				receive(t, a, bobPair.PublicKey(), send(t, b, alicePair.PublicKey(), "reply"), "reply")
+
+				now = now.Add(time.Hour)
+				lost := clock(alice(NewMemoryStore()))
+				receive(t, b, alicePair.PublicKey(), send(t, lost, bobPair.PublicKey(), "restarted"), "restarted")
+
+				_, err := b.Decrypt(alicePair.PublicKey(), first)
+				assert.Equal(t, StaleInitError, err)
+
+				receive(t, b, alicePair.PublicKey(), send(t, lost, bobPair.PublicKey(), "still here"), "still here")
+			},
+		},
+		{
+			name: "init from another identity does not decrypt",
+			f: func(t *testing.T) {
+				malloryPair, err := key.NewEd25519KeyPair()
+				assert.Nil(t, err, "could not generate pair keys")
+				mallory := NewManager(WithIdentity(malloryPair.PublicKey(), malloryPair.PrivateKey()))
+
+				_, err = bob(NewMemoryStore()).Decrypt(alicePair.PublicKey(), send(t, mallory, bobPair.PublicKey(), "i am alice"))
+				assert.Equal(t, DecryptionError, err)
+			},
+		},
+		{
+			name: "rsa identities can not agree on a session",
+			f: func(t *testing.T) {
+				rsaPair, err := key.NewKeyPair(2048)
+				assert.Nil(t, err, "could not generate pair keys")
+
+				_, err = alice(NewMemoryStore()).Encrypt(rsaPair.PublicKey(), []byte("hello"))
+				assert.Equal(t, cryptography.UnsupportedKeyTypeError, err)
+			},
+		},
+		{
+			name: "skipped keys are capped across DH steps",
+			f: func(t *testing.T) {
+				store := NewMemoryStore()
+				a, b := alice(NewMemoryStore()), bob(store)
+				first := send(t, a, bobPair.PublicKey(), "first")
+
+				for round := 0; round < 4; round++ {
+					var last []byte
+					for i := 0; i < MAX_SKIP/2+1; i++ {
+						last = send(t, a, bobPair.PublicKey(), "skipped")
+					}
+					receive(t, b, alicePair.PublicKey(), last, "skipped")
+					receive(t, a, bobPair.PublicKey(), send(t, b, alicePair.PublicKey(), "reply"), "reply")
+				}
+
+				s, err := store.Load(alicePair.PublicKey())
+				assert.Nil(t, err, "could not load session")
+				assert.Equal(t, MAX_SKIPPED_KEYS, len(s.Skipped))
+				assert.Equal(t, MAX_SKIPPED_KEYS, len(s.SkippedOrder))
+
+				_, err = b.Decrypt(alicePair.PublicKey(), first)
+				assert.NotNil(t, err, "oldest skipped key must be evicted")
+			},
+		},
+		{
+			name: "sessions survive restarts with file store",
+			f: func(t *testing.T) {
+				aliceDir, bobDir := t.TempDir(), t.TempDir()
+				open := func(dir string) Store {
+					store, err := NewFileStore(dir)
+					assert.Nil(t, err, "could not open file store")
+					return store
+				}
+
+				receive(t, bob(open(bobDir)), alicePair.PublicKey(), send(t, alice(open(aliceDir)), bobPair.PublicKey(), "hello"), "hello")
+				receive(t, alice(open(aliceDir)), bobPair.PublicKey(), send(t, bob(open(bobDir)), alicePair.PublicKey(), "hi"), "hi")
+				receive(t, bob(open(bobDir)), alicePair.PublicKey(), send(t, alice(open(aliceDir)), bobPair.PublicKey(), "bye"), "bye")
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
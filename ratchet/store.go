@@ -0,0 +1,146 @@
+package ratchet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+func peerID(peer []byte) string {
+	sum := sha256.Sum256(peer)
+	return hex.EncodeToString(sum[:])
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+var _ Store = (*memoryStore)(nil)
+
+func (s *memoryStore) Load(peer []byte) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[peerID(peer)]
+	if !ok {
+		return nil, NoSessionError
+	}
+	return session.clone(), nil
+}
+
+func (s *memoryStore) Save(peer []byte, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[peerID(peer)] = session.clone()
+	return nil
+}
+
+func (s *memoryStore) Delete(peer []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, peerID(peer))
+	return nil
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		sessions: make(map[string]*Session),
+	}
+}
+
+// fileStore keeps each session in its own file named after the hash of the
+// peer key, files are replaced atomically so a crash never leaves half a
+// session behind
+type fileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+var _ Store = (*fileStore)(nil)
+
+func (s *fileStore) path(peer []byte) string {
+	return filepath.Join(s.dir, peerID(peer)+".json")
+}
+
+func (s *fileStore) Load(peer []byte) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := os.ReadFile(s.path(peer))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, NoSessionError
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+	err = json.Unmarshal(b, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Skipped == nil {
+		session.Skipped = make(map[string][]byte)
+	}
+
+	return session, nil
+}
+
+func (s *fileStore) Save(peer []byte, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "session-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(peer))
+}
+
+func (s *fileStore) Delete(peer []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(peer))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func NewFileStore(dir string) (Store, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileStore{
+		dir: dir,
+	}, nil
+}
@@ -0,0 +1,154 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// serverConn is one Relay.Session call as the connection manager sees it,
+// closing it ends the call, the manager reads and queues its frames
+// through client.MessageConn so peer messages never become JSON
+type serverConn struct {
+	stream Relay_SessionServer
+	closed chan struct{}
+	once   sync.Once
+}
+
+var _ client.MessageConn = (*serverConn)(nil)
+
+func newServerConn(stream Relay_SessionServer) *serverConn {
+	return &serverConn{stream: stream, closed: make(chan struct{})}
+}
+
+func (c *serverConn) ReadFrame() ([]byte, error) {
+	msg, err := c.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return msg.Envelope()
+}
+
+func (c *serverConn) ReadMessage() (*chatmessage.ChatMessage, error) {
+	frame, err := c.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeClientFrame(frame)
+}
+
+func (c *serverConn) EncodeMessage(msg *chatmessage.ChatMessage) ([]byte, error) {
+	frame, err := EncodeServerFrame(msg)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(frame)
+}
+
+func (c *serverConn) DecodeMessage(payload []byte) (*chatmessage.ChatMessage, error) {
+	frame, err := c.serverFrame(payload)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeServerFrame(frame)
+}
+
+// WriteFrame takes frames from EncodeMessage or JSON envelopes
+func (c *serverConn) WriteFrame(payload []byte) error {
+	frame, err := c.serverFrame(payload)
+	if err != nil {
+		return err
+	}
+	return c.stream.Send(frame)
+}
+
+func (c *serverConn) serverFrame(payload []byte) (*ServerFrame, error) {
+	if !IsJSON(payload) {
+		frame := &ServerFrame{}
+		err := proto.Unmarshal(payload, frame)
+		if err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+
+	msg := &chatmessage.ChatMessage{}
+	err := json.Unmarshal(payload, msg)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeServerFrame(msg)
+}
+
+// SetReadDeadline does nothing, streams have no deadlines and dead peers
+// are found by keepalives and heartbeats instead
+func (c *serverConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *serverConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *serverConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// clientConn is a Relay.Session call made by a client, it owns the gRPC
+// connection it was made on
+type clientConn struct {
+	conn   *grpc.ClientConn
+	stream Relay_SessionClient
+	cancel context.CancelFunc
+}
+
+var _ client.Conn = (*clientConn)(nil)
+
+func (c *clientConn) ReadFrame() ([]byte, error) {
+	frame, err := c.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := DecodeServerFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Envelope()
+}
+
+func (c *clientConn) WriteFrame(payload []byte) error {
+	msg := &chatmessage.ChatMessage{}
+	err := json.Unmarshal(payload, msg)
+	if err != nil {
+		return err
+	}
+
+	frame, err := EncodeClientFrame(msg)
+	if err != nil {
+		return err
+	}
+	return c.stream.Send(frame)
+}
+
+func (c *clientConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *clientConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *clientConn) Close() error {
+	c.cancel()
+	return c.conn.Close()
+}
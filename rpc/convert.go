@@ -0,0 +1,238 @@
+package rpc
+
+import (
+	"errors"
+	chatmessage "pogchat/chat_message"
+	"pogchat/user_message"
+)
+
+// frames become the envelope of the connection manager, peer messages stay
+// decoded in ChatMessage.User so the relay routes them without JSON, the
+// other frames are rare enough to go through their JSON payload
+
+var EmptyFrameError = errors.New("frame carries no message")
+
+// IsJSON tells the encodings apart, a JSON envelope always opens with a
+// brace while that byte would be a group tag in protobuf, which the frames
+// never use
+func IsJSON(frame []byte) bool {
+	return len(frame) > 0 && frame[0] == '{'
+}
+
+func EncodeClientFrame(msg *chatmessage.ChatMessage) (*ClientFrame, error) {
+	switch msg.Type {
+	case chatmessage.LOGIN_MSG:
+		login, err := chatmessage.ParseLogin(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ClientFrame{Frame: &ClientFrame_Login{Login: &Login{
+			PublicKey:       login.PublicKey,
+			Nonce:           login.Nonce,
+			ServerId:        login.ServerID,
+			Timestamp:       login.Timestamp,
+			DeviceId:        login.DeviceID,
+			Signature:       login.Signature,
+			DeviceKey:       login.DeviceKey,
+			DeviceSignature: login.DeviceSignature,
+		}}}, nil
+	case chatmessage.PEER_MSG:
+		um, err := encodeUserMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ClientFrame{Frame: &ClientFrame_Send{Send: um}}, nil
+	case chatmessage.PRESENCE_SUB_MSG:
+		sub, err := chatmessage.ParsePresenceSubscribe(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ClientFrame{Frame: &ClientFrame_Subscribe{Subscribe: &PresenceSubscribe{Keys: sub.Keys}}}, nil
+	case chatmessage.PING_MSG:
+		ping, err := encodeHeartbeat(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ClientFrame{Frame: &ClientFrame_Ping{Ping: ping}}, nil
+	case chatmessage.PONG_MSG:
+		pong, err := encodeHeartbeat(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ClientFrame{Frame: &ClientFrame_Pong{Pong: pong}}, nil
+	default:
+		return &ClientFrame{Frame: &ClientFrame_Other{Other: &ChatMessage{Type: msg.Type, Payload: msg.Payload}}}, nil
+	}
+}
+
+func DecodeClientFrame(frame *ClientFrame) (*chatmessage.ChatMessage, error) {
+	switch f := frame.GetFrame().(type) {
+	case *ClientFrame_Login:
+		return chatmessage.NewChatMessage(chatmessage.LOGIN_MSG, &chatmessage.Login{
+			PublicKey:       f.Login.GetPublicKey(),
+			Nonce:           f.Login.GetNonce(),
+			ServerID:        f.Login.GetServerId(),
+			Timestamp:       f.Login.GetTimestamp(),
+			DeviceID:        f.Login.GetDeviceId(),
+			Signature:       f.Login.GetSignature(),
+			DeviceKey:       f.Login.GetDeviceKey(),
+			DeviceSignature: f.Login.GetDeviceSignature(),
+		})
+	case *ClientFrame_Send:
+		return decodeUserMessage(f.Send)
+	case *ClientFrame_Subscribe:
+		return chatmessage.NewChatMessage(chatmessage.PRESENCE_SUB_MSG, &chatmessage.PresenceSubscribe{
+			Keys: f.Subscribe.GetKeys(),
+		})
+	case *ClientFrame_Ping:
+		return decodeHeartbeat(chatmessage.PING_MSG, f.Ping)
+	case *ClientFrame_Pong:
+		return decodeHeartbeat(chatmessage.PONG_MSG, f.Pong)
+	case *ClientFrame_Other:
+		return &chatmessage.ChatMessage{Type: f.Other.GetType(), Payload: f.Other.GetPayload()}, nil
+	default:
+		return nil, EmptyFrameError
+	}
+}
+
+func EncodeServerFrame(msg *chatmessage.ChatMessage) (*ServerFrame, error) {
+	switch msg.Type {
+	case chatmessage.CHALLENGE_MSG:
+		challenge, err := chatmessage.ParseChallenge(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ServerFrame{Frame: &ServerFrame_Challenge{Challenge: &Challenge{
+			Nonce:     challenge.Nonce,
+			ServerId:  challenge.ServerID,
+			Timestamp: challenge.Timestamp,
+			Codecs:    challenge.Codecs,
+		}}}, nil
+	case chatmessage.STATUS_MSG:
+		status, err := chatmessage.ParseStatus(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ServerFrame{Frame: &ServerFrame_Status{Status: &Status{
+			Code:   string(status.Code),
+			Reason: status.Reason,
+		}}}, nil
+	case chatmessage.PEER_MSG:
+		um, err := encodeUserMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ServerFrame{Frame: &ServerFrame_Message{Message: um}}, nil
+	case chatmessage.PRESENCE_MSG:
+		presence, err := chatmessage.ParsePresence(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ServerFrame{Frame: &ServerFrame_Presence{Presence: &Presence{
+			Key:      presence.Key,
+			Status:   string(presence.Status),
+			LastSeen: presence.LastSeen,
+		}}}, nil
+	case chatmessage.PING_MSG:
+		ping, err := encodeHeartbeat(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ServerFrame{Frame: &ServerFrame_Ping{Ping: ping}}, nil
+	case chatmessage.PONG_MSG:
+		pong, err := encodeHeartbeat(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &ServerFrame{Frame: &ServerFrame_Pong{Pong: pong}}, nil
+	default:
+		return &ServerFrame{Frame: &ServerFrame_Other{Other: &ChatMessage{Type: msg.Type, Payload: msg.Payload}}}, nil
+	}
+}
+
+func DecodeServerFrame(frame *ServerFrame) (*chatmessage.ChatMessage, error) {
+	switch f := frame.GetFrame().(type) {
+	case *ServerFrame_Challenge:
+		return chatmessage.NewChatMessage(chatmessage.CHALLENGE_MSG, &chatmessage.Challenge{
+			Nonce:     f.Challenge.GetNonce(),
+			ServerID:  f.Challenge.GetServerId(),
+			Timestamp: f.Challenge.GetTimestamp(),
+			Codecs:    f.Challenge.GetCodecs(),
+		})
+	case *ServerFrame_Status:
+		return chatmessage.NewChatMessage(chatmessage.STATUS_MSG, &chatmessage.Status{
+			Code:   chatmessage.StatusCode(f.Status.GetCode()),
+			Reason: f.Status.GetReason(),
+		})
+	case *ServerFrame_Message:
+		return decodeUserMessage(f.Message)
+	case *ServerFrame_Presence:
+		return chatmessage.NewChatMessage(chatmessage.PRESENCE_MSG, &chatmessage.Presence{
+			Key:      f.Presence.GetKey(),
+			Status:   chatmessage.PresenceStatus(f.Presence.GetStatus()),
+			LastSeen: f.Presence.GetLastSeen(),
+		})
+	case *ServerFrame_Ping:
+		return decodeHeartbeat(chatmessage.PING_MSG, f.Ping)
+	case *ServerFrame_Pong:
+		return decodeHeartbeat(chatmessage.PONG_MSG, f.Pong)
+	case *ServerFrame_Other:
+		return &chatmessage.ChatMessage{Type: f.Other.GetType(), Payload: f.Other.GetPayload()}, nil
+	default:
+		return nil, EmptyFrameError
+	}
+}
+
+// encodeUserMessage only parses the payload of envelopes that came as JSON
+func encodeUserMessage(msg *chatmessage.ChatMessage) (*UserMessage, error) {
+	um := msg.User
+	if um == nil {
+		var err error
+		um, err = user_message.ParseFromJSON(msg.Payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &UserMessage{
+		Version:       int32(um.Version()),
+		Type:          um.Type(),
+		Id:            um.ID(),
+		Timestamp:     um.Timestamp(),
+		Signature:     um.Signature(),
+		FromPublicKey: um.FromPublicKey(),
+		ToPublicKey:   um.ToPublicKey(),
+		Message:       um.Message(),
+		Room:          um.Room(),
+	}, nil
+}
+
+func decodeUserMessage(m *UserMessage) (*chatmessage.ChatMessage, error) {
+	um := user_message.NewUserMessage(
+		user_message.WithVersion(int(m.GetVersion())),
+		user_message.WithType(m.GetType()),
+		user_message.WithID(m.GetId()),
+		user_message.WithTimestamp(m.GetTimestamp()),
+		user_message.WithSignature(m.GetSignature()),
+		user_message.WithFromPublicKey(m.GetFromPublicKey()),
+		user_message.WithToPublicKey(m.GetToPublicKey()),
+		user_message.WithMessage(m.GetMessage()),
+		user_message.WithRoom(m.GetRoom()))
+
+	return &chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, User: um}, nil
+}
+
+func encodeHeartbeat(msg *chatmessage.ChatMessage) (*Heartbeat, error) {
+	heartbeat, err := chatmessage.ParseHeartbeat(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &Heartbeat{Seq: heartbeat.Seq, Timestamp: heartbeat.Timestamp}, nil
+}
+
+func decodeHeartbeat(msgType string, heartbeat *Heartbeat) (*chatmessage.ChatMessage, error) {
+	return chatmessage.NewChatMessage(msgType, &chatmessage.Heartbeat{
+		Seq:       heartbeat.GetSeq(),
+		Timestamp: heartbeat.GetTimestamp(),
+	})
+}
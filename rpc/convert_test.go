@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"encoding/json"
+	chatmessage "pogchat/chat_message"
+	"pogchat/key"
+	"pogchat/user_message"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestConvert(t *testing.T) {
+	newMessage := func(t *testing.T, msgType string, payload interface{}) *chatmessage.ChatMessage {
+		msg, err := chatmessage.NewChatMessage(msgType, payload)
+		assert.Nil(t, err)
+		return msg
+	}
+
+	// signed builds a peer message that only verifies if every field made
+	// it through
+	signed := func(t *testing.T) *chatmessage.ChatMessage {
+		from, err := key.NewEd25519KeyPair()
+		assert.Nil(t, err)
+		to, err := key.NewEd25519KeyPair()
+		assert.Nil(t, err)
+
+		um := user_message.NewUserMessage(
+			user_message.WithFromPublicKey(from.PublicKey()),
+			user_message.WithToPublicKey(to.PublicKey()),
+			user_message.WithMessage([]byte("ciphertext")),
+			user_message.WithRoom("friends"))
+		_, err = um.Sign(from.PrivateKey())
+		assert.Nil(t, err)
+
+		payload, err := um.MarshalJSON()
+		assert.Nil(t, err)
+		return &chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, Payload: string(payload)}
+	}
+
+	// envelope compares messages by their JSON form, decoded peer messages
+	// only have it on demand
+	envelope := func(t *testing.T, msg *chatmessage.ChatMessage) string {
+		b, err := msg.Envelope()
+		assert.Nil(t, err)
+		return string(b)
+	}
+
+	// overWire marshals a frame like the stream would
+	overWire := func(t *testing.T, in proto.Message, out proto.Message) {
+		b, err := proto.Marshal(in)
+		assert.Nil(t, err)
+		assert.Nil(t, proto.Unmarshal(b, out))
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "client messages survive the round trip",
+			f: func(t *testing.T) {
+				msgs := []*chatmessage.ChatMessage{
+					newMessage(t, chatmessage.LOGIN_MSG, &chatmessage.Login{
+						PublicKey:       []byte("key"),
+						Nonce:           []byte("nonce"),
+						ServerID:        "server",
+						Timestamp:       42,
+						DeviceID:        "laptop",
+						DeviceKey:       []byte("device key"),
+						Signature:       []byte("signature"),
+						DeviceSignature: []byte("device signature"),
+					}),
+					newMessage(t, chatmessage.PRESENCE_SUB_MSG, &chatmessage.PresenceSubscribe{Keys: [][]byte{[]byte("alice")}}),
+					newMessage(t, chatmessage.PING_MSG, &chatmessage.Heartbeat{Seq: 1, Timestamp: 2}),
+					newMessage(t, chatmessage.PONG_MSG, &chatmessage.Heartbeat{Seq: 1, Timestamp: 3}),
+					newMessage(t, chatmessage.ROOM_OP_MSG, map[string]string{"room": "friends"}),
+					signed(t),
+				}
+
+				for _, msg := range msgs {
+					frame, err := EncodeClientFrame(msg)
+					assert.Nil(t, err)
+					got := &ClientFrame{}
+					overWire(t, frame, got)
+
+					decoded, err := DecodeClientFrame(got)
+					assert.Nil(t, err)
+					assert.Equal(t, envelope(t, msg), envelope(t, decoded), msg.Type)
+				}
+			},
+		},
+		{
+			name: "server messages survive the round trip",
+			f: func(t *testing.T) {
+				status, err := chatmessage.NewStatusMessage(chatmessage.QUEUED, "recipient is offline")
+				assert.Nil(t, err)
+				msgs := []*chatmessage.ChatMessage{
+					newMessage(t, chatmessage.CHALLENGE_MSG, &chatmessage.Challenge{Nonce: []byte("nonce"), ServerID: "server", Timestamp: 42}),
+					status,
+					newMessage(t, chatmessage.PRESENCE_MSG, &chatmessage.Presence{Key: []byte("alice"), Status: chatmessage.AWAY, LastSeen: 7}),
+					newMessage(t, chatmessage.PING_MSG, &chatmessage.Heartbeat{Seq: 9, Timestamp: 2}),
+					newMessage(t, chatmessage.DEVICE_LIST_MSG, map[string]string{"devices": "none"}),
+					signed(t),
+				}
+
+				for _, msg := range msgs {
+					frame, err := EncodeServerFrame(msg)
+					assert.Nil(t, err)
+					got := &ServerFrame{}
+					overWire(t, frame, got)
+
+					decoded, err := DecodeServerFrame(got)
+					assert.Nil(t, err)
+					assert.Equal(t, envelope(t, msg), envelope(t, decoded), msg.Type)
+				}
+			},
+		},
+		{
+			name: "converted peer message still verifies",
+			f: func(t *testing.T) {
+				frame, err := EncodeServerFrame(signed(t))
+				assert.Nil(t, err)
+				msg, err := DecodeServerFrame(frame)
+				assert.Nil(t, err)
+
+				payload, err := msg.PeerPayload()
+				assert.Nil(t, err)
+				um, err := user_message.ParseFromJSON(payload)
+				assert.Nil(t, err)
+				assert.Nil(t, um.Verify())
+				assert.Equal(t, "friends", um.Room())
+			},
+		},
+		{
+			name: "peer messages stay decoded between frames",
+			f: func(t *testing.T) {
+				frame, err := EncodeClientFrame(signed(t))
+				assert.Nil(t, err)
+				msg, err := DecodeClientFrame(frame)
+				assert.Nil(t, err)
+				assert.Empty(t, msg.Payload, "peer message must not be turned into JSON")
+				assert.Nil(t, msg.User.Verify())
+
+				out, err := EncodeServerFrame(msg)
+				assert.Nil(t, err)
+				assert.True(t, proto.Equal(frame.GetSend(), out.GetMessage()))
+			},
+		},
+		{
+			name: "malformed and empty frames are refused",
+			f: func(t *testing.T) {
+				_, err := EncodeClientFrame(&chatmessage.ChatMessage{Type: chatmessage.LOGIN_MSG, Payload: "{"})
+				var syntaxErr *json.SyntaxError
+				assert.ErrorAs(t, err, &syntaxErr)
+
+				_, err = DecodeClientFrame(&ClientFrame{})
+				assert.ErrorIs(t, err, EmptyFrameError)
+				_, err = DecodeServerFrame(&ServerFrame{})
+				assert.ErrorIs(t, err, EmptyFrameError)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
@@ -0,0 +1,137 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.21.12
+// source: pogchat.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// RelayClient is the client API for Relay service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RelayClient interface {
+	Session(ctx context.Context, opts ...grpc.CallOption) (Relay_SessionClient, error)
+}
+
+type relayClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRelayClient(cc grpc.ClientConnInterface) RelayClient {
+	return &relayClient{cc}
+}
+
+func (c *relayClient) Session(ctx context.Context, opts ...grpc.CallOption) (Relay_SessionClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Relay_ServiceDesc.Streams[0], "/pogchat.v1.Relay/Session", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &relaySessionClient{stream}
+	return x, nil
+}
+
+type Relay_SessionClient interface {
+	Send(*ClientFrame) error
+	Recv() (*ServerFrame, error)
+	grpc.ClientStream
+}
+
+type relaySessionClient struct {
+	grpc.ClientStream
+}
+
+func (x *relaySessionClient) Send(m *ClientFrame) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *relaySessionClient) Recv() (*ServerFrame, error) {
+	m := new(ServerFrame)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RelayServer is the server API for Relay service.
+// All implementations must embed UnimplementedRelayServer
+// for forward compatibility
+type RelayServer interface {
+	Session(Relay_SessionServer) error
+	mustEmbedUnimplementedRelayServer()
+}
+
+// UnimplementedRelayServer must be embedded to have forward compatible implementations.
+type UnimplementedRelayServer struct {
+}
+
+func (UnimplementedRelayServer) Session(Relay_SessionServer) error {
+	return status.Errorf(codes.Unimplemented, "method Session not implemented")
+}
+func (UnimplementedRelayServer) mustEmbedUnimplementedRelayServer() {}
+
+// UnsafeRelayServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RelayServer will
+// result in compilation errors.
+type UnsafeRelayServer interface {
+	mustEmbedUnimplementedRelayServer()
+}
+
+func RegisterRelayServer(s grpc.ServiceRegistrar, srv RelayServer) {
+	s.RegisterService(&Relay_ServiceDesc, srv)
+}
+
+func _Relay_Session_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RelayServer).Session(&relaySessionServer{stream})
+}
+
+type Relay_SessionServer interface {
+	Send(*ServerFrame) error
+	Recv() (*ClientFrame, error)
+	grpc.ServerStream
+}
+
+type relaySessionServer struct {
+	grpc.ServerStream
+}
+
+func (x *relaySessionServer) Send(m *ServerFrame) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *relaySessionServer) Recv() (*ClientFrame, error) {
+	m := new(ClientFrame)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Relay_ServiceDesc is the grpc.ServiceDesc for Relay service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Relay_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pogchat.v1.Relay",
+	HandlerType: (*RelayServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Session",
+			Handler:       _Relay_Session_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pogchat.proto",
+}
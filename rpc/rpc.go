@@ -0,0 +1,149 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"pogchat/client"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pogchat.proto
+
+const (
+	// KEEPALIVE_TIME is how often an idle transport is pinged, it stands in
+	// for the read deadlines streams do not have
+	KEEPALIVE_TIME    = 30 * time.Second
+	KEEPALIVE_TIMEOUT = 10 * time.Second
+)
+
+// Listener serves the Relay service and hands out every Session call as a
+// connection
+type Listener struct {
+	UnimplementedRelayServer
+	listener net.Listener
+	srv      *grpc.Server
+	conns    chan client.Conn
+	done     chan struct{}
+	once     sync.Once
+}
+
+// Listen serves the Relay service on address, over TLS when config is set,
+// messages larger than maxMessageSize end the call
+func Listen(address string, config *tls.Config, maxMessageSize int) (*Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(maxMessageSize),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    KEEPALIVE_TIME,
+			Timeout: KEEPALIVE_TIMEOUT,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             KEEPALIVE_TIME / 2,
+			PermitWithoutStream: true,
+		}),
+	}
+	if config != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+
+	l := &Listener{
+		listener: listener,
+		srv:      grpc.NewServer(opts...),
+		conns:    make(chan client.Conn),
+		done:     make(chan struct{}),
+	}
+	RegisterRelayServer(l.srv, l)
+
+	go func() {
+		err := l.srv.Serve(listener)
+		if err != nil {
+			log.Printf("[rpc.Listen] srv.Serve() returned error: %+v\n", err)
+		}
+		l.Close()
+	}()
+
+	return l, nil
+}
+
+// Session lasts until the connection manager closes the connection or the
+// client goes away
+func (l *Listener) Session(stream Relay_SessionServer) error {
+	conn := newServerConn(stream)
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+
+	select {
+	case <-conn.closed:
+	case <-stream.Context().Done():
+	}
+	return nil
+}
+
+func (l *Listener) Accept() (client.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting and ends every call
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+		l.srv.Stop()
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Dial opens a Session on the Relay service at address, over TLS when
+// config is set
+func Dial(address string, config *tls.Config, maxMessageSize int) (client.Conn, error) {
+	creds := insecure.NewCredentials()
+	if config != nil {
+		creds = credentials.NewTLS(config)
+	}
+
+	conn, err := grpc.Dial(address,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize)),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    KEEPALIVE_TIME,
+			Timeout: KEEPALIVE_TIMEOUT,
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := NewRelayClient(conn).Session(ctx)
+	if err != nil {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+
+	return &clientConn{conn: conn, stream: stream, cancel: cancel}, nil
+}
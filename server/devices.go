@@ -0,0 +1,327 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DEVICE_ID_SIZE    = 8
+	MAX_DEVICE_ID_LEN = 64
+	// MAX_DEVICES bounds how many devices are remembered per key, the one
+	// seen least recently is forgotten to make room
+	MAX_DEVICES = 32
+	// EPHEMERAL_DEVICE_PREFIX marks the ids handed to connections that do
+	// not send one, such devices are forgotten as soon as they log out
+	EPHEMERAL_DEVICE_PREFIX = "session-"
+)
+
+var (
+	DeviceRevokedError       = errors.New("this device was revoked")
+	UnknownDeviceError       = errors.New("no such device")
+	RevokeCurrentDeviceError = errors.New("can not revoke the device in use, revoke it from another one")
+	InvalidDeviceIDError     = errors.New("device id is too long or reserved")
+	TooManyDevicesError      = errors.New("too many devices are logged in with this key")
+	DeviceKeyError           = errors.New("login must carry an ed25519 device key and be signed with it")
+	DeviceKeyMismatchError   = errors.New("device id is bound to another device key")
+	MultipleDevicesError     = errors.New("forward secret sessions need a single device on both ends, revoke the others")
+)
+
+// device is every connection a key logged in from under the same device
+// id, it is kept after logout so it can be listed and revoked
+//
+// every device logs in with a key of its own vouched for by the identity
+// signature on the login, the id stays bound to the key it was first seen
+// with and revoking it locks that key out through Revocations, whoever
+// still holds the identity key can vouch for a new device key though, so a
+// leaked identity key still means replacing it
+type device struct {
+	id        string
+	key       []byte
+	firstSeen time.Time
+	lastSeen  time.Time
+	revoked   bool
+}
+
+func newDeviceID() string {
+	id := make([]byte, DEVICE_ID_SIZE)
+	_, err := rand.Read(id)
+	if err != nil {
+		panic(err)
+	}
+	return EPHEMERAL_DEVICE_PREFIX + hex.EncodeToString(id)
+}
+
+func ephemeral(id string) bool {
+	return strings.HasPrefix(id, EPHEMERAL_DEVICE_PREFIX)
+}
+
+func (man *connManager) handleDevices(c client.Client, chatMsg *chatmessage.ChatMessage) error {
+	if !c.LoggedIn() {
+		man.sendStatus(c, chatmessage.NOT_LOGGED_IN, "login before managing devices")
+		return NotLoggedInError
+	}
+
+	man.broadcast <- &outgoing{from: c, msg: chatMsg}
+
+	return nil
+}
+
+// attach adds a logged in connection to the devices of its key, a second
+// login from the same device replaces the first one, first reports whether
+// the key just came online
+func (man *connManager) attach(pk string, c client.Client) (first bool, err error) {
+	if man.devices[pk] == nil {
+		man.devices[pk] = make(map[string]*device)
+	}
+
+	if man.revocations.Revoked(c.PublicKey(), c.DeviceKey()) {
+		return false, DeviceRevokedError
+	}
+
+	now := time.Now()
+	dev, ok := man.devices[pk][c.DeviceID()]
+	if !ok {
+		if len(man.devices[pk]) >= MAX_DEVICES && !man.forgetDevice(pk) {
+			return false, TooManyDevicesError
+		}
+		dev = &device{id: c.DeviceID(), key: c.DeviceKey(), firstSeen: now}
+		man.devices[pk][dev.id] = dev
+	}
+
+	if dev.revoked {
+		return false, DeviceRevokedError
+	}
+	if !bytes.Equal(dev.key, c.DeviceKey()) {
+		return false, DeviceKeyMismatchError
+	}
+	dev.lastSeen = now
+
+	if man.logged[pk] == nil {
+		man.logged[pk] = make(map[string]client.Client)
+		first = true
+	}
+
+	if old, ok := man.logged[pk][dev.id]; ok && old != c {
+		man.detachClient(old, "logged in again from the same device")
+	}
+
+	man.logged[pk][dev.id] = c
+	return first, nil
+}
+
+// detach removes a connection from the devices of its key and reports
+// whether it was the last one
+func (man *connManager) detach(pk string, c client.Client) bool {
+	devices, ok := man.logged[pk]
+	if !ok || devices[c.DeviceID()] != c {
+		return false
+	}
+
+	delete(devices, c.DeviceID())
+	if dev, ok := man.devices[pk][c.DeviceID()]; ok {
+		dev.lastSeen = time.Now()
+	}
+	if ephemeral(c.DeviceID()) {
+		man.dropDevice(pk, c.DeviceID())
+	}
+
+	if len(devices) > 0 {
+		return false
+	}
+
+	delete(man.logged, pk)
+	return true
+}
+
+// forgetDevice drops the offline device of pk seen least recently and
+// reports whether there was one
+func (man *connManager) forgetDevice(pk string) bool {
+	var oldest *device
+	for id, dev := range man.devices[pk] {
+		if _, online := man.logged[pk][id]; online {
+			continue
+		}
+		if oldest == nil || dev.lastSeen.Before(oldest.lastSeen) {
+			oldest = dev
+		}
+	}
+
+	if oldest == nil {
+		return false
+	}
+	man.dropDevice(pk, oldest.id)
+	return true
+}
+
+// dropDevice forgets a device together with the sync copies waiting for it
+func (man *connManager) dropDevice(pk string, id string) {
+	delete(man.devices[pk], id)
+	if len(man.devices[pk]) == 0 {
+		delete(man.devices, pk)
+	}
+
+	_, err := man.mailbox.Drain(deviceBox(pk, id))
+	if err != nil {
+		log.Printf("[server.dropDevice] mailbox.Drain() returned error: %+v\n", err)
+	}
+}
+
+// detachClient logs a connection out without closing it, it goes back to
+// the unauthenticated clients and may only log in again with a fresh
+// challenge
+func (man *connManager) detachClient(c client.Client, reason string) {
+	pk := base64.RawStdEncoding.EncodeToString(c.PublicKey())
+	if devices, ok := man.logged[pk]; ok && devices[c.DeviceID()] == c {
+		delete(devices, c.DeviceID())
+		if ephemeral(c.DeviceID()) {
+			man.dropDevice(pk, c.DeviceID())
+		}
+	}
+
+	// a connection that is already closing is left to Unregister
+	err := c.Transition(client.AUTHENTICATED, client.CONNECTED)
+	if err != nil {
+		log.Printf("[server.detachClient] c.Transition() returned error: %+v\n", err)
+		return
+	}
+	man.clients[c] = true
+	man.sendStatus(c, chatmessage.DEVICE_REVOKED, reason)
+	man.issueChallenge(c)
+}
+
+// sharedKey reports whether more than one device that is not revoked uses
+// pk, ratchet sessions are kept per key on the client so every device of
+// the key would hold its own copy and they would keep replacing each other
+func (man *connManager) sharedKey(pk string) bool {
+	count := 0
+	for _, dev := range man.devices[pk] {
+		if !dev.revoked {
+			count++
+		}
+	}
+	return count > 1
+}
+
+// writeAll sends a message to every device of a key, except skips the
+// connection it came from, it reports whether any device got it
+func (man *connManager) writeAll(pk string, except client.Client, msg *chatmessage.ChatMessage) bool {
+	delivered := false
+	for _, c := range man.logged[pk] {
+		if c == except {
+			continue
+		}
+		man.write(c, msg)
+		delivered = true
+	}
+	return delivered
+}
+
+// deviceBox is the mailbox of a single device, unlike the one of its key it
+// is only drained by that device, the separator is not part of the base64
+// alphabet so it can never be taken for another key
+func deviceBox(pk string, id string) string {
+	return pk + ":" + id
+}
+
+// syncDevices hands a copy of a message sent by one device to every other
+// device of the key, offline ones get it in their own mailbox so a copy
+// never comes back to the device that sent it
+func (man *connManager) syncDevices(from client.Client, pk string, msg *chatmessage.ChatMessage) {
+	for id, dev := range man.devices[pk] {
+		if id == from.DeviceID() || dev.revoked {
+			continue
+		}
+
+		if c, ok := man.logged[pk][id]; ok {
+			man.write(c, msg)
+			continue
+		}
+
+		payload, err := msg.PeerPayload()
+		if err == nil {
+			err = man.mailbox.Push(deviceBox(pk, id), []byte(payload))
+		}
+		if err != nil {
+			log.Printf("[server.syncDevices] could not queue sync copy: %+v\n", err)
+		}
+	}
+}
+
+func (man *connManager) listDevices(out *outgoing) {
+	pk := base64.RawStdEncoding.EncodeToString(out.from.PublicKey())
+
+	list := &chatmessage.DeviceList{}
+	for id, dev := range man.devices[pk] {
+		c, online := man.logged[pk][id]
+		list.Devices = append(list.Devices, &chatmessage.Device{
+			ID:        id,
+			FirstSeen: dev.firstSeen.Unix(),
+			LastSeen:  dev.lastSeen.Unix(),
+			Online:    online,
+			Current:   c == out.from,
+			Revoked:   dev.revoked,
+		})
+	}
+	sort.Slice(list.Devices, func(i, j int) bool { return list.Devices[i].FirstSeen < list.Devices[j].FirstSeen })
+
+	msg, err := chatmessage.NewChatMessage(chatmessage.DEVICE_LIST_MSG, list)
+	if err != nil {
+		log.Printf("[server.listDevices] NewChatMessage() returned error: %+v\n", err)
+		return
+	}
+	man.write(out.from, msg)
+}
+
+func (man *connManager) revokeDevice(out *outgoing) {
+	revoke, err := chatmessage.ParseDeviceRevoke(out.msg)
+	if err != nil {
+		man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, "could not parse device revocation")
+		return
+	}
+
+	if revoke.ID == out.from.DeviceID() {
+		man.sendStatus(out.from, chatmessage.DEVICE_REVOKED, RevokeCurrentDeviceError.Error())
+		return
+	}
+
+	pk := base64.RawStdEncoding.EncodeToString(out.from.PublicKey())
+	dev, ok := man.devices[pk][revoke.ID]
+	if !ok {
+		man.sendStatus(out.from, chatmessage.DEVICE_REVOKED, UnknownDeviceError.Error())
+		return
+	}
+
+	// the revocation is kept apart from the device record so forgetting the
+	// record to make room can never let the device key back in
+	err = man.revocations.Revoke(&Revocation{
+		PublicKey: out.from.PublicKey(),
+		DeviceKey: dev.key,
+		DeviceID:  dev.id,
+		RevokedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("[server.revokeDevice] revocations.Revoke() returned error: %+v\n", err)
+	}
+
+	dev.revoked = true
+	_, err = man.mailbox.Drain(deviceBox(pk, revoke.ID))
+	if err != nil {
+		log.Printf("[server.revokeDevice] mailbox.Drain() returned error: %+v\n", err)
+	}
+
+	if c, ok := man.logged[pk][revoke.ID]; ok {
+		man.detachClient(c, DeviceRevokedError.Error())
+	}
+
+	man.listDevices(out)
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	keys "pogchat/key"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevices(t *testing.T) {
+	key := []byte("alice")
+	pk := base64.RawStdEncoding.EncodeToString(key)
+
+	// devices get a key named after their id unless deviceKey is given
+	deviceWithKey := func(id string, deviceKey string) client.Client {
+		c := client.NewClient()
+		c.SetPublicKey(key)
+		c.SetDeviceID(id)
+		c.SetDeviceKey([]byte(deviceKey))
+		c.SetLoggedIn(true)
+		go func() {
+			for range c.WriteToChan() {
+			}
+		}()
+		return c
+	}
+	device := func(id string) client.Client {
+		return deviceWithKey(id, "key of "+id)
+	}
+
+	revoke := func(man *connManager, from client.Client, id string) {
+		msg, err := chatmessage.NewChatMessage(chatmessage.DEVICE_REVOKE_MSG, &chatmessage.DeviceRevoke{ID: id})
+		assert.Nil(t, err)
+		man.revokeDevice(&outgoing{from: from, msg: msg})
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "every device is logged in",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				first, err := man.attach(pk, device("laptop"))
+				assert.Nil(t, err)
+				assert.True(t, first, "first device brings the key online")
+
+				first, err = man.attach(pk, device("desktop"))
+				assert.Nil(t, err)
+				assert.False(t, first, "second device must not")
+				assert.Len(t, man.logged[pk], 2)
+			},
+		},
+		{
+			name: "same device replaces its old connection",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				old, fresh := device("laptop"), device("laptop")
+				man.attach(pk, old)
+				man.attach(pk, fresh)
+
+				assert.Len(t, man.logged[pk], 1)
+				assert.Equal(t, fresh, man.logged[pk]["laptop"])
+				assert.False(t, old.LoggedIn(), "old connection must be logged out")
+			},
+		},
+		{
+			name: "key goes offline with its last device",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				laptop, desktop := device("laptop"), device("desktop")
+				man.attach(pk, laptop)
+				man.attach(pk, desktop)
+
+				assert.False(t, man.detach(pk, laptop))
+				assert.True(t, man.detach(pk, desktop))
+				assert.Empty(t, man.logged)
+				assert.Len(t, man.devices[pk], 2, "devices must be remembered after logout")
+			},
+		},
+		{
+			name: "sync copies wait for offline devices only",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				laptop, desktop, phone := device("laptop"), device("desktop"), device("phone")
+				man.attach(pk, laptop)
+				man.attach(pk, desktop)
+				man.attach(pk, phone)
+				man.detach(pk, desktop)
+				man.detach(pk, phone)
+
+				man.deliver(laptop, pk, &chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, Payload: "copy"})
+				for _, box := range []string{pk, deviceBox(pk, "laptop")} {
+					payloads, err := man.mailbox.Drain(box)
+					assert.Nil(t, err)
+					assert.Empty(t, payloads, "a copy must not come back to its sender")
+				}
+				for _, id := range []string{"desktop", "phone"} {
+					payloads, err := man.mailbox.Drain(deviceBox(pk, id))
+					assert.Nil(t, err)
+					assert.Equal(t, [][]byte{[]byte("copy")}, payloads)
+				}
+			},
+		},
+		{
+			name: "devices without an id are forgotten at logout",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				laptop, anonymous := device("laptop"), device(newDeviceID())
+				man.attach(pk, laptop)
+				man.attach(pk, anonymous)
+
+				man.detach(pk, anonymous)
+				assert.Len(t, man.devices[pk], 1)
+				assert.Contains(t, man.devices[pk], "laptop")
+			},
+		},
+		{
+			name: "remembered devices are bounded",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				online := make([]client.Client, 0, MAX_DEVICES)
+				for i := 0; i < MAX_DEVICES; i++ {
+					c := device(fmt.Sprintf("device-%d", i))
+					_, err := man.attach(pk, c)
+					assert.Nil(t, err)
+					online = append(online, c)
+				}
+
+				_, err := man.attach(pk, device("one too many"))
+				assert.Equal(t, TooManyDevicesError, err, "online devices must not be forgotten")
+
+				man.detach(pk, online[0])
+				_, err = man.attach(pk, device("one too many"))
+				assert.Nil(t, err)
+				assert.Len(t, man.devices[pk], MAX_DEVICES)
+				assert.NotContains(t, man.devices[pk], "device-0", "offline device must make room")
+			},
+		},
+		{
+			name: "revoked device can not log in",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				laptop, desktop := device("laptop"), device("desktop")
+				man.attach(pk, laptop)
+				man.attach(pk, desktop)
+
+				man.devices[pk]["desktop"].revoked = true
+				man.detachClient(desktop, DeviceRevokedError.Error())
+				assert.False(t, desktop.LoggedIn())
+				assert.Len(t, man.logged[pk], 1)
+
+				_, err := man.attach(pk, device("desktop"))
+				assert.Equal(t, DeviceRevokedError, err)
+			},
+		},
+
+		{
+			name: "revoked device key can not come back under another id",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				laptop, phone := device("laptop"), device("phone")
+				man.attach(pk, laptop)
+				man.attach(pk, phone)
+				revoke(man, laptop, "phone")
+
+				_, err := man.attach(pk, deviceWithKey("tablet", "key of phone"))
+				assert.Equal(t, DeviceRevokedError, err)
+				_, err = man.attach(pk, device("tablet"))
+				assert.Nil(t, err, "another device key is not revoked")
+			},
+		},
+		{
+			name: "forgetting devices does not lift a revocation",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				laptop, phone := device("laptop"), device("phone")
+				man.attach(pk, laptop)
+				man.attach(pk, phone)
+				revoke(man, laptop, "phone")
+
+				for i := 0; i < MAX_DEVICES; i++ {
+					c := device(fmt.Sprintf("device-%d", i))
+					_, err := man.attach(pk, c)
+					assert.Nil(t, err)
+					man.detach(pk, c)
+				}
+				assert.NotContains(t, man.devices[pk], "phone", "revoked record must have made room")
+
+				_, err := man.attach(pk, device("phone"))
+				assert.Equal(t, DeviceRevokedError, err)
+			},
+		},
+		{
+			name: "revocations survive a restart",
+			f: func(t *testing.T) {
+				fileName := filepath.Join(t.TempDir(), "revocations.json")
+				open := func() *connManager {
+					revocations, err := NewRevocations(fileName)
+					assert.Nil(t, err)
+					return NewConnectionManager(WithRevocations(revocations)).(*connManager)
+				}
+
+				man := open()
+				laptop := device("laptop")
+				man.attach(pk, laptop)
+				man.attach(pk, device("phone"))
+				revoke(man, laptop, "phone")
+
+				_, err := open().attach(pk, device("phone"))
+				assert.Equal(t, DeviceRevokedError, err)
+			},
+		},
+		{
+			name: "login must be signed by its device key",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				go man.Start()
+				pair, err := keys.NewEd25519KeyPair()
+				assert.Nil(t, err)
+				p := connect(t, man)
+
+				msg, err := p.read(chatmessage.CHALLENGE_MSG)
+				assert.Nil(t, err)
+				challenge, err := chatmessage.ParseChallenge(msg)
+				assert.Nil(t, err)
+
+				login := &chatmessage.Login{
+					PublicKey: pair.PublicKey(),
+					Nonce:     challenge.Nonce,
+					ServerID:  challenge.ServerID,
+					Timestamp: time.Now().Unix(),
+					DeviceID:  "laptop",
+				}
+				assert.Nil(t, signLogin(pair, login))
+				login.DeviceSignature = nil
+				msg, err = chatmessage.NewChatMessage(chatmessage.LOGIN_MSG, login)
+				assert.Nil(t, err)
+				assert.Nil(t, p.write(msg))
+
+				msg, err = p.read(chatmessage.STATUS_MSG)
+				assert.Nil(t, err)
+				status, err := chatmessage.ParseStatus(msg)
+				assert.Nil(t, err)
+				assert.Equal(t, chatmessage.LOGIN_FAILED, status.Code)
+				assert.Equal(t, DeviceKeyError.Error(), status.Reason)
+			},
+		},
+		{
+			name: "device id stays bound to its key",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				laptop := device("laptop")
+				man.attach(pk, laptop)
+				man.detach(pk, laptop)
+
+				_, err := man.attach(pk, deviceWithKey("laptop", "another key"))
+				assert.Equal(t, DeviceKeyMismatchError, err)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"pogchat/key"
+	"pogchat/user_message"
+	"time"
+)
+
+const (
+	NONCE_SIZE            = 32
+	DEFAULT_CHALLENGE_TTL = 30 * time.Second
+	DEFAULT_MESSAGE_SKEW  = 5 * time.Minute
+	REPLAY_CACHE_SIZE     = 65536
+)
+
+var (
+	NotLoggedInError       = errors.New("client is not logged in")
+	AlreadyLoggedInError   = errors.New("client is already logged in")
+	NoChallengeError       = errors.New("there is no outstanding challenge for this client")
+	ChallengeMismatchError = errors.New("login does not answer the issued challenge")
+	StaleChallengeError    = errors.New("challenge has expired")
+	StaleLoginError        = errors.New("login timestamp is too far from server time")
+	SenderMismatchError    = errors.New("message is not from the logged in key")
+	StaleMessageError      = errors.New("message timestamp is too far from server time")
+	ReplayedMessageError   = errors.New("message was already relayed")
+)
+
+func newServerID() string {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+func (man *connManager) issueChallenge(c client.Client) {
+	nonce := make([]byte, NONCE_SIZE)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		log.Printf("[server.issueChallenge] rand.Read() returned error: %+v\n", err)
+		return
+	}
+
+	challenge := &chatmessage.Challenge{
+		Nonce:     nonce,
+		ServerID:  man.serverID,
+		Timestamp: time.Now().Unix(),
+		Codecs:    man.codecs,
+	}
+
+	msg, err := chatmessage.NewChatMessage(chatmessage.CHALLENGE_MSG, challenge)
+	if err != nil {
+		log.Printf("[server.issueChallenge] NewChatMessage() returned error: %+v\n", err)
+		return
+	}
+
+	c.SetChallenge(challenge)
+	man.write(c, msg)
+}
+
+// checkLogin validates a login against the challenge it claims to answer,
+// the challenge is consumed by the caller before this runs so a captured
+// login can never be accepted twice
+func (man *connManager) checkLogin(challenge *chatmessage.Challenge, login *chatmessage.Login) error {
+	if challenge == nil {
+		return NoChallengeError
+	}
+
+	if !bytes.Equal(challenge.Nonce, login.Nonce) || challenge.ServerID != login.ServerID {
+		return ChallengeMismatchError
+	}
+
+	now := time.Now()
+	if now.Sub(time.Unix(challenge.Timestamp, 0)) > man.challengeTTL {
+		return StaleChallengeError
+	}
+
+	skew := now.Sub(time.Unix(login.Timestamp, 0))
+	if skew > man.challengeTTL || skew < -man.challengeTTL {
+		return StaleLoginError
+	}
+
+	_, err := signer.Verify(login.PublicKey, login.SigningBytes(), login.Signature)
+	if err != nil {
+		return err
+	}
+
+	// the identity signature covers the device key, the device signature
+	// shows the connection holds its private half
+	if key.PublicKeyType(login.DeviceKey) != key.ED25519_PUBLIC_KEY {
+		return DeviceKeyError
+	}
+	_, err = signer.Verify(login.DeviceKey, login.DeviceSigningBytes(), login.DeviceSignature)
+	if err != nil {
+		return DeviceKeyError
+	}
+
+	return nil
+}
+
+// checkMessage authenticates a peer message before it is routed, the
+// signature must cover the routing metadata, come from the key that owns
+// the connection and not be a replay of something already relayed, ratchet
+// messages are refused while either key is used from several devices
+func (man *connManager) checkMessage(from client.Client, um user_message.UserMessage) error {
+	err := um.Verify()
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(um.FromPublicKey(), from.PublicKey()) {
+		return SenderMismatchError
+	}
+
+	skew := time.Since(time.Unix(um.Timestamp(), 0))
+	if skew > man.messageSkew || skew < -man.messageSkew {
+		return StaleMessageError
+	}
+
+	if um.Type() == user_message.RATCHET_MESSAGE {
+		sender := base64.RawStdEncoding.EncodeToString(um.FromPublicKey())
+		recipient := base64.RawStdEncoding.EncodeToString(um.ToPublicKey())
+		if man.sharedKey(sender) || man.sharedKey(recipient) {
+			return MultipleDevicesError
+		}
+	}
+
+	if man.seen.Seen(um.ID()) {
+		return ReplayedMessageError
+	}
+
+	return nil
+}
+
+// rejection is the status reported for a message checkMessage refused
+func rejection(err error) chatmessage.StatusCode {
+	switch {
+	case errors.Is(err, StaleMessageError):
+		return chatmessage.STALE_MESSAGE
+	case errors.Is(err, ReplayedMessageError):
+		return chatmessage.REPLAYED_MESSAGE
+	case errors.Is(err, MultipleDevicesError):
+		return chatmessage.SESSION_REFUSED
+	default:
+		return chatmessage.BAD_SIGNATURE
+	}
+}
+
+func (man *connManager) handleLogin(c client.Client, chatMsg *chatmessage.ChatMessage) error {
+	if c.State() != client.CONNECTED {
+		man.sendStatus(c, chatmessage.LOGIN_FAILED, "already logged in")
+		return AlreadyLoggedInError
+	}
+
+	challenge := c.Challenge()
+	c.SetChallenge(nil)
+
+	login, err := chatmessage.ParseLogin(chatMsg)
+	if err != nil {
+		man.sendStatus(c, chatmessage.MALFORMED_PAYLOAD, "could not parse login message")
+		man.issueChallenge(c)
+		return err
+	}
+
+	err = man.checkLogin(challenge, login)
+	if err == nil && (len(login.DeviceID) > MAX_DEVICE_ID_LEN || ephemeral(login.DeviceID)) {
+		err = InvalidDeviceIDError
+	}
+	if err != nil {
+		man.sendStatus(c, chatmessage.LOGIN_FAILED, err.Error())
+		man.issueChallenge(c)
+		return err
+	}
+
+	// connections that do not send an id count as a device of their own
+	// until they log out
+	deviceID := login.DeviceID
+	if deviceID == "" {
+		deviceID = newDeviceID()
+	}
+
+	c.SetPublicKey(login.PublicKey)
+	c.SetDeviceID(deviceID)
+	c.SetDeviceKey(login.DeviceKey)
+
+	// the routing tables are owned by Start, logging in there keeps the
+	// mailbox flush ordered with messages routed meanwhile and waiting for
+	// it means the next frame already sees the connection authenticated
+	man.Login(c)
+
+	return nil
+}
+
+func (man *connManager) Login(c client.Client) {
+	man.exec(func() {
+		man.login(c)
+	})
+}
+
+func (man *connManager) login(c client.Client) {
+	// the connection may have closed while its login was on the way
+	err := c.Transition(client.CONNECTED, client.AUTHENTICATED)
+	if err != nil {
+		log.Printf("[server.Login] c.Transition() returned error: %+v\n", err)
+		return
+	}
+
+	pk := base64.RawStdEncoding.EncodeToString(c.PublicKey())
+	first, err := man.attach(pk, c)
+	if err != nil {
+		// a connection that started closing meanwhile is left to Unregister
+		terr := c.Transition(client.AUTHENTICATED, client.CONNECTED)
+		if terr != nil {
+			log.Printf("[server.Login] c.Transition() returned error: %+v\n", terr)
+			return
+		}
+		man.sendStatus(c, chatmessage.LOGIN_FAILED, err.Error())
+		man.issueChallenge(c)
+		return
+	}
+	delete(man.clients, c)
+
+	man.sendStatus(c, chatmessage.LOGGED_IN, fmt.Sprintf("login accepted as device %s", c.DeviceID()))
+	man.sendRooms(c, pk)
+	if first {
+		man.goOnline(pk)
+	}
+
+	man.flushMailbox(c, pk)
+	man.flushMailbox(c, deviceBox(pk, c.DeviceID()))
+}
+
+func (man *connManager) handlePeer(c client.Client, chatMsg *chatmessage.ChatMessage) error {
+	if !c.LoggedIn() {
+		man.sendStatus(c, chatmessage.NOT_LOGGED_IN, "login before sending peer messages")
+		return NotLoggedInError
+	}
+
+	man.broadcast <- &outgoing{from: c, msg: chatMsg}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"log"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"time"
+)
+
+const (
+	DEFAULT_HEARTBEAT_INTERVAL = 30 * time.Second
+	DEFAULT_HEARTBEAT_MISSES   = 3
+	DEFAULT_WRITE_TIMEOUT      = 10 * time.Second
+)
+
+const EVICTED_SESSIONS_METRIC = "evicted_sessions"
+
+// handleHeartbeat answers pings, pongs need nothing since reading any frame
+// already counts as a sign of life
+func (man *connManager) handleHeartbeat(c client.Client, chatMsg *chatmessage.ChatMessage) error {
+	if chatMsg.Type == chatmessage.PONG_MSG {
+		return nil
+	}
+
+	ping, err := chatmessage.ParseHeartbeat(chatMsg)
+	if err != nil {
+		man.sendStatus(c, chatmessage.MALFORMED_PAYLOAD, "could not parse ping")
+		return err
+	}
+
+	pong, err := chatmessage.NewPong(ping, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	man.write(c, pong)
+	return nil
+}
+
+// heartbeat pings every session that has been quiet for an interval and
+// evicts the ones that stayed quiet through every allowed miss, half open
+// connections never error on their own
+func (man *connManager) heartbeat(now time.Time) {
+	deadline := man.heartbeatInterval * time.Duration(man.heartbeatMisses)
+
+	check := func(c client.Client) {
+		idle := now.Sub(c.LastRead())
+		if idle >= deadline {
+			log.Printf("[server.heartbeat] evicting session quiet for %s\n", idle.Round(time.Second))
+			metrics.Add(EVICTED_SESSIONS_METRIC, 1)
+			// Receive sees the socket close and unregisters the session
+			c.Close()
+			return
+		}
+
+		if idle < man.heartbeatInterval {
+			return
+		}
+
+		man.pingSeq++
+		ping, err := chatmessage.NewPing(man.pingSeq, now.Unix())
+		if err != nil {
+			log.Printf("[server.heartbeat] NewPing() returned error: %+v\n", err)
+			return
+		}
+		man.write(c, ping)
+	}
+
+	for c := range man.clients {
+		check(c)
+	}
+	for _, devices := range man.logged {
+		for _, c := range devices {
+			check(c)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	const INTERVAL = 20 * time.Millisecond
+
+	queued := func(t *testing.T, c client.Client) []*chatmessage.ChatMessage {
+		got := []*chatmessage.ChatMessage{}
+		for c.QueueLen() > 0 {
+			msg := &chatmessage.ChatMessage{}
+			assert.Nil(t, json.Unmarshal(<-c.WriteToChan(), msg))
+			got = append(got, msg)
+		}
+		return got
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "active session is left alone",
+			f: func(t *testing.T) {
+				man := NewConnectionManager(WithHeartbeat(INTERVAL, 3)).(*connManager)
+				c := client.NewClient()
+				man.clients[c] = true
+
+				man.heartbeat(c.LastRead().Add(INTERVAL / 2))
+				assert.Empty(t, queued(t, c))
+				assert.Equal(t, client.CONNECTED, c.State())
+			},
+		},
+		{
+			name: "quiet session is pinged",
+			f: func(t *testing.T) {
+				man := NewConnectionManager(WithHeartbeat(INTERVAL, 3)).(*connManager)
+				c := client.NewClient()
+				man.clients[c] = true
+
+				man.heartbeat(c.LastRead().Add(INTERVAL))
+				msgs := queued(t, c)
+				assert.Len(t, msgs, 1)
+				assert.Equal(t, chatmessage.PING_MSG, msgs[0].Type)
+				assert.Equal(t, client.CONNECTED, c.State())
+			},
+		},
+		{
+			name: "session missing every heartbeat is evicted",
+			f: func(t *testing.T) {
+				man := NewConnectionManager(WithHeartbeat(INTERVAL, 3)).(*connManager)
+				c := client.NewClient()
+				c.SetLoggedIn(true)
+				man.logged["alice"] = map[string]client.Client{"laptop": c}
+
+				man.heartbeat(c.LastRead().Add(3 * INTERVAL))
+				assert.Equal(t, client.CLOSING, c.State())
+			},
+		},
+		{
+			name: "ping is answered with its sequence",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				c := client.NewClient()
+				ping, err := chatmessage.NewPing(42, time.Now().Unix())
+				assert.Nil(t, err)
+
+				assert.Nil(t, man.handleHeartbeat(c, ping))
+				msgs := queued(t, c)
+				assert.Len(t, msgs, 1)
+				assert.Equal(t, chatmessage.PONG_MSG, msgs[0].Type)
+
+				pong, err := chatmessage.ParseHeartbeat(msgs[0])
+				assert.Nil(t, err)
+				assert.Equal(t, uint64(42), pong.Seq)
+			},
+		},
+		{
+			name: "half open connection is unregistered",
+			f: func(t *testing.T) {
+				man := NewConnectionManager(WithHeartbeat(INTERVAL, 2)).(*connManager)
+				go man.Start()
+
+				// the peer reads its challenge and then goes silent
+				p := connect(t, man)
+				_, err := p.read(chatmessage.CHALLENGE_MSG)
+				assert.Nil(t, err)
+
+				assert.Eventually(t, func() bool { return drained(man) }, time.Second, INTERVAL)
+				assert.Equal(t, client.CLOSED, p.server.State())
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
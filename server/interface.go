@@ -1,17 +1,33 @@
 package server
 
-import "pogchat/client"
+import (
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+)
+
+type MessageHandler func(c client.Client, msg *chatmessage.ChatMessage) error
 
 type ConnectionManager interface {
 	Receive(c client.Client)
 	Send(c client.Client)
 	Register(c client.Client) error
 	Unregister(c client.Client) error
+	Login(c client.Client)
+	Handle(msgType string, handler MessageHandler)
 	Start()
 }
 
+// Revocations remembers the device keys locked out by their identity, a
+// login from one of them is refused for good
+type Revocations interface {
+	Revoke(revocation *Revocation) error
+	Revoked(publicKey []byte, deviceKey []byte) bool
+}
+
 type Server interface {
 	Start()
 }
 
 type ServerOpts func(*server)
+
+type ConnManagerOpts func(*connManager)
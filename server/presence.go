@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"time"
+)
+
+const MAX_PRESENCE_SUBSCRIPTIONS = 256
+
+var (
+	TooManySubscriptionsError = errors.New("too many presence subscriptions")
+	InvalidPresenceError      = errors.New("invalid presence status or visibility")
+)
+
+// presence outlives the connection so last seen can still be answered once
+// a key logs out, like the routing tables it is owned by Start
+type presence struct {
+	status     chatmessage.PresenceStatus
+	lastSeen   time.Time
+	visibility chatmessage.Visibility
+	allowed    map[string]bool
+}
+
+func (p *presence) visibleTo(subscriber string) bool {
+	switch p.visibility {
+	case chatmessage.VISIBLE_TO_NOBODY:
+		return false
+	case chatmessage.VISIBLE_TO_ALLOWED:
+		return p.allowed[subscriber]
+	default:
+		return true
+	}
+}
+
+func (man *connManager) handlePresence(c client.Client, chatMsg *chatmessage.ChatMessage) error {
+	if !c.LoggedIn() {
+		man.sendStatus(c, chatmessage.NOT_LOGGED_IN, "login before using presence")
+		return NotLoggedInError
+	}
+
+	man.broadcast <- &outgoing{from: c, msg: chatMsg}
+
+	return nil
+}
+
+func (man *connManager) presenceOf(pk string) *presence {
+	p, ok := man.presence[pk]
+	if !ok {
+		p = &presence{
+			status:     chatmessage.OFFLINE,
+			visibility: chatmessage.VISIBLE_TO_EVERYONE,
+		}
+		man.presence[pk] = p
+	}
+	return p
+}
+
+// view is the presence of watched as subscriber is allowed to see it
+func (man *connManager) view(watched string, subscriber string) (*chatmessage.ChatMessage, error) {
+	key, err := base64.RawStdEncoding.DecodeString(watched)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &chatmessage.Presence{Key: key, Status: chatmessage.UNKNOWN}
+
+	p, ok := man.presence[watched]
+	if ok && p.visibleTo(subscriber) {
+		event.Status = p.status
+		if p.status == chatmessage.OFFLINE && !p.lastSeen.IsZero() {
+			event.LastSeen = p.lastSeen.Unix()
+		}
+	}
+
+	return chatmessage.NewChatMessage(chatmessage.PRESENCE_MSG, event)
+}
+
+// notifyPresence tells the watchers of pk about a change, watchers pk is
+// hidden from hear nothing at all, even an UNKNOWN event would give away
+// when pk logs in and out
+func (man *connManager) notifyPresence(pk string) {
+	p := man.presenceOf(pk)
+	for subscriber := range man.watchers[pk] {
+		if !p.visibleTo(subscriber) {
+			continue
+		}
+		man.sendView(pk, subscriber)
+	}
+}
+
+func (man *connManager) sendView(pk string, subscriber string) {
+	event, err := man.view(pk, subscriber)
+	if err != nil {
+		log.Printf("[server.sendView] man.view() returned error: %+v\n", err)
+		return
+	}
+	man.writeAll(subscriber, nil, event)
+}
+
+// subscribe replaces every subscription of the sender and answers with the
+// current presence of each key
+func (man *connManager) subscribe(out *outgoing) {
+	sub, err := chatmessage.ParsePresenceSubscribe(out.msg)
+	if err != nil {
+		man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, "could not parse presence subscription")
+		return
+	}
+
+	if len(sub.Keys) > MAX_PRESENCE_SUBSCRIPTIONS {
+		man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, TooManySubscriptionsError.Error())
+		return
+	}
+
+	subscriber := base64.RawStdEncoding.EncodeToString(out.from.PublicKey())
+	man.unsubscribe(subscriber)
+
+	for _, key := range sub.Keys {
+		watched := base64.RawStdEncoding.EncodeToString(key)
+		if man.watchers[watched] == nil {
+			man.watchers[watched] = make(map[string]bool)
+		}
+		man.watchers[watched][subscriber] = true
+		man.watching[subscriber] = append(man.watching[subscriber], watched)
+
+		event, err := man.view(watched, subscriber)
+		if err != nil {
+			log.Printf("[server.subscribe] man.view() returned error: %+v\n", err)
+			continue
+		}
+		man.write(out.from, event)
+	}
+}
+
+func (man *connManager) unsubscribe(subscriber string) {
+	for _, watched := range man.watching[subscriber] {
+		delete(man.watchers[watched], subscriber)
+		if len(man.watchers[watched]) == 0 {
+			delete(man.watchers, watched)
+		}
+	}
+	delete(man.watching, subscriber)
+}
+
+func (man *connManager) setPresence(out *outgoing) {
+	set, err := chatmessage.ParsePresenceSet(out.msg)
+	if err != nil {
+		man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, "could not parse presence")
+		return
+	}
+
+	if set.Status != chatmessage.ONLINE && set.Status != chatmessage.AWAY {
+		man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, InvalidPresenceError.Error())
+		return
+	}
+
+	switch set.Visibility {
+	case chatmessage.VISIBLE_TO_EVERYONE, chatmessage.VISIBLE_TO_ALLOWED, chatmessage.VISIBLE_TO_NOBODY:
+	default:
+		man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, InvalidPresenceError.Error())
+		return
+	}
+
+	pk := base64.RawStdEncoding.EncodeToString(out.from.PublicKey())
+	p := man.presenceOf(pk)
+	visible := make(map[string]bool, len(man.watchers[pk]))
+	for subscriber := range man.watchers[pk] {
+		visible[subscriber] = p.visibleTo(subscriber)
+	}
+
+	p.status = set.Status
+	p.visibility = set.Visibility
+	p.allowed = make(map[string]bool, len(set.Allowed))
+	for _, key := range set.Allowed {
+		p.allowed[base64.RawStdEncoding.EncodeToString(key)] = true
+	}
+
+	// watchers that just lost sight of pk are told once so they do not
+	// keep showing its old status, this follows a choice pk made and not
+	// its comings and goings
+	for subscriber, was := range visible {
+		if was && !p.visibleTo(subscriber) {
+			man.sendView(pk, subscriber)
+		}
+	}
+
+	man.notifyPresence(pk)
+}
+
+func (man *connManager) goOnline(pk string) {
+	p := man.presenceOf(pk)
+	p.status = chatmessage.ONLINE
+	man.notifyPresence(pk)
+}
+
+func (man *connManager) goOffline(pk string) {
+	p := man.presenceOf(pk)
+	p.status = chatmessage.OFFLINE
+	p.lastSeen = time.Now()
+	man.unsubscribe(pk)
+	man.notifyPresence(pk)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/base64"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresenceView(t *testing.T) {
+	alice := base64.RawStdEncoding.EncodeToString([]byte("alice"))
+	bob := base64.RawStdEncoding.EncodeToString([]byte("bob"))
+	eve := base64.RawStdEncoding.EncodeToString([]byte("eve"))
+
+	view := func(t *testing.T, man *connManager, watched string, subscriber string) *chatmessage.Presence {
+		msg, err := man.view(watched, subscriber)
+		assert.Nil(t, err, "could not build presence view")
+		presence, err := chatmessage.ParsePresence(msg)
+		assert.Nil(t, err, "could not parse presence view")
+		return presence
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "never seen key is unknown",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				assert.Equal(t, chatmessage.UNKNOWN, view(t, man, alice, bob).Status)
+			},
+		},
+		{
+			name: "offline key has last seen",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				man.goOnline(alice)
+				assert.Equal(t, chatmessage.ONLINE, view(t, man, alice, bob).Status)
+
+				man.goOffline(alice)
+				presence := view(t, man, alice, bob)
+				assert.Equal(t, chatmessage.OFFLINE, presence.Status)
+				assert.InDelta(t, time.Now().Unix(), presence.LastSeen, 1)
+			},
+		},
+		{
+			name: "allow list hides presence from everyone else",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				man.goOnline(alice)
+				p := man.presenceOf(alice)
+				p.visibility = chatmessage.VISIBLE_TO_ALLOWED
+				p.allowed = map[string]bool{bob: true}
+
+				assert.Equal(t, chatmessage.ONLINE, view(t, man, alice, bob).Status)
+				assert.Equal(t, chatmessage.UNKNOWN, view(t, man, alice, eve).Status)
+			},
+		},
+		{
+			name: "nobody sees a hidden key",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				man.goOffline(alice)
+				man.presenceOf(alice).visibility = chatmessage.VISIBLE_TO_NOBODY
+
+				presence := view(t, man, alice, bob)
+				assert.Equal(t, chatmessage.UNKNOWN, presence.Status)
+				assert.Zero(t, presence.LastSeen, "last seen must not leak")
+			},
+		},
+		{
+			name: "hidden watchers are not notified",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				bobConn, eveConn := client.NewClient(), client.NewClient()
+				man.logged[bob] = map[string]client.Client{"laptop": bobConn}
+				man.logged[eve] = map[string]client.Client{"laptop": eveConn}
+				man.watchers[alice] = map[string]bool{bob: true, eve: true}
+
+				p := man.presenceOf(alice)
+				p.visibility = chatmessage.VISIBLE_TO_ALLOWED
+				p.allowed = map[string]bool{bob: true}
+
+				man.goOnline(alice)
+				man.goOffline(alice)
+				assert.Equal(t, 2, bobConn.QueueLen())
+				assert.Equal(t, 0, eveConn.QueueLen(), "hidden watcher must not see logins")
+			},
+		},
+		{
+			name: "watchers losing sight are told once",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				aliceConn, bobConn := client.NewClient(), client.NewClient()
+				aliceConn.SetPublicKey([]byte("alice"))
+				man.logged[bob] = map[string]client.Client{"laptop": bobConn}
+				man.watchers[alice] = map[string]bool{bob: true}
+
+				msg, err := chatmessage.NewChatMessage(chatmessage.PRESENCE_SET_MSG, &chatmessage.PresenceSet{
+					Status:     chatmessage.ONLINE,
+					Visibility: chatmessage.VISIBLE_TO_NOBODY,
+				})
+				assert.Nil(t, err)
+				man.setPresence(&outgoing{from: aliceConn, msg: msg})
+				man.setPresence(&outgoing{from: aliceConn, msg: msg})
+				assert.Equal(t, 1, bobConn.QueueLen())
+			},
+		},
+		{
+			name: "going offline drops subscriptions",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				man.watchers[alice] = map[string]bool{bob: true}
+				man.watching[bob] = []string{alice}
+
+				man.goOffline(bob)
+				assert.Empty(t, man.watchers)
+				assert.Empty(t, man.watching)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
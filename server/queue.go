@@ -0,0 +1,229 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"strings"
+)
+
+// OverflowPolicy decides what happens to a frame for a session whose send
+// queue is full
+type OverflowPolicy string
+
+const (
+	// DROP_OLDEST makes room by dropping the frame that waited the longest
+	DROP_OLDEST OverflowPolicy = "DROP_OLDEST"
+	// DISCONNECT closes the slow session, the peer messages it had queued
+	// are moved to its mailbox and handed out on its next login, other
+	// frames are lost
+	DISCONNECT OverflowPolicy = "DISCONNECT"
+	// SPILL_TO_MAILBOX moves peer messages to the mailbox of the session
+	// and hands them back once its queue drains, other frames are dropped
+	// oldest first
+	SPILL_TO_MAILBOX OverflowPolicy = "SPILL_TO_MAILBOX"
+)
+
+const DEFAULT_OVERFLOW_POLICY = SPILL_TO_MAILBOX
+
+var UnknownOverflowPolicyError = errors.New("unknown overflow policy")
+
+// metrics is published under /debug/vars, counters are shared by every
+// manager in the process and send_queues reports the last one created
+var metrics = expvar.NewMap("pogchat_server")
+
+const (
+	DROPPED_FRAMES_METRIC = "dropped_frames"
+	SPILLED_FRAMES_METRIC = "spilled_frames"
+	SLOW_CONSUMER_METRIC  = "slow_consumers_disconnected"
+	SEND_QUEUES_METRIC    = "send_queues"
+)
+
+// QueueStats is a snapshot of the send queues of every session
+type QueueStats struct {
+	Sessions int `json:"sessions"`
+	Queued   int `json:"queued"`
+	Deepest  int `json:"deepest"`
+	Capacity int `json:"capacity"`
+}
+
+func ParseOverflowPolicy(policy string) (OverflowPolicy, error) {
+	p := OverflowPolicy(strings.ToUpper(policy))
+	switch p {
+	case DROP_OLDEST, DISCONNECT, SPILL_TO_MAILBOX:
+		return p, nil
+	default:
+		return "", fmt.Errorf("%w: %q", UnknownOverflowPolicyError, policy)
+	}
+}
+
+// overflow applies the overflow policy to a frame that did not fit in the
+// queue of c
+func (man *connManager) overflow(c client.Client, chatMsg *chatmessage.ChatMessage, msg []byte) {
+	switch man.overflowPolicy {
+	case DISCONNECT:
+		log.Printf("[server.overflow] disconnecting slow consumer with %d queued frames\n", c.QueueLen())
+		metrics.Add(SLOW_CONSUMER_METRIC, 1)
+		man.evacuate(c, append(c.Pending(), msg))
+		c.Close()
+		return
+	case SPILL_TO_MAILBOX:
+		if man.spillable(c, chatMsg) {
+			man.spill(c, chatMsg)
+			return
+		}
+	}
+
+	man.dropOldest(c, msg)
+}
+
+func (man *connManager) spillable(c client.Client, chatMsg *chatmessage.ChatMessage) bool {
+	return man.overflowPolicy == SPILL_TO_MAILBOX && chatMsg.Type == chatmessage.PEER_MSG && c.LoggedIn()
+}
+
+// spilling reports whether c has messages waiting in the mailbox, newer
+// ones follow them there to keep their order
+func (man *connManager) spilling(c client.Client, chatMsg *chatmessage.ChatMessage) bool {
+	if !man.spillable(c, chatMsg) {
+		return false
+	}
+	_, ok := man.spilled.Load(c)
+	return ok
+}
+
+func (man *connManager) dropOldest(c client.Client, msg []byte) {
+	for {
+		if c.Evict() {
+			metrics.Add(DROPPED_FRAMES_METRIC, 1)
+		}
+
+		err := c.Enqueue(msg)
+		if err != client.QueueFullError {
+			return
+		}
+	}
+}
+
+// sessionBox is the mailbox frames that could not reach c wait in, a
+// device with an id of its own is the only one to get them back, the others
+// are forgotten at logout so theirs go to the mailbox of the key
+func sessionBox(c client.Client) string {
+	pk := base64.RawStdEncoding.EncodeToString(c.PublicKey())
+	if ephemeral(c.DeviceID()) {
+		return pk
+	}
+	return deviceBox(pk, c.DeviceID())
+}
+
+// evacuate moves the peer messages among frames to the mailbox of c before
+// it is closed, they are delivered again on its next login
+func (man *connManager) evacuate(c client.Client, frames [][]byte) {
+	if !c.LoggedIn() {
+		return
+	}
+
+	for _, frame := range frames {
+		chatMsg, err := c.DecodeMessage(frame)
+		if err != nil || chatMsg.Type != chatmessage.PEER_MSG {
+			metrics.Add(DROPPED_FRAMES_METRIC, 1)
+			continue
+		}
+
+		payload, err := chatMsg.PeerPayload()
+		if err != nil {
+			metrics.Add(DROPPED_FRAMES_METRIC, 1)
+			continue
+		}
+
+		err = man.mailbox.Push(sessionBox(c), []byte(payload))
+		if err != nil {
+			log.Printf("[server.evacuate] mailbox.Push() returned error: %+v\n", err)
+			metrics.Add(DROPPED_FRAMES_METRIC, 1)
+			continue
+		}
+		metrics.Add(SPILLED_FRAMES_METRIC, 1)
+	}
+}
+
+func (man *connManager) spill(c client.Client, chatMsg *chatmessage.ChatMessage) {
+	payload, err := chatMsg.PeerPayload()
+	if err == nil {
+		err = man.mailbox.Push(sessionBox(c), []byte(payload))
+	}
+	if err != nil {
+		log.Printf("[server.spill] mailbox.Push() returned error: %+v\n", err)
+		metrics.Add(DROPPED_FRAMES_METRIC, 1)
+		return
+	}
+
+	metrics.Add(SPILLED_FRAMES_METRIC, 1)
+	man.spilled.Store(c, true)
+}
+
+// unspill hands spilled messages back to a session once its writer caught
+// up, it runs on the goroutine writing c
+func (man *connManager) unspill(c client.Client) {
+	if c.QueueLen() > 0 {
+		return
+	}
+	if _, ok := man.spilled.Load(c); !ok {
+		return
+	}
+
+	// the flag is cleared on Start so nothing routed meanwhile can overtake
+	// what is waiting in the mailbox
+	man.exec(func() {
+		man.spilled.Delete(c)
+		if !c.LoggedIn() {
+			return
+		}
+		man.flushMailbox(c, sessionBox(c))
+	})
+}
+
+// flushMailbox writes every queued message of a key to one of its
+// sessions, whatever does not fit spills back in order
+func (man *connManager) flushMailbox(c client.Client, pk string) {
+	payloads, err := man.mailbox.Drain(pk)
+	if err != nil {
+		log.Printf("[server.flushMailbox] mailbox.Drain() returned error: %+v\n", err)
+		return
+	}
+
+	for _, payload := range payloads {
+		man.write(c, &chatmessage.ChatMessage{
+			Type:    chatmessage.PEER_MSG,
+			Payload: string(payload),
+		})
+	}
+}
+
+func (man *connManager) queueStats() QueueStats {
+	stats := QueueStats{}
+	count := func(c client.Client) {
+		depth := c.QueueLen()
+		stats.Sessions++
+		stats.Queued += depth
+		stats.Capacity += c.QueueCap()
+		if depth > stats.Deepest {
+			stats.Deepest = depth
+		}
+	}
+
+	man.exec(func() {
+		for c := range man.clients {
+			count(c)
+		}
+		for _, devices := range man.logged {
+			for _, c := range devices {
+				count(c)
+			}
+		}
+	})
+
+	return stats
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"pogchat/mailbox"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendQueue(t *testing.T) {
+	key := []byte("alice")
+	pk := base64.RawStdEncoding.EncodeToString(key)
+
+	// slow is a logged in session nobody writes out
+	slow := func() client.Client {
+		c := client.NewClient(client.WithQueueSize(2))
+		c.SetPublicKey(key)
+		c.SetDeviceID("laptop")
+		c.SetLoggedIn(true)
+		return c
+	}
+
+	peerMsg := func(payload string) *chatmessage.ChatMessage {
+		return &chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, Payload: payload}
+	}
+
+	payloads := func(t *testing.T, c client.Client) []string {
+		got := []string{}
+		for c.QueueLen() > 0 {
+			msg := &chatmessage.ChatMessage{}
+			assert.Nil(t, json.Unmarshal(<-c.WriteToChan(), msg))
+			got = append(got, msg.Payload)
+		}
+		return got
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "drop oldest keeps the newest frames",
+			f: func(t *testing.T) {
+				man := NewConnectionManager(WithOverflowPolicy(DROP_OLDEST)).(*connManager)
+				c := slow()
+				for _, p := range []string{"one", "two", "three"} {
+					man.write(c, peerMsg(p))
+				}
+
+				assert.Equal(t, []string{"two", "three"}, payloads(t, c))
+				assert.Equal(t, client.AUTHENTICATED, c.State())
+			},
+		},
+		{
+			name: "disconnect closes the slow consumer",
+			f: func(t *testing.T) {
+				box := mailbox.NewMailbox()
+				man := NewConnectionManager(WithOverflowPolicy(DISCONNECT), WithMailbox(box)).(*connManager)
+				c := slow()
+				for _, p := range []string{"one", "two", "three"} {
+					man.write(c, peerMsg(p))
+				}
+
+				assert.Equal(t, client.CLOSING, c.State())
+
+				queued, err := box.Drain(deviceBox(pk, "laptop"))
+				assert.Nil(t, err)
+				assert.Equal(t, [][]byte{[]byte("one"), []byte("two"), []byte("three")}, queued, "queued messages must wait for the next login")
+			},
+		},
+		{
+			name: "spilled messages keep their order",
+			f: func(t *testing.T) {
+				box := mailbox.NewMailbox()
+				man := NewConnectionManager(WithOverflowPolicy(SPILL_TO_MAILBOX), WithMailbox(box)).(*connManager)
+				c := slow()
+				for _, p := range []string{"one", "two", "three", "four"} {
+					man.write(c, peerMsg(p))
+				}
+				assert.Equal(t, []string{"one", "two"}, payloads(t, c))
+
+				// the queue has room again but four must wait for three
+				man.write(c, peerMsg("five"))
+				assert.Equal(t, 0, c.QueueLen())
+
+				queued, err := box.Drain(pk)
+				assert.Nil(t, err)
+				assert.Empty(t, queued, "other devices must not get spilled messages")
+
+				queued, err = box.Drain(deviceBox(pk, "laptop"))
+				assert.Nil(t, err)
+				assert.Len(t, queued, 3)
+			},
+		},
+		{
+			name: "spilled messages come back once the queue drains",
+			f: func(t *testing.T) {
+				man := NewConnectionManager(WithOverflowPolicy(SPILL_TO_MAILBOX)).(*connManager)
+				go man.Start()
+				c := slow()
+				for _, p := range []string{"one", "two", "three"} {
+					man.write(c, peerMsg(p))
+				}
+				assert.Equal(t, []string{"one", "two"}, payloads(t, c))
+
+				man.unspill(c)
+				assert.Equal(t, []string{"three"}, payloads(t, c))
+			},
+		},
+		{
+			name: "frames other than peer messages are never spilled",
+			f: func(t *testing.T) {
+				man := NewConnectionManager(WithOverflowPolicy(SPILL_TO_MAILBOX)).(*connManager)
+				c := slow()
+				for i := 0; i < 3; i++ {
+					man.sendStatus(c, chatmessage.QUEUED, "status")
+				}
+
+				assert.Equal(t, 2, c.QueueLen())
+				_, spilled := man.spilled.Load(c)
+				assert.False(t, spilled)
+			},
+		},
+		{
+			name: "queue depth is reported",
+			f: func(t *testing.T) {
+				man := NewConnectionManager(WithOverflowPolicy(DROP_OLDEST)).(*connManager)
+				go man.Start()
+				c := slow()
+				man.exec(func() {
+					man.attach(pk, c)
+				})
+				man.write(c, peerMsg("one"))
+
+				assert.Equal(t, QueueStats{Sessions: 1, Queued: 1, Deepest: 1, Capacity: 2}, man.queueStats())
+			},
+		},
+		{
+			name: "slow reader does not stall routing",
+			f: func(t *testing.T) {
+				man := NewConnectionManager(WithOverflowPolicy(DROP_OLDEST)).(*connManager)
+				c := slow()
+				done := make(chan struct{})
+				go func() {
+					for i := 0; i < 100; i++ {
+						man.write(c, peerMsg("flood"))
+					}
+					close(done)
+				}()
+
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatal("write blocked on a full queue")
+				}
+			},
+		},
+		{
+			name: "overflow policy is parsed",
+			f: func(t *testing.T) {
+				policy, err := ParseOverflowPolicy("drop_oldest")
+				assert.Nil(t, err)
+				assert.Equal(t, DROP_OLDEST, policy)
+
+				_, err = ParseOverflowPolicy("block")
+				assert.ErrorIs(t, err, UnknownOverflowPolicyError)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import "time"
+
+const (
+	DEFAULT_RATE_LIMIT  = 20
+	DEFAULT_RATE_PERIOD = time.Second
+)
+
+// rateLimiter is a fixed window counter owned by a single connection
+// goroutine, it is not safe for concurrent use
+type rateLimiter struct {
+	limit       int
+	period      time.Duration
+	windowStart time.Time
+	count       int
+}
+
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		period: period,
+	}
+}
+
+func (r *rateLimiter) Allow(now time.Time) bool {
+	if r.limit <= 0 {
+		return true
+	}
+
+	if now.Sub(r.windowStart) >= r.period {
+		r.windowStart = now
+		r.count = 0
+	}
+
+	if r.count >= r.limit {
+		return false
+	}
+
+	r.count++
+	return true
+}
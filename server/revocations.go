@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Revocation is a device key its identity locked out, it outlives the
+// device record so MAX_DEVICES can never make room by forgetting it
+type Revocation struct {
+	PublicKey []byte    `json:"public_key"`
+	DeviceKey []byte    `json:"device_key"`
+	DeviceID  string    `json:"device_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// revocations keeps every revoked device key in memory and rewrites the
+// whole file on every change, revocations are rare enough for that
+type revocations struct {
+	mu       sync.Mutex
+	fileName string
+	revoked  map[string]*Revocation
+}
+
+var _ Revocations = (*revocations)(nil)
+
+func revocationKey(publicKey []byte, deviceKey []byte) string {
+	return deviceBox(base64.RawStdEncoding.EncodeToString(publicKey), base64.RawStdEncoding.EncodeToString(deviceKey))
+}
+
+func (r *revocations) Revoke(revocation *Revocation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revoked[revocationKey(revocation.PublicKey, revocation.DeviceKey)] = revocation
+	return r.save()
+}
+
+func (r *revocations) Revoked(publicKey []byte, deviceKey []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.revoked[revocationKey(publicKey, deviceKey)]
+	return ok
+}
+
+func (r *revocations) save() error {
+	if r.fileName == "" {
+		return nil
+	}
+
+	list := make([]*Revocation, 0, len(r.revoked))
+	for _, revocation := range r.revoked {
+		list = append(list, revocation)
+	}
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := r.fileName + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.fileName)
+}
+
+// NewRevocations loads revoked device keys from fileName, creating it on
+// first use, an empty fileName keeps them in memory only
+func NewRevocations(fileName string) (Revocations, error) {
+	r := &revocations{
+		fileName: fileName,
+		revoked:  make(map[string]*Revocation),
+	}
+
+	if fileName == "" {
+		return r, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(fileName), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Revocation, 0)
+	err = json.Unmarshal(b, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, revocation := range list {
+		r.revoked[revocationKey(revocation.PublicKey, revocation.DeviceKey)] = revocation
+	}
+
+	return r, nil
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"log"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"pogchat/user_message"
+	"sort"
+	"time"
+)
+
+var (
+	NoSuchRoomError      = errors.New("room does not exist")
+	RoomExistsError      = errors.New("room already exists")
+	InvalidRoomNameError = errors.New("room name can not be empty")
+	NotAuthorisedError   = errors.New("only the room owner can change its members")
+	NotAMemberError      = errors.New("key is not a member of the room")
+	AlreadyMemberError   = errors.New("key is already a member of the room")
+	WrongRoomError       = errors.New("message copy belongs to another room")
+	UnknownRoomOpError   = errors.New("unknown room operation")
+)
+
+// room is owned by the Start goroutine like the routing tables, members are
+// keyed by their base64 public key, ops is every signed change since the
+// room was created so members can check the list instead of trusting it
+type room struct {
+	name    string
+	owner   string
+	members map[string][]byte
+	ops     []*chatmessage.RoomOp
+}
+
+func (r *room) memberKeys() []string {
+	keys := make([]string, 0, len(r.members))
+	for k := range r.members {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (man *connManager) handleRoom(c client.Client, chatMsg *chatmessage.ChatMessage) error {
+	if !c.LoggedIn() {
+		man.sendStatus(c, chatmessage.NOT_LOGGED_IN, "login before using rooms")
+		return NotLoggedInError
+	}
+
+	man.broadcast <- &outgoing{from: c, msg: chatMsg}
+
+	return nil
+}
+
+// checkRoomOp holds membership changes to the same rules as peer messages,
+// they must be signed by the connection key, fresh and never seen before
+func (man *connManager) checkRoomOp(from client.Client, op *chatmessage.RoomOp) error {
+	if !bytes.Equal(op.Actor, from.PublicKey()) {
+		return SenderMismatchError
+	}
+
+	skew := time.Since(time.Unix(op.Timestamp, 0))
+	if skew > man.messageSkew || skew < -man.messageSkew {
+		return StaleMessageError
+	}
+
+	_, err := signer.Verify(op.Actor, op.SigningBytes(), op.Signature)
+	if err != nil {
+		return err
+	}
+
+	if man.seen.Seen("room:" + op.ID) {
+		return ReplayedMessageError
+	}
+
+	return nil
+}
+
+func (man *connManager) applyRoomOp(out *outgoing) {
+	op, err := chatmessage.ParseRoomOp(out.msg)
+	if err != nil {
+		man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, "could not parse room operation")
+		return
+	}
+
+	err = man.checkRoomOp(out.from, op)
+	if err != nil {
+		log.Printf("[server.applyRoomOp] rejected room operation: %+v\n", err)
+		man.sendStatus(out.from, rejection(err), err.Error())
+		return
+	}
+
+	r, notify, err := man.changeRoom(op)
+	if err != nil {
+		man.sendStatus(out.from, chatmessage.ROOM_REJECTED, err.Error())
+		return
+	}
+
+	info, err := roomInfo(r, op)
+	if err != nil {
+		log.Printf("[server.applyRoomOp] roomInfo() returned error: %+v\n", err)
+		return
+	}
+
+	for _, pk := range notify {
+		man.writeAll(pk, nil, info)
+	}
+}
+
+// changeRoom applies a checked operation and returns everyone who has to
+// hear about it, members removed by the operation included
+func (man *connManager) changeRoom(op *chatmessage.RoomOp) (*room, []string, error) {
+	actor := base64.RawStdEncoding.EncodeToString(op.Actor)
+	r, ok := man.rooms[op.Room]
+
+	if op.Op == chatmessage.CREATE_ROOM {
+		if op.Room == "" {
+			return nil, nil, InvalidRoomNameError
+		}
+		if ok {
+			return nil, nil, RoomExistsError
+		}
+
+		r = &room{
+			name:    op.Room,
+			owner:   actor,
+			members: map[string][]byte{actor: op.Actor},
+			ops:     []*chatmessage.RoomOp{op},
+		}
+		man.rooms[op.Room] = r
+		return r, []string{actor}, nil
+	}
+
+	if !ok {
+		return nil, nil, NoSuchRoomError
+	}
+
+	notify := r.memberKeys()
+	member := base64.RawStdEncoding.EncodeToString(op.Member)
+
+	switch op.Op {
+	case chatmessage.INVITE_MEMBER:
+		if actor != r.owner {
+			return nil, nil, NotAuthorisedError
+		}
+		if _, ok := r.members[member]; ok || len(op.Member) == 0 {
+			return nil, nil, AlreadyMemberError
+		}
+		r.members[member] = op.Member
+		notify = append(notify, member)
+	case chatmessage.REMOVE_MEMBER:
+		if actor != r.owner || member == r.owner {
+			return nil, nil, NotAuthorisedError
+		}
+		if _, ok := r.members[member]; !ok {
+			return nil, nil, NotAMemberError
+		}
+		delete(r.members, member)
+	case chatmessage.LEAVE_ROOM:
+		if _, ok := r.members[actor]; !ok {
+			return nil, nil, NotAMemberError
+		}
+		// a room without its owner could never change again, so the
+		// owner leaving closes it for everyone
+		if actor == r.owner {
+			r.members = map[string][]byte{}
+			delete(man.rooms, op.Room)
+		} else {
+			delete(r.members, actor)
+		}
+	default:
+		return nil, nil, UnknownRoomOpError
+	}
+
+	r.ops = append(r.ops, op)
+	return r, notify, nil
+}
+
+// fanOut relays the per member copies of a room message, every copy is
+// checked like a direct message and must be addressed to a member of the
+// room it claims to belong to
+func (man *connManager) fanOut(out *outgoing) {
+	envelope, err := chatmessage.ParseRoomEnvelope(out.msg)
+	if err != nil {
+		man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, "could not parse room message")
+		return
+	}
+
+	r, ok := man.rooms[envelope.Room]
+	if !ok {
+		man.sendStatus(out.from, chatmessage.ROOM_REJECTED, NoSuchRoomError.Error())
+		return
+	}
+
+	sender := base64.RawStdEncoding.EncodeToString(out.from.PublicKey())
+	if _, ok := r.members[sender]; !ok {
+		man.sendStatus(out.from, chatmessage.ROOM_REJECTED, NotAMemberError.Error())
+		return
+	}
+
+	for _, payload := range envelope.Messages {
+		um, err := user_message.ParseFromJSON(payload, user_message.WithSigner(signer))
+		if err != nil {
+			man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, "could not parse user message")
+			continue
+		}
+
+		err = man.checkMessage(out.from, um)
+		if err != nil {
+			log.Printf("[server.fanOut] rejected message: %+v\n", err)
+			man.sendStatus(out.from, rejection(err), err.Error())
+			continue
+		}
+
+		if um.Room() != envelope.Room {
+			man.sendStatus(out.from, chatmessage.ROOM_REJECTED, WrongRoomError.Error())
+			continue
+		}
+
+		to := base64.RawStdEncoding.EncodeToString(um.ToPublicKey())
+		if _, ok := r.members[to]; !ok || to == sender {
+			man.sendStatus(out.from, chatmessage.ROOM_REJECTED, NotAMemberError.Error())
+			continue
+		}
+
+		man.deliver(out.from, to, &chatmessage.ChatMessage{
+			Type:    chatmessage.PEER_MSG,
+			Payload: payload,
+			User:    um,
+		})
+	}
+}
+
+// sendRooms catches a member up on every room it belongs to after login
+func (man *connManager) sendRooms(c client.Client, pk string) {
+	for _, r := range man.rooms {
+		if _, ok := r.members[pk]; !ok {
+			continue
+		}
+
+		info, err := roomInfo(r, nil)
+		if err != nil {
+			log.Printf("[server.sendRooms] roomInfo() returned error: %+v\n", err)
+			continue
+		}
+		man.write(c, info)
+	}
+}
+
+func roomInfo(r *room, op *chatmessage.RoomOp) (*chatmessage.ChatMessage, error) {
+	info := &chatmessage.RoomInfo{
+		Room:    r.name,
+		Members: make([][]byte, 0, len(r.members)),
+		Ops:     r.ops,
+		Op:      op,
+	}
+
+	owner, err := base64.RawStdEncoding.DecodeString(r.owner)
+	if err != nil {
+		return nil, err
+	}
+	info.Owner = owner
+
+	for _, k := range r.memberKeys() {
+		info.Members = append(info.Members, r.members[k])
+	}
+
+	return chatmessage.NewChatMessage(chatmessage.ROOM_INFO_MSG, info)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/base64"
+	chatmessage "pogchat/chat_message"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRoom(t *testing.T) {
+	owner, alice, bob := []byte("owner"), []byte("alice"), []byte("bob")
+	b64 := base64.RawStdEncoding.EncodeToString
+
+	op := func(opType chatmessage.RoomOpType, actor []byte, member []byte) *chatmessage.RoomOp {
+		return &chatmessage.RoomOp{Op: opType, Room: "pog", Actor: actor, Member: member}
+	}
+
+	newRoom := func(t *testing.T) *connManager {
+		man := NewConnectionManager().(*connManager)
+		_, _, err := man.changeRoom(op(chatmessage.CREATE_ROOM, owner, nil))
+		assert.Nil(t, err, "could not create room")
+		_, _, err = man.changeRoom(op(chatmessage.INVITE_MEMBER, owner, alice))
+		assert.Nil(t, err, "could not invite member")
+		return man
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "room names are unique",
+			f: func(t *testing.T) {
+				man := newRoom(t)
+				_, _, err := man.changeRoom(op(chatmessage.CREATE_ROOM, bob, nil))
+				assert.Equal(t, RoomExistsError, err)
+			},
+		},
+		{
+			name: "invite notifies old and new members",
+			f: func(t *testing.T) {
+				man := newRoom(t)
+				r, notify, err := man.changeRoom(op(chatmessage.INVITE_MEMBER, owner, bob))
+				assert.Nil(t, err)
+				assert.Len(t, r.members, 3)
+				assert.ElementsMatch(t, []string{b64(owner), b64(alice), b64(bob)}, notify)
+			},
+		},
+		{
+			name: "only the owner changes members",
+			f: func(t *testing.T) {
+				man := newRoom(t)
+				_, _, err := man.changeRoom(op(chatmessage.INVITE_MEMBER, alice, bob))
+				assert.Equal(t, NotAuthorisedError, err)
+				_, _, err = man.changeRoom(op(chatmessage.REMOVE_MEMBER, alice, owner))
+				assert.Equal(t, NotAuthorisedError, err)
+			},
+		},
+		{
+			name: "removed member is still notified",
+			f: func(t *testing.T) {
+				man := newRoom(t)
+				r, notify, err := man.changeRoom(op(chatmessage.REMOVE_MEMBER, owner, alice))
+				assert.Nil(t, err)
+				assert.NotContains(t, r.members, b64(alice))
+				assert.Contains(t, notify, b64(alice))
+			},
+		},
+		{
+			name: "member can leave",
+			f: func(t *testing.T) {
+				man := newRoom(t)
+				_, _, err := man.changeRoom(op(chatmessage.LEAVE_ROOM, alice, nil))
+				assert.Nil(t, err)
+				_, _, err = man.changeRoom(op(chatmessage.LEAVE_ROOM, alice, nil))
+				assert.Equal(t, NotAMemberError, err)
+			},
+		},
+		{
+			name: "every applied change is kept",
+			f: func(t *testing.T) {
+				man := newRoom(t)
+				_, _, err := man.changeRoom(op(chatmessage.INVITE_MEMBER, alice, bob))
+				assert.Equal(t, NotAuthorisedError, err)
+				r, _, err := man.changeRoom(op(chatmessage.LEAVE_ROOM, alice, nil))
+				assert.Nil(t, err)
+
+				ops := []chatmessage.RoomOpType{}
+				for _, o := range r.ops {
+					ops = append(ops, o.Op)
+				}
+				assert.Equal(t, []chatmessage.RoomOpType{chatmessage.CREATE_ROOM, chatmessage.INVITE_MEMBER, chatmessage.LEAVE_ROOM}, ops)
+			},
+		},
+		{
+			name: "owner leaving closes the room",
+			f: func(t *testing.T) {
+				man := newRoom(t)
+				r, notify, err := man.changeRoom(op(chatmessage.LEAVE_ROOM, owner, nil))
+				assert.Nil(t, err)
+				assert.Empty(t, r.members)
+				assert.Len(t, notify, 2)
+
+				_, _, err = man.changeRoom(op(chatmessage.INVITE_MEMBER, owner, bob))
+				assert.Equal(t, NoSuchRoomError, err)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
@@ -3,32 +3,109 @@ package server
 import (
 	"crypto"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"net"
 	chatmessage "pogchat/chat_message"
 	"pogchat/client"
+	"pogchat/codec"
 	"pogchat/cryptography"
+	"pogchat/frame"
+	"pogchat/mailbox"
+	"pogchat/tlsutil"
+	"pogchat/transport"
 	"pogchat/user_message"
+	"pogchat/ws"
+	"sync"
+	"time"
 )
 
+// connManager keeps every routing table on the goroutine running Start,
+// other goroutines reach them only through broadcast or exec so none of the
+// maps below need a lock
 type connManager struct {
 	// TODO: WE NEED A BETTER WAY TO FIND CLIENTS MAYBE HASH PUBLIC KEY ?
-	logged     map[string]client.Client
-	clients    map[client.Client]bool
-	broadcast  chan *chatmessage.ChatMessage
-	register   chan client.Client
-	unregister chan client.Client
+	// logged maps every key to its logged in devices by device id
+	logged    map[string]map[string]client.Client
+	devices   map[string]map[string]*device
+	clients   map[client.Client]bool
+	broadcast chan *outgoing
+	ops       chan func()
+	mailbox   mailbox.Mailbox
+	// revocations outlive the device records, see WithRevocations
+	revocations Revocations
+	// handlers is filled before connections are served and only read after
+	handlers map[string]MessageHandler
+	serverID string
+	// challengeTTL bounds how long an issued challenge stays valid and how
+	// far a login timestamp may drift from the server clock
+	challengeTTL time.Duration
+	rateLimit    int
+	ratePeriod   time.Duration
+	messageSkew  time.Duration
+	seen         user_message.ReplayCache
+	rooms        map[string]*room
+	presence     map[string]*presence
+	// watchers maps a key to everyone subscribed to its presence, watching
+	// is the reverse index used to drop a subscriber
+	watchers map[string]map[string]bool
+	watching map[string][]string
+	// spilled marks sessions with messages waiting in the mailbox, it is
+	// read by their writers so it is the one table not owned by Start
+	spilled        sync.Map
+	overflowPolicy OverflowPolicy
+	// sessions quiet for heartbeatInterval are pinged and evicted after
+	// heartbeatMisses intervals, an interval of zero disables heartbeats
+	heartbeatInterval time.Duration
+	heartbeatMisses   int
+	pingSeq           uint64
+	// codecs are offered in every challenge, see the codec package
+	codecs []string
 }
 
-var ClientIsRegisteredError = errors.New("this client already exists")
+var (
+	ClientIsRegisteredError = errors.New("this client already exists")
+	ConnectionStateError    = errors.New("connection is not in a state that allows this")
+)
+
+// outgoing is a peer message waiting to be routed together with the
+// connection that sent it, so routing failures can be reported back
+type outgoing struct {
+	from client.Client
+	msg  *chatmessage.ChatMessage
+}
 
 var _ ConnectionManager = (*connManager)(nil)
 
+// exec runs f on the goroutine running Start and waits for it, it must
+// never be called from that goroutine
+func (man *connManager) exec(f func()) {
+	done := make(chan struct{})
+	man.ops <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
 func (man *connManager) Register(c client.Client) error {
+	var err error
+	man.exec(func() {
+		err = man.register(c)
+	})
+	return err
+}
+
+func (man *connManager) register(c client.Client) error {
+	if c.State() != client.CONNECTED {
+		log.Printf("[server.Register] refusing a connection in state %s\n", c.State())
+		return ConnectionStateError
+	}
+
 	_, ok := man.clients[c]
 	if ok {
 		log.Println("[server.Register] trying to register a client that already exists")
@@ -40,167 +117,354 @@ func (man *connManager) Register(c client.Client) error {
 	return nil
 }
 
+// Unregister closes a connection and forgets it whatever state it was in
 func (man *connManager) Unregister(c client.Client) error {
+	err := c.Close()
+	man.exec(func() {
+		man.unregister(c)
+	})
+	return err
+}
+
+func (man *connManager) unregister(c client.Client) {
+	delete(man.clients, c)
+	man.spilled.Delete(c)
+
 	pk := base64.RawStdEncoding.EncodeToString(c.PublicKey())
-	if c.LoggedIn() {
-		if _, ok := man.logged[pk]; ok {
-			delete(man.logged, pk)
-			log.Println("[server.Unregister] a logged connection has terminated!")
-		}
-	} else {
-		if _, ok := man.clients[c]; ok {
-			delete(man.clients, c)
-			log.Println("[server.Unregister] a connection has terminated!")
-		}
+	if man.detach(pk, c) {
+		man.goOffline(pk)
 	}
-	return nil
+
+	err := c.Transition(client.CLOSING, client.CLOSED)
+	if err != nil {
+		log.Printf("[server.Unregister] c.Transition() returned error: %+v\n", err)
+		return
+	}
+	log.Println("[server.Unregister] a connection has terminated!")
 }
 
-func (manager *connManager) Receive(client client.Client) {
+func (manager *connManager) Receive(c client.Client) {
+	limiter := newRateLimiter(manager.rateLimit, manager.ratePeriod)
+	manager.issueChallenge(c)
+
 	for {
-		message := make([]byte, 4096)
-		length, err := client.Read(message)
+		chatMsg, err := c.ReadMessage()
+		if errors.Is(err, client.MalformedFrameError) {
+			log.Printf("[server.Receive] c.ReadMessage() returned error: %+v\n", err)
+			manager.sendStatus(c, chatmessage.MALFORMED_PAYLOAD, "frame is not a chat message")
+			continue
+		}
 		if err != nil {
-			manager.unregister <- client
-			err := client.Close()
+			err := manager.Unregister(c)
 			if err != nil {
-				log.Printf("[server.Receive] client.Close() returned error: %+v\n", err)
-				break
+				log.Printf("[server.Receive] manager.Unregister() returned error: %+v\n", err)
 			}
 			break
 		}
-		if length > 0 {
-			chatMsg := &chatmessage.ChatMessage{}
 
-			processedMsg := trimByteSeq(message, '\x00')
-			err := json.Unmarshal([]byte(processedMsg), chatMsg)
-			if err != nil {
-				log.Printf("[server.Receive] json.Unmarshal() returned error: %+v\n", err)
-				break
-			}
+		if !limiter.Allow(time.Now()) {
+			manager.sendStatus(c, chatmessage.RATE_LIMITED, "too many messages, slow down")
+			continue
+		}
 
-			if client.LoggedIn() {
-				manager.broadcast <- chatMsg
-				continue
-			}
+		handler, ok := manager.handlers[chatMsg.Type]
+		if !ok {
+			log.Printf("[server.Receive] unknown message type: %s\n", chatMsg.Type)
+			manager.sendStatus(c, chatmessage.UNKNOWN_TYPE, fmt.Sprintf("unknown message type %q", chatMsg.Type))
+			continue
+		}
 
-			um, err := user_message.ParseFromJSON(chatMsg.Payload)
-			if err != nil {
-				log.Println("[server.Receive] could not parse json")
-				continue
-			}
+		err = handler(c, chatMsg)
+		if err != nil {
+			log.Printf("[server.Receive] %s handler returned error: %+v\n", chatMsg.Type, err)
+		}
+	}
+}
 
-			pk := um.FromPublicKey()
+// Handle registers the handler for a message type, handlers are read by
+// every connection without a lock so they must all be set before Start
+func (man *connManager) Handle(msgType string, handler MessageHandler) {
+	man.handlers[msgType] = handler
+}
 
-			_, err = signer.Verify(pk, um.Message(), um.Signature())
-			if err != nil {
-				log.Println("[server.Receive] not a valid signature")
-				continue
-			}
+func (man *connManager) sendStatus(c client.Client, code chatmessage.StatusCode, reason string) {
+	status, err := chatmessage.NewStatusMessage(code, reason)
+	if err != nil {
+		log.Printf("[server.sendStatus] NewStatusMessage() returned error: %+v\n", err)
+		return
+	}
 
-			client.SetLoggedIn(true)
-			client.SetPublicKey(um.FromPublicKey())
-			manager.logged[base64.RawStdEncoding.EncodeToString(pk)] = client
-			delete(manager.clients, client)
-		}
+	man.write(c, status)
+}
+
+// write queues chatMsg in the encoding of c, only JSON sessions get a
+// decoded peer message turned into JSON
+func (man *connManager) write(c client.Client, chatMsg *chatmessage.ChatMessage) {
+	if man.spilling(c, chatMsg) {
+		man.spill(c, chatMsg)
+		return
+	}
+
+	msg, err := c.EncodeMessage(chatMsg)
+	if err != nil {
+		log.Printf("[server.write] c.EncodeMessage() returned error: %+v\n", err)
+		return
+	}
+
+	err = c.Enqueue(msg)
+	if err == client.QueueFullError {
+		man.overflow(c, chatMsg, msg)
+		return
+	}
+	if err != nil {
+		log.Printf("[server.write] c.Enqueue() returned error: %+v\n", err)
 	}
 }
 
+// Send writes queued frames until the connection starts closing
 func (man *connManager) Send(client client.Client) {
 	defer client.Close()
 	for {
 		select {
-		case message, ok := <-client.WriteToChan():
-			if !ok {
-				return
-			}
-			_, err := client.Write(message)
+		case message := <-client.WriteToChan():
+			err := client.WriteFrame(message)
 			if err != nil {
 				log.Println("[server.Send] could not write to peer")
 				return
 			}
+			man.unspill(client)
+		case <-client.Done():
+			return
 		}
 	}
 }
 
-func trimByteSeq(seq []byte, delim byte) []byte {
-	finalSeq := make([]byte, 0)
-
-	for _, b := range seq {
-		if b == delim {
-			break
-		}
-		finalSeq = append(finalSeq, b)
-	}
-
-	return finalSeq
-}
-
 var signer cryptography.Signer = cryptography.NewSigner(
 	cryptography.WithSignerHasher(crypto.SHA256),
 	cryptography.WithSignerRandomizer(rand.Reader),
 )
 
 func (man *connManager) Start() {
+	var heartbeat <-chan time.Time
+	if man.heartbeatInterval > 0 {
+		ticker := time.NewTicker(man.heartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
 	for {
 		select {
-		case connection := <-man.register:
-			err := man.Register(connection)
-			if err != nil {
-				log.Printf("[server.Start] man.Register() returned error: %+v\n", err)
-			}
-		case connection := <-man.unregister:
-			err := man.Unregister(connection)
-			if err != nil {
-				log.Printf("[server.Start] man.Register() returned error: %+v\n", err)
-			}
-		case chatMsg := <-man.broadcast:
-			um, err := user_message.ParseFromJSON(chatMsg.Payload)
-			if err != nil {
-				log.Println("[server.Start] could not parse payload")
-				continue
-			}
-
-			_, err = signer.Verify(um.FromPublicKey(), um.Message(), um.Signature())
-			if err != nil {
-				log.Println("[server.Start] not a valid signature")
+		case op := <-man.ops:
+			op()
+		case now := <-heartbeat:
+			man.heartbeat(now)
+		case out := <-man.broadcast:
+			// the connection may have been logged out after its handler
+			// queued the message, a revoked device must not get through
+			if !out.from.LoggedIn() {
+				man.sendStatus(out.from, chatmessage.NOT_LOGGED_IN, "login before sending messages")
 				continue
 			}
 
-			peer, ok := man.logged[base64.RawStdEncoding.EncodeToString(um.ToPublicKey())]
-			if !ok {
-				log.Println("[server.Start] message could not be sent")
-				continue
+			switch out.msg.Type {
+			case chatmessage.ROOM_OP_MSG:
+				man.applyRoomOp(out)
+			case chatmessage.ROOM_MSG:
+				man.fanOut(out)
+			case chatmessage.PRESENCE_SUB_MSG:
+				man.subscribe(out)
+			case chatmessage.PRESENCE_SET_MSG:
+				man.setPresence(out)
+			case chatmessage.DEVICE_LIST_MSG:
+				man.listDevices(out)
+			case chatmessage.DEVICE_REVOKE_MSG:
+				man.revokeDevice(out)
+			default:
+				man.routePeer(out)
 			}
+		}
+	}
+}
 
-			peer.WriteToChan() <- []byte(chatMsg.Payload)
+// routePeer only parses the payload of messages that came as JSON, a
+// decoded one from a binary frame is checked and routed as it is
+func (man *connManager) routePeer(out *outgoing) {
+	um := out.msg.User
+	if um == nil {
+		var err error
+		um, err = user_message.ParseFromJSON(out.msg.Payload, user_message.WithSigner(signer))
+		if err != nil {
+			log.Println("[server.routePeer] could not parse payload")
+			man.sendStatus(out.from, chatmessage.MALFORMED_PAYLOAD, "could not parse user message")
+			return
 		}
 	}
+
+	err := man.checkMessage(out.from, um)
+	if err != nil {
+		log.Printf("[server.routePeer] rejected message: %+v\n", err)
+		man.sendStatus(out.from, rejection(err), err.Error())
+		return
+	}
+
+	man.deliver(out.from, base64.RawStdEncoding.EncodeToString(um.ToPublicKey()), &chatmessage.ChatMessage{
+		Type:    chatmessage.PEER_MSG,
+		Payload: out.msg.Payload,
+		User:    um,
+	})
+}
+
+// deliver hands a checked peer message to every device of its recipient or
+// queues it in the mailbox, the sender is told when the message could not
+// go out right away, messages a key sends to itself are copies for its
+// other devices and never reported
+func (man *connManager) deliver(from client.Client, to string, msg *chatmessage.ChatMessage) {
+	if to == base64.RawStdEncoding.EncodeToString(from.PublicKey()) {
+		man.syncDevices(from, to, msg)
+		return
+	}
+
+	if man.writeAll(to, from, msg) {
+		return
+	}
+
+	payload, err := msg.PeerPayload()
+	if err != nil {
+		log.Printf("[server.deliver] msg.PeerPayload() returned error: %+v\n", err)
+		man.sendStatus(from, chatmessage.MALFORMED_PAYLOAD, "could not parse user message")
+		return
+	}
+
+	err = man.mailbox.Push(to, []byte(payload))
+	if err == mailbox.MailboxFullError {
+		man.sendStatus(from, chatmessage.MAILBOX_FULL, "recipient is offline and their mailbox is full")
+		return
+	}
+	if err != nil {
+		log.Printf("[server.deliver] mailbox.Push() returned error: %+v\n", err)
+		man.sendStatus(from, chatmessage.RECIPIENT_OFFLINE, "recipient is not connected")
+		return
+	}
+	man.sendStatus(from, chatmessage.QUEUED, "recipient is offline, message will be delivered on login")
 }
 
 type server struct {
 	connManager ConnectionManager
-	listener    net.Listener
-	network     string
-	address     string
+	// listeners are served at once, when none are given one is made from
+	// network and address plus a WebSocket one for wsAddress
+	listeners []transport.Listener
+	framer    frame.Framer
+	network   string
+	address   string
+	queueSize int
+	// readTimeout and writeTimeout become the deadlines of every
+	// connection, zero waits forever
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	// certFile and keyFile turn on TLS for the listeners made from address
+	// and wsAddress
+	certFile  string
+	keyFile   string
+	wsAddress string
 }
 
+// Start serves every listener until all of them are closed
 func (s *server) Start() {
 	log.Println("[server.NewServer] starting server")
+	listeners := s.listeners
+	if len(listeners) == 0 {
+		var err error
+		listeners, err = s.listen()
+		if err != nil {
+			log.Printf("[server.NewServer] listen() returned error: %+v\n", err)
+			return
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for _, listener := range listeners {
+		wg.Add(1)
+		go func(listener transport.Listener) {
+			defer wg.Done()
+			s.accept(listener)
+		}(listener)
+	}
+	wg.Wait()
+}
+
+// listen makes the listeners asked for by WithNetwork, WithAddress,
+// WithWebSocket and WithTLS
+func (s *server) listen() ([]transport.Listener, error) {
+	var config *tls.Config
+	if s.certFile != "" {
+		var err error
+		config, err = tlsutil.ServerConfig(s.certFile, s.keyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	listener, err := net.Listen(s.network, s.address)
 	if err != nil {
-		fmt.Printf("[server.NewServer] net.Listen() returned error: %+v\n", err)
-		return
+		return nil, err
+	}
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+	listeners := []transport.Listener{transport.NewStreamListener(listener, s.framer)}
+
+	if s.wsAddress != "" {
+		wsListener, err := ws.Listen(s.wsAddress, ws.DEFAULT_PATH, config, int64(s.framer.MaxFrameSize()))
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		listeners = append(listeners, wsListener)
 	}
+
+	return listeners, nil
+}
+
+func (s *server) accept(listener transport.Listener) {
 	for {
-		connection, err := listener.Accept()
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
-			log.Printf("[server.NewServer] listener.Accept() returned error: %+v\n", err)
+			log.Printf("[server.accept] listener.Accept() returned error: %+v\n", err)
+			continue
 		}
-		client := client.NewClient(client.WithConnection(connection))
-		s.connManager.Register(client)
-		go s.connManager.Receive(client)
-		go s.connManager.Send(client)
+		s.serve(conn)
+	}
+}
+
+// serve hands a new connection to the manager whatever it came from
+func (s *server) serve(conn client.Conn) {
+	c := client.NewClient(
+		client.WithMessageConn(codec.NewServerConn(conn)),
+		client.WithQueueSize(s.queueSize),
+		client.WithReadTimeout(s.readTimeout),
+		client.WithWriteTimeout(s.writeTimeout))
+
+	err := s.connManager.Register(c)
+	if err != nil {
+		log.Printf("[server.serve] Register() returned error: %+v\n", err)
+		c.Close()
+		return
+	}
+
+	go s.connManager.Receive(c)
+	go s.connManager.Send(c)
+}
+
+// WithListeners serves connections from every listener at once, see
+// transport.Listen, it replaces the listeners made from WithAddress,
+// WithNetwork, WithWebSocket and WithTLS, listeners frame connections
+// themselves so WithMaxFrameSize does not apply to them
+func WithListeners(listeners ...transport.Listener) ServerOpts {
+	return func(s *server) {
+		s.listeners = append(s.listeners, listeners...)
 	}
 }
 
@@ -216,6 +480,50 @@ func WithNetwork(network string) ServerOpts {
 	}
 }
 
+func WithMaxFrameSize(size uint32) ServerOpts {
+	return func(s *server) {
+		s.framer = frame.NewFramer(frame.WithMaxFrameSize(size))
+	}
+}
+
+// WithQueueSize bounds how many frames may wait to be written to each
+// connection, what happens past that is up to the manager overflow policy
+func WithQueueSize(size int) ServerOpts {
+	return func(s *server) {
+		s.queueSize = size
+	}
+}
+
+// WithWebSocket also accepts WebSocket connections on address at
+// ws.DEFAULT_PATH, they are served over TLS too when WithTLS is set
+func WithWebSocket(address string) ServerOpts {
+	return func(s *server) {
+		s.wsAddress = address
+	}
+}
+
+// WithTLS serves connections over TLS with the given certificate
+func WithTLS(certFile string, keyFile string) ServerOpts {
+	return func(s *server) {
+		s.certFile = certFile
+		s.keyFile = keyFile
+	}
+}
+
+func WithReadTimeout(d time.Duration) ServerOpts {
+	return func(s *server) {
+		s.readTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds how long a frame may take to go out, a peer that
+// stops reading is closed instead of holding its writer forever
+func WithWriteTimeout(d time.Duration) ServerOpts {
+	return func(s *server) {
+		s.writeTimeout = d
+	}
+}
+
 func WithConnectionManager(manager ConnectionManager) ServerOpts {
 	return func(s *server) {
 		s.connManager = manager
@@ -224,8 +532,11 @@ func WithConnectionManager(manager ConnectionManager) ServerOpts {
 
 func NewServer(opts ...ServerOpts) Server {
 	s := &server{
-		address: ":42069",
-		network: "tcp",
+		address:      ":42069",
+		network:      "tcp",
+		framer:       frame.NewFramer(),
+		queueSize:    client.DEFAULT_QUEUE_SIZE,
+		writeTimeout: DEFAULT_WRITE_TIMEOUT,
 	}
 
 	for _, opt := range opts {
@@ -233,16 +544,138 @@ func NewServer(opts ...ServerOpts) Server {
 	}
 
 	if s.connManager == nil {
-		s.connManager = &connManager{
-			clients:    make(map[client.Client]bool),
-			logged:     make(map[string]client.Client),
-			broadcast:  make(chan *chatmessage.ChatMessage),
-			register:   make(chan client.Client),
-			unregister: make(chan client.Client),
-		}
+		s.connManager = NewConnectionManager()
 	}
 
 	go s.connManager.Start()
 
 	return s
 }
+
+func WithServerID(id string) ConnManagerOpts {
+	return func(man *connManager) {
+		man.serverID = id
+	}
+}
+
+func WithChallengeTTL(ttl time.Duration) ConnManagerOpts {
+	return func(man *connManager) {
+		man.challengeTTL = ttl
+	}
+}
+
+// WithMessageSkew bounds how far a peer message timestamp may drift from the
+// server clock before the message is refused as stale
+func WithMessageSkew(skew time.Duration) ConnManagerOpts {
+	return func(man *connManager) {
+		man.messageSkew = skew
+	}
+}
+
+// WithMailbox keeps messages for offline keys in m instead of the default
+// in memory mailbox
+func WithMailbox(m mailbox.Mailbox) ConnManagerOpts {
+	return func(man *connManager) {
+		man.mailbox = m
+	}
+}
+
+// WithRevocations keeps revoked device keys in r, the default keeps them in
+// memory so they only hold until the server restarts
+func WithRevocations(r Revocations) ConnManagerOpts {
+	return func(man *connManager) {
+		man.revocations = r
+	}
+}
+
+// WithRateLimit caps how many frames a single connection may send per
+// period, a limit of zero disables rate limiting
+func WithRateLimit(limit int, period time.Duration) ConnManagerOpts {
+	return func(man *connManager) {
+		man.rateLimit = limit
+		man.ratePeriod = period
+	}
+}
+
+// WithHeartbeat pings sessions quiet for interval and evicts them after
+// misses intervals without a frame, an interval of zero disables it
+func WithHeartbeat(interval time.Duration, misses int) ConnManagerOpts {
+	return func(man *connManager) {
+		man.heartbeatInterval = interval
+		man.heartbeatMisses = misses
+		if misses < 1 {
+			man.heartbeatMisses = 1
+		}
+	}
+}
+
+// WithCodecs replaces the binary encodings offered to clients, none keeps
+// every connection on JSON
+func WithCodecs(codecs ...string) ConnManagerOpts {
+	return func(man *connManager) {
+		man.codecs = codecs
+	}
+}
+
+func WithOverflowPolicy(policy OverflowPolicy) ConnManagerOpts {
+	return func(man *connManager) {
+		man.overflowPolicy = policy
+	}
+}
+
+func NewConnectionManager(opts ...ConnManagerOpts) ConnectionManager {
+	man := &connManager{
+		clients:           make(map[client.Client]bool),
+		logged:            make(map[string]map[string]client.Client),
+		devices:           make(map[string]map[string]*device),
+		broadcast:         make(chan *outgoing),
+		ops:               make(chan func()),
+		handlers:          make(map[string]MessageHandler),
+		challengeTTL:      DEFAULT_CHALLENGE_TTL,
+		messageSkew:       DEFAULT_MESSAGE_SKEW,
+		seen:              user_message.NewReplayCache(REPLAY_CACHE_SIZE),
+		rooms:             make(map[string]*room),
+		presence:          make(map[string]*presence),
+		watchers:          make(map[string]map[string]bool),
+		watching:          make(map[string][]string),
+		rateLimit:         DEFAULT_RATE_LIMIT,
+		ratePeriod:        DEFAULT_RATE_PERIOD,
+		overflowPolicy:    DEFAULT_OVERFLOW_POLICY,
+		heartbeatInterval: DEFAULT_HEARTBEAT_INTERVAL,
+		heartbeatMisses:   DEFAULT_HEARTBEAT_MISSES,
+		codecs:            []string{codec.PROTO},
+	}
+
+	for _, opt := range opts {
+		opt(man)
+	}
+
+	if man.mailbox == nil {
+		man.mailbox = mailbox.NewMailbox()
+	}
+
+	if man.revocations == nil {
+		man.revocations = &revocations{revoked: make(map[string]*Revocation)}
+	}
+
+	if man.serverID == "" {
+		man.serverID = newServerID()
+	}
+
+	metrics.Set(SEND_QUEUES_METRIC, expvar.Func(func() interface{} {
+		return man.queueStats()
+	}))
+
+	man.Handle(chatmessage.LOGIN_MSG, man.handleLogin)
+	man.Handle(chatmessage.PEER_MSG, man.handlePeer)
+	man.Handle(chatmessage.ROOM_OP_MSG, man.handleRoom)
+	man.Handle(chatmessage.ROOM_MSG, man.handleRoom)
+	man.Handle(chatmessage.PRESENCE_SUB_MSG, man.handlePresence)
+	man.Handle(chatmessage.PRESENCE_SET_MSG, man.handlePresence)
+	man.Handle(chatmessage.DEVICE_LIST_MSG, man.handleDevices)
+	man.Handle(chatmessage.DEVICE_REVOKE_MSG, man.handleDevices)
+	man.Handle(chatmessage.PING_MSG, man.handleHeartbeat)
+	man.Handle(chatmessage.PONG_MSG, man.handleHeartbeat)
+
+	return man
+}
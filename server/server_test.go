@@ -0,0 +1,431 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"pogchat/frame"
+	"pogchat/key"
+	"pogchat/ratchet"
+	"pogchat/user_message"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// peer is the far end of a connection served by a manager
+type peer struct {
+	conn   client.Conn
+	server client.Client
+}
+
+func connect(t *testing.T, man *connManager) *peer {
+	local, remote := net.Pipe()
+	c := client.NewClient(client.WithConnection(remote))
+	assert.Nil(t, man.Register(c))
+	go man.Receive(c)
+	go man.Send(c)
+	return &peer{conn: client.NewStreamConn(local, frame.NewFramer()), server: c}
+}
+
+func (p *peer) read(msgType string) (*chatmessage.ChatMessage, error) {
+	for {
+		payload, err := p.conn.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		msg := &chatmessage.ChatMessage{}
+		err = json.Unmarshal(payload, msg)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type == msgType {
+			return msg, nil
+		}
+	}
+}
+
+func (p *peer) write(msg *chatmessage.ChatMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return p.conn.WriteFrame(payload)
+}
+
+func (p *peer) login(pair key.KeyPair, deviceID string) error {
+	msg, err := p.read(chatmessage.CHALLENGE_MSG)
+	if err != nil {
+		return err
+	}
+	challenge := &chatmessage.Challenge{}
+	err = json.Unmarshal([]byte(msg.Payload), challenge)
+	if err != nil {
+		return err
+	}
+
+	login := &chatmessage.Login{
+		PublicKey: pair.PublicKey(),
+		Nonce:     challenge.Nonce,
+		ServerID:  challenge.ServerID,
+		Timestamp: time.Now().Unix(),
+		DeviceID:  deviceID,
+	}
+	err = signLogin(pair, login)
+	if err != nil {
+		return err
+	}
+
+	chatMsg, err := chatmessage.NewChatMessage(chatmessage.LOGIN_MSG, login)
+	if err != nil {
+		return err
+	}
+	err = p.write(chatMsg)
+	if err != nil {
+		return err
+	}
+
+	msg, err = p.read(chatmessage.STATUS_MSG)
+	if err != nil {
+		return err
+	}
+	status, err := chatmessage.ParseStatus(msg)
+	if err != nil {
+		return err
+	}
+	if status.Code != chatmessage.LOGGED_IN {
+		return fmt.Errorf("login failed with %s: %s", status.Code, status.Reason)
+	}
+	return nil
+}
+
+// signLogin signs login with pair and the key of its device, device keys
+// are derived from the identity and the device id so a device logging in
+// again presents the same one
+func signLogin(pair key.KeyPair, login *chatmessage.Login) error {
+	seed := sha256.Sum256(append(append([]byte{}, pair.PublicKey()...), login.DeviceID...))
+	device := ed25519.NewKeyFromSeed(seed[:])
+
+	var err error
+	login.DeviceKey, err = key.MarshalEd25519PublicKey(device.Public().(ed25519.PublicKey))
+	if err != nil {
+		return err
+	}
+	devicePrivate, err := key.MarshalEd25519PrivateKey(device)
+	if err != nil {
+		return err
+	}
+
+	login.Signature, err = signer.Sign(pair.PrivateKey(), login.SigningBytes())
+	if err != nil {
+		return err
+	}
+	login.DeviceSignature, err = signer.Sign(devicePrivate, login.DeviceSigningBytes())
+	return err
+}
+
+// drained reports whether the manager forgot every connection
+func drained(man *connManager) bool {
+	var empty bool
+	man.exec(func() {
+		empty = len(man.clients) == 0 && len(man.logged) == 0
+	})
+	return empty
+}
+
+func TestConnectionStorm(t *testing.T) {
+	const CONNECTIONS = 64
+
+	newManager := func() *connManager {
+		man := NewConnectionManager(WithRateLimit(0, time.Second)).(*connManager)
+		go man.Start()
+		return man
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "connect and disconnect",
+			f: func(t *testing.T) {
+				man := newManager()
+				wg := sync.WaitGroup{}
+				for i := 0; i < CONNECTIONS; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						p := connect(t, man)
+						// half of them hang up before reading anything
+						if i%2 == 0 {
+							p.read(chatmessage.CHALLENGE_MSG)
+						}
+						p.conn.Close()
+					}(i)
+				}
+				wg.Wait()
+
+				assert.Eventually(t, func() bool { return drained(man) }, 5*time.Second, 10*time.Millisecond)
+			},
+		},
+		{
+			name: "login and disconnect",
+			f: func(t *testing.T) {
+				man := newManager()
+				wg := sync.WaitGroup{}
+				peers := make([]*peer, CONNECTIONS)
+				for i := 0; i < CONNECTIONS; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						pair, err := key.NewEd25519KeyPair()
+						assert.Nil(t, err)
+						p := connect(t, man)
+						peers[i] = p
+						assert.Nil(t, p.login(pair, ""))
+						p.conn.Close()
+					}(i)
+				}
+				wg.Wait()
+
+				assert.Eventually(t, func() bool { return drained(man) }, 5*time.Second, 10*time.Millisecond)
+				for _, p := range peers {
+					assert.Equal(t, client.CLOSED, p.server.State())
+				}
+			},
+		},
+		{
+			name: "devices of one key come and go",
+			f: func(t *testing.T) {
+				man := newManager()
+				pair, err := key.NewEd25519KeyPair()
+				assert.Nil(t, err)
+				pk := base64.RawStdEncoding.EncodeToString(pair.PublicKey())
+
+				wg := sync.WaitGroup{}
+				for i := 0; i < CONNECTIONS; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						p := connect(t, man)
+						// devices share ids so logins replace each other
+						p.login(pair, fmt.Sprintf("device-%d", i%4))
+						p.conn.Close()
+					}(i)
+				}
+				wg.Wait()
+
+				assert.Eventually(t, func() bool { return drained(man) }, 5*time.Second, 10*time.Millisecond)
+				man.exec(func() {
+					assert.Equal(t, chatmessage.OFFLINE, man.presence[pk].status)
+					assert.Len(t, man.devices[pk], 4)
+				})
+			},
+		},
+		{
+			name: "unregister forgets a logged in connection",
+			f: func(t *testing.T) {
+				man := newManager()
+				pair, err := key.NewEd25519KeyPair()
+				assert.Nil(t, err)
+				p := connect(t, man)
+				assert.Nil(t, p.login(pair, "laptop"))
+				assert.Equal(t, client.AUTHENTICATED, p.server.State())
+
+				assert.Nil(t, man.Unregister(p.server))
+				assert.Equal(t, client.CLOSED, p.server.State())
+				assert.True(t, drained(man))
+
+				select {
+				case <-p.server.Done():
+				case <-time.After(time.Second):
+					t.Fatal("writer was not told to stop")
+				}
+				assert.ErrorIs(t, p.server.Enqueue([]byte("late")), client.ConnectionClosedError)
+				assert.ErrorIs(t, man.Register(p.server), ConnectionStateError)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
+
+func TestRejectedMessage(t *testing.T) {
+	// send signs um with pair and returns the status the server answers
+	send := func(t *testing.T, p *peer, pair key.KeyPair, um user_message.UserMessage) *chatmessage.Status {
+		_, err := um.Sign(pair.PrivateKey())
+		assert.Nil(t, err)
+		payload, err := um.MarshalJSON()
+		assert.Nil(t, err)
+		assert.Nil(t, p.write(&chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, Payload: string(payload)}))
+
+		msg, err := p.read(chatmessage.STATUS_MSG)
+		assert.Nil(t, err)
+		status, err := chatmessage.ParseStatus(msg)
+		assert.Nil(t, err)
+		return status
+	}
+
+	newMessage := func(pair key.KeyPair, timestamp int64) user_message.UserMessage {
+		return user_message.NewUserMessage(
+			user_message.WithFromPublicKey(pair.PublicKey()),
+			user_message.WithToPublicKey([]byte("nobody")),
+			user_message.WithTimestamp(timestamp),
+			user_message.WithMessage([]byte("hi")))
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "stale message is reported as stale",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				go man.Start()
+				pair, err := key.NewEd25519KeyPair()
+				assert.Nil(t, err)
+				p := connect(t, man)
+				assert.Nil(t, p.login(pair, "laptop"))
+
+				old := time.Now().Add(-2 * DEFAULT_MESSAGE_SKEW).Unix()
+				status := send(t, p, pair, newMessage(pair, old))
+				assert.Equal(t, chatmessage.STALE_MESSAGE, status.Code)
+			},
+		},
+		{
+			name: "replayed message is reported as replayed",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				go man.Start()
+				pair, err := key.NewEd25519KeyPair()
+				assert.Nil(t, err)
+				p := connect(t, man)
+				assert.Nil(t, p.login(pair, "laptop"))
+
+				um := newMessage(pair, time.Now().Unix())
+				assert.NotEqual(t, chatmessage.REPLAYED_MESSAGE, send(t, p, pair, um).Code)
+				assert.Equal(t, chatmessage.REPLAYED_MESSAGE, send(t, p, pair, um).Code)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
+
+func TestRatchetDevices(t *testing.T) {
+	alicePair, err := key.NewEd25519KeyPair()
+	assert.Nil(t, err)
+	bobPair, err := key.NewEd25519KeyPair()
+	assert.Nil(t, err)
+
+	// send encrypts text in the ratchet session of from and relays it
+	send := func(t *testing.T, p *peer, from ratchet.Manager, pair key.KeyPair, to []byte, text string) {
+		msg, err := from.Encrypt(to, []byte(text))
+		assert.Nil(t, err)
+		um := user_message.NewUserMessage(
+			user_message.WithType(user_message.RATCHET_MESSAGE),
+			user_message.WithFromPublicKey(pair.PublicKey()),
+			user_message.WithToPublicKey(to),
+			user_message.WithMessage(msg))
+		_, err = um.Sign(pair.PrivateKey())
+		assert.Nil(t, err)
+		payload, err := um.MarshalJSON()
+		assert.Nil(t, err)
+		assert.Nil(t, p.write(&chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, Payload: string(payload)}))
+	}
+
+	// receive reads the next peer message of p and decrypts it in at
+	receive := func(t *testing.T, p *peer, at ratchet.Manager, text string) {
+		msg, err := p.read(chatmessage.PEER_MSG)
+		assert.Nil(t, err)
+		um, err := user_message.ParseFromJSON(msg.Payload)
+		assert.Nil(t, err)
+		plaintext, err := at.Decrypt(um.FromPublicKey(), um.Message())
+		assert.Nil(t, err)
+		assert.Equal(t, text, string(plaintext))
+	}
+
+	refused := func(t *testing.T, p *peer) {
+		msg, err := p.read(chatmessage.STATUS_MSG)
+		assert.Nil(t, err)
+		status, err := chatmessage.ParseStatus(msg)
+		assert.Nil(t, err)
+		assert.Equal(t, chatmessage.SESSION_REFUSED, status.Code)
+	}
+
+	sessions := func(pair key.KeyPair) ratchet.Manager {
+		return ratchet.NewManager(ratchet.WithIdentity(pair.PublicKey(), pair.PrivateKey()))
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "second device of the recipient stops new ratchet messages",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				go man.Start()
+				alice, laptop, phone := connect(t, man), connect(t, man), connect(t, man)
+				assert.Nil(t, alice.login(alicePair, "laptop"))
+				assert.Nil(t, laptop.login(bobPair, "laptop"))
+
+				a, b := sessions(alicePair), sessions(bobPair)
+				send(t, alice, a, alicePair, bobPair.PublicKey(), "hello")
+				receive(t, laptop, b, "hello")
+				send(t, laptop, b, bobPair, alicePair.PublicKey(), "hi")
+				receive(t, alice, a, "hi")
+
+				assert.Nil(t, phone.login(bobPair, "phone"))
+				send(t, alice, a, alicePair, bobPair.PublicKey(), "which one of you")
+				refused(t, alice)
+				send(t, laptop, b, bobPair, alicePair.PublicKey(), "me")
+				refused(t, laptop)
+			},
+		},
+		{
+			name: "sender with several devices is refused until they are revoked",
+			f: func(t *testing.T) {
+				man := NewConnectionManager().(*connManager)
+				go man.Start()
+				laptop, phone, bob := connect(t, man), connect(t, man), connect(t, man)
+				assert.Nil(t, laptop.login(alicePair, "laptop"))
+				assert.Nil(t, phone.login(alicePair, "phone"))
+				assert.Nil(t, bob.login(bobPair, "laptop"))
+
+				fromLaptop, fromPhone, b := sessions(alicePair), sessions(alicePair), sessions(bobPair)
+				send(t, laptop, fromLaptop, alicePair, bobPair.PublicKey(), "from the laptop")
+				refused(t, laptop)
+				send(t, phone, fromPhone, alicePair, bobPair.PublicKey(), "from the phone")
+				refused(t, phone)
+
+				revoke, err := chatmessage.NewChatMessage(chatmessage.DEVICE_REVOKE_MSG, &chatmessage.DeviceRevoke{ID: "phone"})
+				assert.Nil(t, err)
+				assert.Nil(t, laptop.write(revoke))
+				_, err = laptop.read(chatmessage.DEVICE_LIST_MSG)
+				assert.Nil(t, err)
+
+				send(t, laptop, fromLaptop, alicePair, bobPair.PublicKey(), "only me now")
+				receive(t, bob, b, "only me now")
+				send(t, bob, b, bobPair, alicePair.PublicKey(), "got it")
+				receive(t, laptop, fromLaptop, "got it")
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
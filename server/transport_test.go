@@ -0,0 +1,250 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	chatmessage "pogchat/chat_message"
+	"pogchat/codec"
+	"pogchat/frame"
+	"pogchat/key"
+	"pogchat/rpc"
+	"pogchat/transport"
+	"pogchat/user_message"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestTransport(t *testing.T) {
+	// listen serves a fresh manager on every url and returns the listeners
+	// in the same order
+	listen := func(t *testing.T, urls ...string) (*connManager, []transport.Listener) {
+		man := NewConnectionManager().(*connManager)
+		listeners := []transport.Listener{}
+		for _, u := range urls {
+			l, err := transport.Listen(u)
+			assert.Nil(t, err)
+			t.Cleanup(func() { l.Close() })
+			listeners = append(listeners, l)
+		}
+
+		go NewServer(WithConnectionManager(man), WithListeners(listeners...)).Start()
+		return man, listeners
+	}
+
+	dial := func(t *testing.T, scheme string, l transport.Listener, opts ...transport.TransportOpts) *peer {
+		u := scheme + "://" + l.Addr().String()
+		if scheme == transport.WS_SCHEME {
+			u += "/ws"
+		}
+		conn, err := transport.Dial(u, opts...)
+		assert.Nil(t, err)
+		return &peer{conn: conn}
+	}
+
+	unixURL := func(t *testing.T) string {
+		return "unix://" + filepath.Join(t.TempDir(), "s.sock")
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "websocket client logs in",
+			f: func(t *testing.T) {
+				man, listeners := listen(t, "ws://127.0.0.1:0/ws")
+				pair, err := key.NewEd25519KeyPair()
+				assert.Nil(t, err)
+
+				p := dial(t, transport.WS_SCHEME, listeners[0])
+				assert.Nil(t, p.login(pair, "browser"))
+
+				p.conn.Close()
+				assert.Eventually(t, func() bool { return drained(man) }, time.Second, 10*time.Millisecond)
+			},
+		},
+		{
+			name: "every listener is served at once",
+			f: func(t *testing.T) {
+				schemes := []string{transport.TCP_SCHEME, transport.UNIX_SCHEME, transport.WS_SCHEME, transport.GRPC_SCHEME}
+				man, listeners := listen(t, "tcp://127.0.0.1:0", unixURL(t), "ws://127.0.0.1:0/ws", "grpc://127.0.0.1:0")
+
+				peers := []*peer{}
+				for i, l := range listeners {
+					pair, err := key.NewEd25519KeyPair()
+					assert.Nil(t, err)
+					p := dial(t, schemes[i], l)
+					assert.Nil(t, p.login(pair, schemes[i]))
+					peers = append(peers, p)
+				}
+
+				for _, p := range peers {
+					p.conn.Close()
+				}
+				assert.Eventually(t, func() bool { return drained(man) }, time.Second, 10*time.Millisecond)
+			},
+		},
+		{
+			name: "clients of different transports share the manager",
+			f: func(t *testing.T) {
+				_, listeners := listen(t, "ws://127.0.0.1:0/ws", "grpc://127.0.0.1:0")
+				alice, err := key.NewEd25519KeyPair()
+				assert.Nil(t, err)
+				bob, err := key.NewEd25519KeyPair()
+				assert.Nil(t, err)
+
+				overWS := dial(t, transport.WS_SCHEME, listeners[0])
+				assert.Nil(t, overWS.login(alice, "browser"))
+				overGRPC := dial(t, transport.GRPC_SCHEME, listeners[1])
+				assert.Nil(t, overGRPC.login(bob, "service"))
+
+				// bob subscribing to alice sees her online through the
+				// other transport
+				sub, err := chatmessage.NewChatMessage(chatmessage.PRESENCE_SUB_MSG, &chatmessage.PresenceSubscribe{
+					Keys: [][]byte{alice.PublicKey()},
+				})
+				assert.Nil(t, err)
+				assert.Nil(t, overGRPC.write(sub))
+
+				msg, err := overGRPC.read(chatmessage.PRESENCE_MSG)
+				assert.Nil(t, err)
+				presence, err := chatmessage.ParsePresence(msg)
+				assert.Nil(t, err)
+				assert.Equal(t, chatmessage.ONLINE, presence.Status)
+			},
+		},
+		{
+			name: "signed peer messages cross every codec",
+			f: func(t *testing.T) {
+				_, listeners := listen(t, "tcp://127.0.0.1:0", "grpc://127.0.0.1:0", "ws://127.0.0.1:0/ws")
+				pairs := []key.KeyPair{}
+				for i := 0; i < 3; i++ {
+					pair, err := key.NewEd25519KeyPair()
+					assert.Nil(t, err)
+					pairs = append(pairs, pair)
+				}
+
+				overProto := dial(t, transport.TCP_SCHEME, listeners[0])
+				assert.Nil(t, overProto.login(pairs[0], "proto"))
+				overGRPC := dial(t, transport.GRPC_SCHEME, listeners[1])
+				assert.Nil(t, overGRPC.login(pairs[1], "grpc"))
+				overJSON := dial(t, transport.WS_SCHEME, listeners[2], transport.WithCodec(codec.JSON))
+				assert.Nil(t, overJSON.login(pairs[2], "json"))
+
+				for i, to := range []*peer{overGRPC, overJSON} {
+					um := user_message.NewUserMessage(
+						user_message.WithFromPublicKey(pairs[0].PublicKey()),
+						user_message.WithToPublicKey(pairs[i+1].PublicKey()),
+						user_message.WithMessage([]byte("hi")))
+					_, err := um.Sign(pairs[0].PrivateKey())
+					assert.Nil(t, err)
+					payload, err := um.MarshalJSON()
+					assert.Nil(t, err)
+					assert.Nil(t, overProto.write(&chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, Payload: string(payload)}))
+
+					msg, err := to.read(chatmessage.PEER_MSG)
+					assert.Nil(t, err)
+					got, err := user_message.ParseFromJSON(msg.Payload)
+					assert.Nil(t, err)
+					assert.Nil(t, got.Verify(), "message must verify after crossing codecs")
+					assert.Equal(t, []byte("hi"), got.Message())
+				}
+			},
+		},
+		{
+			name: "generated client speaks typed frames",
+			f: func(t *testing.T) {
+				_, listeners := listen(t, "grpc://127.0.0.1:0")
+				pair, err := key.NewEd25519KeyPair()
+				assert.Nil(t, err)
+
+				conn, err := grpc.Dial(listeners[0].Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+				assert.Nil(t, err)
+				defer conn.Close()
+				stream, err := rpc.NewRelayClient(conn).Session(context.Background())
+				assert.Nil(t, err)
+
+				frame, err := stream.Recv()
+				assert.Nil(t, err)
+				challenge := frame.GetChallenge()
+				assert.NotNil(t, challenge)
+
+				login := &chatmessage.Login{
+					PublicKey: pair.PublicKey(),
+					Nonce:     challenge.GetNonce(),
+					ServerID:  challenge.GetServerId(),
+					Timestamp: time.Now().Unix(),
+				}
+				assert.Nil(t, signLogin(pair, login))
+				assert.Nil(t, stream.Send(&rpc.ClientFrame{Frame: &rpc.ClientFrame_Login{Login: &rpc.Login{
+					PublicKey:       login.PublicKey,
+					Nonce:           login.Nonce,
+					ServerId:        login.ServerID,
+					Timestamp:       login.Timestamp,
+					Signature:       login.Signature,
+					DeviceKey:       login.DeviceKey,
+					DeviceSignature: login.DeviceSignature,
+				}}}))
+
+				for {
+					frame, err = stream.Recv()
+					if !assert.Nil(t, err) {
+						return
+					}
+					if status := frame.GetStatus(); status != nil {
+						assert.Equal(t, string(chatmessage.LOGGED_IN), status.GetCode())
+						return
+					}
+				}
+			},
+		},
+		{
+			name: "oversized websocket message closes the connection",
+			f: func(t *testing.T) {
+				man, listeners := listen(t, "ws://127.0.0.1:0/ws")
+
+				// JSON leaves the frame as it is
+				p := dial(t, transport.WS_SCHEME, listeners[0], transport.WithCodec(codec.JSON))
+				_, err := p.read(chatmessage.CHALLENGE_MSG)
+				assert.Nil(t, err)
+
+				p.conn.WriteFrame(make([]byte, frame.DEFAULT_MAX_FRAME_SIZE+1))
+				assert.Eventually(t, func() bool { return drained(man) }, time.Second, 10*time.Millisecond)
+			},
+		},
+		{
+			name: "server stops once every listener is closed",
+			f: func(t *testing.T) {
+				listeners := []transport.Listener{}
+				for _, u := range []string{"tcp://127.0.0.1:0", "ws://127.0.0.1:0/ws", "grpc://127.0.0.1:0"} {
+					l, err := transport.Listen(u)
+					assert.Nil(t, err)
+					listeners = append(listeners, l)
+				}
+
+				done := make(chan struct{})
+				go func() {
+					NewServer(WithListeners(listeners...)).Start()
+					close(done)
+				}()
+
+				for _, l := range listeners {
+					l.Close()
+				}
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatal("server kept serving closed listeners")
+				}
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
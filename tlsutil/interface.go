@@ -0,0 +1,13 @@
+package tlsutil
+
+import "errors"
+
+var (
+	NoCertificateError = errors.New("no certificate in file")
+	PinMismatchError   = errors.New("server certificate does not match the pinned key")
+	InvalidPinError    = errors.New("pin must be a hex encoded sha256")
+	PinAndCAError      = errors.New("set either a CA file or a pin, not both")
+	NoServerCertError  = errors.New("server did not present a certificate")
+)
+
+type ClientOpts func(*clientConfig)
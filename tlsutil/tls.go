@@ -0,0 +1,165 @@
+package tlsutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// clientConfig is how a client decides to trust the server, either a CA
+// (the system roots when no file is given) or a pin on the server key
+type clientConfig struct {
+	caFile     string
+	pin        []byte
+	serverName string
+}
+
+// ServerConfig loads the certificate a server presents
+func ServerConfig(certFile string, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// WithCAFile trusts servers whose certificate chains to a CA in file
+// instead of the system roots
+func WithCAFile(file string) ClientOpts {
+	return func(c *clientConfig) {
+		c.caFile = file
+	}
+}
+
+// WithPin trusts exactly the server whose key hashes to pin, see
+// Fingerprint, the certificate may be self signed and can be renewed as
+// long as the key stays the same
+func WithPin(pin []byte) ClientOpts {
+	return func(c *clientConfig) {
+		c.pin = pin
+	}
+}
+
+func WithServerName(name string) ClientOpts {
+	return func(c *clientConfig) {
+		c.serverName = name
+	}
+}
+
+// ClientConfig verifies the server with the pin or the CA file, giving
+// both is refused since one would silently win over the other, giving
+// neither trusts the system roots
+func ClientConfig(opts ...ClientOpts) (*tls.Config, error) {
+	c := &clientConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if len(c.pin) > 0 && c.caFile != "" {
+		return nil, PinAndCAError
+	}
+
+	config := &tls.Config{
+		ServerName: c.serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(c.pin) > 0 {
+		if len(c.pin) != sha256.Size {
+			return nil, InvalidPinError
+		}
+
+		// the chain is not checked against any CA, the pin replaces it
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyPin(c.pin)
+		return config, nil
+	}
+
+	if c.caFile != "" {
+		pool, err := loadPool(c.caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+func verifyPin(pin []byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return NoServerCertError
+		}
+
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+
+		got := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if !bytes.Equal(got[:], pin) {
+			return PinMismatchError
+		}
+		return nil
+	}
+}
+
+func loadPool(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%w: %s", NoCertificateError, file)
+	}
+	return pool, nil
+}
+
+// Fingerprint is the sha256 of the public key in the first certificate of
+// a PEM file, it is what clients pin
+func Fingerprint(certFile string) ([]byte, error) {
+	b, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	blk, _ := pem.Decode(b)
+	if blk == nil || blk.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%w: %s", NoCertificateError, certFile)
+	}
+
+	cert, err := x509.ParseCertificate(blk.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:], nil
+}
+
+// ParsePin reads a pin as printed by FormatPin, colons and case are
+// ignored
+func ParsePin(pin string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+	if err != nil || len(b) != sha256.Size {
+		return nil, InvalidPinError
+	}
+	return b, nil
+}
+
+func FormatPin(pin []byte) string {
+	return hex.EncodeToString(pin)
+}
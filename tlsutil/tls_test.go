@@ -0,0 +1,136 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLS(t *testing.T) {
+	// serve listens with a fresh self signed certificate and returns where
+	// its files are
+	serve := func(t *testing.T) (addr string, certFile string) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		assert.Nil(t, WriteSelfSigned(certFile, keyFile, []string{"localhost", "127.0.0.1"}))
+
+		config, err := ServerConfig(certFile, keyFile)
+		assert.Nil(t, err)
+
+		l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+		assert.Nil(t, err)
+		t.Cleanup(func() { l.Close() })
+
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					conn.(*tls.Conn).Handshake()
+					conn.Close()
+				}()
+			}
+		}()
+
+		return l.Addr().String(), certFile
+	}
+
+	dial := func(addr string, opts ...ClientOpts) error {
+		config, err := ClientConfig(append([]ClientOpts{WithServerName("localhost")}, opts...)...)
+		if err != nil {
+			return err
+		}
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", addr, config)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "self signed certificate works as its own CA",
+			f: func(t *testing.T) {
+				addr, certFile := serve(t)
+				assert.Nil(t, dial(addr, WithCAFile(certFile)))
+			},
+		},
+		{
+			name: "unknown CA is refused",
+			f: func(t *testing.T) {
+				addr, _ := serve(t)
+				_, otherCert := serve(t)
+				assert.NotNil(t, dial(addr, WithCAFile(otherCert)))
+			},
+		},
+		{
+			name: "pinned key is accepted",
+			f: func(t *testing.T) {
+				addr, certFile := serve(t)
+				pin, err := Fingerprint(certFile)
+				assert.Nil(t, err)
+				assert.Nil(t, dial(addr, WithPin(pin)))
+			},
+		},
+		{
+			name: "other key is refused",
+			f: func(t *testing.T) {
+				addr, _ := serve(t)
+				_, otherCert := serve(t)
+				pin, err := Fingerprint(otherCert)
+				assert.Nil(t, err)
+				assert.ErrorIs(t, dial(addr, WithPin(pin)), PinMismatchError)
+			},
+		},
+		{
+			name: "pin and CA together are refused",
+			f: func(t *testing.T) {
+				addr, certFile := serve(t)
+				pin, err := Fingerprint(certFile)
+				assert.Nil(t, err)
+				assert.ErrorIs(t, dial(addr, WithPin(pin), WithCAFile(certFile)), PinAndCAError)
+			},
+		},
+		{
+			name: "pin round trips",
+			f: func(t *testing.T) {
+				_, certFile := serve(t)
+				pin, err := Fingerprint(certFile)
+				assert.Nil(t, err)
+
+				parsed, err := ParsePin(FormatPin(pin))
+				assert.Nil(t, err)
+				assert.Equal(t, pin, parsed)
+
+				_, err = ParsePin("abcd")
+				assert.ErrorIs(t, err, InvalidPinError)
+			},
+		},
+		{
+			name: "key file is private",
+			f: func(t *testing.T) {
+				dir := t.TempDir()
+				keyFile := filepath.Join(dir, "key.pem")
+				assert.Nil(t, WriteSelfSigned(filepath.Join(dir, "cert.pem"), keyFile, nil))
+
+				info, err := os.Stat(keyFile)
+				assert.Nil(t, err)
+				assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
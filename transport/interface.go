@@ -0,0 +1,22 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"pogchat/client"
+)
+
+var (
+	UnsupportedSchemeError = errors.New("unsupported transport scheme")
+	MissingTLSConfigError  = errors.New("listening over tls needs a certificate")
+)
+
+// Listener accepts connections that already carry whole frames, it fails
+// with net.ErrClosed once closed
+type Listener interface {
+	Accept() (client.Conn, error)
+	Close() error
+	Addr() net.Addr
+}
+
+type TransportOpts func(*transport)
@@ -0,0 +1,36 @@
+package transport
+
+import (
+	"net"
+	"pogchat/client"
+	"pogchat/frame"
+)
+
+// streamListener frames the connections of a byte stream listener such as
+// TCP, TLS or a Unix domain socket
+type streamListener struct {
+	listener net.Listener
+	framer   frame.Framer
+}
+
+var _ Listener = (*streamListener)(nil)
+
+func NewStreamListener(listener net.Listener, framer frame.Framer) Listener {
+	return &streamListener{listener: listener, framer: framer}
+}
+
+func (l *streamListener) Accept() (client.Conn, error) {
+	conn, err := l.listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return client.NewStreamConn(conn, l.framer), nil
+}
+
+func (l *streamListener) Close() error {
+	return l.listener.Close()
+}
+
+func (l *streamListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
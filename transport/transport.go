@@ -0,0 +1,192 @@
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"pogchat/client"
+	"pogchat/codec"
+	"pogchat/frame"
+	"pogchat/rpc"
+	"pogchat/ws"
+	"time"
+)
+
+const (
+	TCP_SCHEME  = "tcp"
+	TLS_SCHEME  = "tls"
+	UNIX_SCHEME = "unix"
+	WS_SCHEME   = "ws"
+	WSS_SCHEME  = "wss"
+	// GRPC_SCHEME serves the Relay service of the rpc package
+	GRPC_SCHEME  = "grpc"
+	GRPCS_SCHEME = "grpcs"
+
+	DEFAULT_DIAL_TIMEOUT = 10 * time.Second
+)
+
+// transport is what listening on or dialing a url needs besides the url,
+// tlsConfig is the server certificate when listening and how the server is
+// trusted when dialing
+type transport struct {
+	framer      frame.Framer
+	tlsConfig   *tls.Config
+	dialTimeout time.Duration
+	// codec is negotiated by dialed connections, gRPC always uses protobuf
+	codec string
+}
+
+func WithFramer(framer frame.Framer) TransportOpts {
+	return func(t *transport) {
+		t.framer = framer
+	}
+}
+
+func WithTLSConfig(config *tls.Config) TransportOpts {
+	return func(t *transport) {
+		t.tlsConfig = config
+	}
+}
+
+func WithDialTimeout(d time.Duration) TransportOpts {
+	return func(t *transport) {
+		t.dialTimeout = d
+	}
+}
+
+// WithCodec picks the frame encoding asked of the server, codec.JSON keeps
+// to JSON even when the server offers more
+func WithCodec(preferred string) TransportOpts {
+	return func(t *transport) {
+		t.codec = preferred
+	}
+}
+
+func newTransport(opts ...TransportOpts) *transport {
+	t := &transport{
+		framer:      frame.NewFramer(),
+		dialTimeout: DEFAULT_DIAL_TIMEOUT,
+		codec:       codec.PROTO,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// Listen accepts connections on a url such as tcp://:42069,
+// unix:///run/pogchat.sock, tls://:42070, wss://:8443/ws or grpc://:42071,
+// tls, wss and grpcs need WithTLSConfig
+func Listen(rawURL string, opts ...TransportOpts) (Listener, error) {
+	t := newTransport(opts...)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	maxMessageSize := int64(t.framer.MaxFrameSize())
+	switch u.Scheme {
+	case TCP_SCHEME, UNIX_SCHEME:
+		listener, err := net.Listen(u.Scheme, address(u))
+		if err != nil {
+			return nil, err
+		}
+		return NewStreamListener(listener, t.framer), nil
+	case TLS_SCHEME:
+		if t.tlsConfig == nil {
+			return nil, MissingTLSConfigError
+		}
+		listener, err := tls.Listen("tcp", u.Host, t.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return NewStreamListener(listener, t.framer), nil
+	case WS_SCHEME, WSS_SCHEME:
+		config := t.tlsConfig
+		if u.Scheme == WS_SCHEME {
+			config = nil
+		} else if config == nil {
+			return nil, MissingTLSConfigError
+		}
+		listener, err := ws.Listen(u.Host, u.Path, config, maxMessageSize)
+		if err != nil {
+			return nil, err
+		}
+		return listener, nil
+	case GRPC_SCHEME, GRPCS_SCHEME:
+		config := t.tlsConfig
+		if u.Scheme == GRPC_SCHEME {
+			config = nil
+		} else if config == nil {
+			return nil, MissingTLSConfigError
+		}
+		listener, err := rpc.Listen(u.Host, config, int(t.framer.MaxFrameSize()))
+		if err != nil {
+			return nil, err
+		}
+		return listener, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", UnsupportedSchemeError, u.Scheme)
+	}
+}
+
+// Dial connects to a url taking the same schemes as Listen, tls, wss and
+// grpcs trust the system roots unless WithTLSConfig says otherwise
+func Dial(rawURL string, opts ...TransportOpts) (client.Conn, error) {
+	t := newTransport(opts...)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case GRPC_SCHEME:
+		return rpc.Dial(u.Host, nil, int(t.framer.MaxFrameSize()))
+	case GRPCS_SCHEME:
+		config := t.tlsConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		return rpc.Dial(u.Host, config, int(t.framer.MaxFrameSize()))
+	}
+
+	conn, err := t.dial(u)
+	if err != nil {
+		return nil, err
+	}
+	return codec.NewClientConn(conn, t.codec), nil
+}
+
+func (t *transport) dial(u *url.URL) (client.Conn, error) {
+	dialer := &net.Dialer{Timeout: t.dialTimeout}
+	switch u.Scheme {
+	case TCP_SCHEME, UNIX_SCHEME:
+		conn, err := dialer.Dial(u.Scheme, address(u))
+		if err != nil {
+			return nil, err
+		}
+		return client.NewStreamConn(conn, t.framer), nil
+	case TLS_SCHEME:
+		conn, err := tls.DialWithDialer(dialer, "tcp", u.Host, t.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return client.NewStreamConn(conn, t.framer), nil
+	case WS_SCHEME, WSS_SCHEME:
+		return ws.Dial(u.String(), t.tlsConfig, int64(t.framer.MaxFrameSize()))
+	default:
+		return nil, fmt.Errorf("%w: %q", UnsupportedSchemeError, u.Scheme)
+	}
+}
+
+// address is where a stream url points, unix urls keep relative paths in
+// the host as in unix://pogchat.sock
+func address(u *url.URL) string {
+	if u.Scheme == UNIX_SCHEME {
+		return u.Host + u.Path
+	}
+	return u.Host
+}
@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"pogchat/client"
+	"pogchat/frame"
+	"pogchat/tlsutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	// certificate returns a server config and a client config pinned to it
+	certificate := func(t *testing.T) (*tls.Config, *tls.Config) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		assert.Nil(t, tlsutil.WriteSelfSigned(certFile, keyFile, []string{"localhost", "127.0.0.1"}))
+
+		serverConfig, err := tlsutil.ServerConfig(certFile, keyFile)
+		assert.Nil(t, err)
+		pin, err := tlsutil.Fingerprint(certFile)
+		assert.Nil(t, err)
+		clientConfig, err := tlsutil.ClientConfig(tlsutil.WithPin(pin), tlsutil.WithServerName("localhost"))
+		assert.Nil(t, err)
+
+		return serverConfig, clientConfig
+	}
+
+	// echo writes back every frame of the first connection it accepts
+	echo := func(t *testing.T, l Listener) {
+		t.Cleanup(func() { l.Close() })
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				payload, err := conn.ReadFrame()
+				if err != nil {
+					return
+				}
+				conn.WriteFrame(payload)
+			}
+		}()
+	}
+
+	roundTrip := func(t *testing.T, conn client.Conn) {
+		defer conn.Close()
+		payload := []byte(`{"type":"PING_MSG","payload":"{\"seq\":1,\"timestamp\":2}"}`)
+		assert.Nil(t, conn.WriteFrame(payload))
+		got, err := conn.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, payload, got)
+	}
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "frames go through every scheme",
+			f: func(t *testing.T) {
+				serverConfig, clientConfig := certificate(t)
+				urls := []struct {
+					listen string
+					dial   func(l Listener) string
+				}{
+					{"tcp://127.0.0.1:0", func(l Listener) string { return "tcp://" + l.Addr().String() }},
+					{"unix://" + filepath.Join(t.TempDir(), "s.sock"), func(l Listener) string { return "unix://" + l.Addr().String() }},
+					{"tls://127.0.0.1:0", func(l Listener) string { return "tls://" + l.Addr().String() }},
+					{"ws://127.0.0.1:0/chat", func(l Listener) string { return "ws://" + l.Addr().String() + "/chat" }},
+					{"wss://127.0.0.1:0/ws", func(l Listener) string { return "wss://" + l.Addr().String() + "/ws" }},
+					{"grpc://127.0.0.1:0", func(l Listener) string { return "grpc://" + l.Addr().String() }},
+					{"grpcs://127.0.0.1:0", func(l Listener) string { return "grpcs://" + l.Addr().String() }},
+				}
+
+				for _, u := range urls {
+					l, err := Listen(u.listen, WithTLSConfig(serverConfig))
+					assert.Nil(t, err, u.listen)
+					echo(t, l)
+
+					conn, err := Dial(u.dial(l), WithTLSConfig(clientConfig))
+					assert.Nil(t, err, u.listen)
+					roundTrip(t, conn)
+				}
+			},
+		},
+		{
+			name: "frames over the max frame size are refused",
+			f: func(t *testing.T) {
+				framer := frame.NewFramer(frame.WithMaxFrameSize(8))
+				l, err := Listen("tcp://127.0.0.1:0", WithFramer(framer))
+				assert.Nil(t, err)
+				echo(t, l)
+
+				conn, err := Dial("tcp://"+l.Addr().String(), WithFramer(framer))
+				assert.Nil(t, err)
+				defer conn.Close()
+				assert.ErrorIs(t, conn.WriteFrame(make([]byte, 9)), frame.FrameTooLargeError)
+			},
+		},
+		{
+			name: "tls listeners need a certificate",
+			f: func(t *testing.T) {
+				for _, u := range []string{"tls://127.0.0.1:0", "wss://127.0.0.1:0/ws", "grpcs://127.0.0.1:0"} {
+					_, err := Listen(u)
+					assert.ErrorIs(t, err, MissingTLSConfigError)
+				}
+			},
+		},
+		{
+			name: "unknown schemes are refused",
+			f: func(t *testing.T) {
+				_, err := Listen("quic://127.0.0.1:0")
+				assert.ErrorIs(t, err, UnsupportedSchemeError)
+
+				_, err = Dial("carrier-pigeon://127.0.0.1:42069")
+				assert.ErrorIs(t, err, UnsupportedSchemeError)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, tt.f)
+	}
+}
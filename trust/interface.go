@@ -0,0 +1,43 @@
+package trust
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	KeyChangedError  = errors.New("peer key does not match the one seen before")
+	UnknownPeerError = errors.New("peer was never seen before")
+)
+
+type Status int
+
+const (
+	// NEW_PEER is a contact seen for the first time, its key has just been
+	// recorded
+	NEW_PEER Status = iota
+	// TRUSTED_PEER is a contact whose key matches the one recorded on first
+	// use but was never compared out of band
+	TRUSTED_PEER
+	// VERIFIED_PEER is a contact whose key was compared out of band
+	VERIFIED_PEER
+	// CHANGED_KEY is a known contact that now presents a different key,
+	// nothing should be sent to it until the new key is verified
+	CHANGED_KEY
+)
+
+type Peer struct {
+	Name        string    `json:"name"`
+	Fingerprint string    `json:"fingerprint"`
+	FirstSeen   time.Time `json:"first_seen"`
+	Verified    bool      `json:"verified"`
+}
+
+// KnownPeers remembers the key of every contact the first time it is used
+// and reports when that key changes
+type KnownPeers interface {
+	Check(name string, publicKey []byte) (Status, error)
+	Verify(name string, publicKey []byte) error
+	Peer(name string) (*Peer, error)
+	Peers() ([]*Peer, error)
+}
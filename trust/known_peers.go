@@ -0,0 +1,165 @@
+package trust
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"pogchat/key"
+	"sort"
+	"sync"
+	"time"
+)
+
+// knownPeers keeps every contact in memory and rewrites the whole file on
+// every change, contact lists are small enough for that
+type knownPeers struct {
+	mu       sync.Mutex
+	fileName string
+	peers    map[string]*Peer
+	now      func() time.Time
+}
+
+var _ KnownPeers = (*knownPeers)(nil)
+
+func (k *knownPeers) Check(name string, publicKey []byte) (Status, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	fp := key.FormatFingerprint(key.Fingerprint(publicKey))
+	peer, ok := k.peers[name]
+	if !ok {
+		k.peers[name] = &Peer{
+			Name:        name,
+			Fingerprint: fp,
+			FirstSeen:   k.now(),
+		}
+		return NEW_PEER, k.save()
+	}
+
+	if peer.Fingerprint != fp {
+		return CHANGED_KEY, nil
+	}
+
+	if peer.Verified {
+		return VERIFIED_PEER, nil
+	}
+
+	return TRUSTED_PEER, nil
+}
+
+// Verify marks the given key as compared out of band, it is also how a
+// changed key gets accepted
+func (k *knownPeers) Verify(name string, publicKey []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	fp := key.FormatFingerprint(key.Fingerprint(publicKey))
+	peer, ok := k.peers[name]
+	if !ok || peer.Fingerprint != fp {
+		peer = &Peer{
+			Name:        name,
+			Fingerprint: fp,
+			FirstSeen:   k.now(),
+		}
+		k.peers[name] = peer
+	}
+	peer.Verified = true
+
+	return k.save()
+}
+
+func (k *knownPeers) Peer(name string) (*Peer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	peer, ok := k.peers[name]
+	if !ok {
+		return nil, UnknownPeerError
+	}
+
+	p := *peer
+	return &p, nil
+}
+
+func (k *knownPeers) Peers() ([]*Peer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	peers := make([]*Peer, 0, len(k.peers))
+	for _, peer := range k.peers {
+		p := *peer
+		peers = append(peers, &p)
+	}
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+	return peers, nil
+}
+
+func (k *knownPeers) save() error {
+	if k.fileName == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(k.peers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := k.fileName + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, k.fileName)
+}
+
+// DefaultFile is where known peers are kept, KNOWN_PEERS overrides the
+// default ~/.pogchat/known_peers.json
+func DefaultFile() (string, error) {
+	if fileName := os.Getenv("KNOWN_PEERS"); fileName != "" {
+		return fileName, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".pogchat", "known_peers.json"), nil
+}
+
+// NewKnownPeers loads known peers from fileName, creating it on first use,
+// an empty fileName keeps them in memory only
+func NewKnownPeers(fileName string) (KnownPeers, error) {
+	k := &knownPeers{
+		fileName: fileName,
+		peers:    make(map[string]*Peer),
+		now:      time.Now,
+	}
+
+	if fileName == "" {
+		return k, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(fileName), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &k.peers)
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
@@ -0,0 +1,101 @@
+package trust
+
+import (
+	"pogchat/key"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKnownPeers(t *testing.T) {
+	bob, err := key.NewEd25519KeyPair()
+	assert.Nil(t, err, "could not generate pair keys")
+	mallory, err := key.NewEd25519KeyPair()
+	assert.Nil(t, err, "could not generate pair keys")
+
+	test := []struct {
+		name string
+		f    func(*testing.T)
+	}{
+		{
+			name: "first use records the key",
+			f: func(t *testing.T) {
+				peers, _ := NewKnownPeers("")
+				status, err := peers.Check("bob", bob.PublicKey())
+				assert.Nil(t, err)
+				assert.Equal(t, NEW_PEER, status)
+
+				status, err = peers.Check("bob", bob.PublicKey())
+				assert.Nil(t, err)
+				assert.Equal(t, TRUSTED_PEER, status, "same key must be trusted")
+			},
+		},
+		{
+			name: "changed key is reported",
+			f: func(t *testing.T) {
+				peers, _ := NewKnownPeers("")
+				peers.Check("bob", bob.PublicKey())
+
+				status, err := peers.Check("bob", mallory.PublicKey())
+				assert.Nil(t, err)
+				assert.Equal(t, CHANGED_KEY, status)
+
+				peer, err := peers.Peer("bob")
+				assert.Nil(t, err)
+				assert.Equal(t, key.FormatFingerprint(key.Fingerprint(bob.PublicKey())), peer.Fingerprint, "changed key must not replace the recorded one")
+			},
+		},
+		{
+			name: "verify marks the peer and accepts a new key",
+			f: func(t *testing.T) {
+				peers, _ := NewKnownPeers("")
+				peers.Check("bob", bob.PublicKey())
+				assert.Nil(t, peers.Verify("bob", bob.PublicKey()))
+
+				status, _ := peers.Check("bob", bob.PublicKey())
+				assert.Equal(t, VERIFIED_PEER, status)
+
+				assert.Nil(t, peers.Verify("bob", mallory.PublicKey()))
+				status, _ = peers.Check("bob", mallory.PublicKey())
+				assert.Equal(t, VERIFIED_PEER, status, "verified new key must be accepted")
+				status, _ = peers.Check("bob", bob.PublicKey())
+				assert.Equal(t, CHANGED_KEY, status, "old key must now be a change")
+			},
+		},
+		{
+			name: "peers survive a reload",
+			f: func(t *testing.T) {
+				fileName := t.TempDir() + "/peers/known_peers.json"
+				peers, err := NewKnownPeers(fileName)
+				assert.Nil(t, err)
+				peers.Check("bob", bob.PublicKey())
+				peers.Verify("mallory", mallory.PublicKey())
+
+				reloaded, err := NewKnownPeers(fileName)
+				assert.Nil(t, err)
+				status, _ := reloaded.Check("bob", mallory.PublicKey())
+				assert.Equal(t, CHANGED_KEY, status)
+
+				list, err := reloaded.Peers()
+				assert.Nil(t, err)
+				assert.Len(t, list, 2)
+				assert.Equal(t, "bob", list[0].Name)
+				assert.True(t, list[1].Verified)
+			},
+		},
+		{
+			name: "unknown peer",
+			f: func(t *testing.T) {
+				peers, _ := NewKnownPeers("")
+				_, err := peers.Peer("bob")
+				assert.Equal(t, UnknownPeerError, err)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t)
+		})
+	}
+}
@@ -28,12 +28,12 @@ func (u *user) BuildPeerMessage(msg string) (user_message.UserMessage, error) {
 		user_message.WithFromPublicKey(u.pair.PublicKey()),
 		user_message.WithToPublicKey(u.peerPublicKey))
 
-	enctyptedMsg, err := um.GetEncryptedMessage([]byte(msg))
+	_, err := um.GetEncryptedMessage([]byte(msg))
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = um.GetSignature(u.pair.PrivateKey(), enctyptedMsg)
+	_, err = um.Sign(u.pair.PrivateKey())
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +40,7 @@ func TestUserBuilder(t *testing.T) {
 			_, err = um.MarshalJSON()
 			assert.Nil(t, err, "could not marshal user message to JSON")
 
-			ok, err := s.Verify(pairSender.PublicKey(), um.Message(), um.Signature())
+			ok, err := s.Verify(pairSender.PublicKey(), um.SignedData(), um.Signature())
 			assert.Nil(t, err, "verification must be possible")
 			assert.Equal(t, ok, tt.verifyResult, "verification must be true")
 		})
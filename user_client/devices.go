@@ -0,0 +1,200 @@
+package userclient
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	chatmessage "pogchat/chat_message"
+	"pogchat/key"
+	"pogchat/user_message"
+	"strings"
+	"time"
+)
+
+// loadDeviceID returns the id of this machine, it is created on first use
+// in ~/.pogchat/device_id unless DEVICE_ID is set
+func loadDeviceID() (string, error) {
+	if id := os.Getenv("DEVICE_ID"); id != "" {
+		return id, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	fileName := filepath.Join(home, ".pogchat", "device_id")
+
+	b, err := ioutil.ReadFile(fileName)
+	if err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	id := make([]byte, 8)
+	_, err = rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fileName), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	err = ioutil.WriteFile(fileName, []byte(hex.EncodeToString(id)), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// loadDeviceKey returns the key this machine logs in with as device id, it
+// is created on first use under ~/.pogchat/devices, the server binds the id
+// to it and a revocation locks it out
+func loadDeviceKey(id string) (key.KeyPair, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(id))
+	prefix := filepath.Join(home, ".pogchat", "devices", hex.EncodeToString(sum[:8]))
+
+	_, err = os.Stat(prefix + "Private.key")
+	if err == nil {
+		return key.LoadKeyPair(
+			key.WithPublicKey(prefix+"Public.key"),
+			key.WithPrivateKey(prefix+"Private.key"))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	pair, err := key.NewEd25519KeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(prefix), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pair.StorePrivateKey(prefix + "Private.key")
+	if err != nil {
+		return nil, err
+	}
+
+	err = pair.StorePublicKey(prefix + "Public.key")
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+func (c *userClient) ListDevices() error {
+	return c.writeMessage(chatmessage.DEVICE_LIST_MSG, "{}")
+}
+
+// RevokeDevice logs a device of this key out and locks its device key out
+// for good, a device that still has the identity key can vouch for a new
+// device key so a lost device still calls for a new identity key, it can
+// not be used on the device sending it
+func (c *userClient) RevokeDevice(id string) error {
+	msg, err := chatmessage.NewChatMessage(chatmessage.DEVICE_REVOKE_MSG, &chatmessage.DeviceRevoke{ID: id})
+	if err != nil {
+		return err
+	}
+
+	return c.writeMessage(msg.Type, msg.Payload)
+}
+
+func (c *userClient) handleDeviceList(msg *chatmessage.ChatMessage) error {
+	list, err := chatmessage.ParseDeviceList(msg)
+	if err != nil {
+		return err
+	}
+
+	for _, dev := range list.Devices {
+		state := "offline, last seen " + time.Unix(dev.LastSeen, 0).Format("Jan 2 15:04")
+		switch {
+		case dev.Revoked:
+			state = "revoked"
+		case dev.Current:
+			state = "this device"
+		case dev.Online:
+			state = "online"
+		}
+		c.appendHistory("devices", fmt.Sprintf("%s: %s", dev.ID, state))
+	}
+
+	return nil
+}
+
+// syncSent sends a copy of an outgoing message to this key so its other
+// devices can show it, failing to sync never fails the send itself
+func (c *userClient) syncSent(to []byte, room string, text string) {
+	payload, err := json.Marshal(&user_message.SyncPayload{
+		To:      to,
+		Room:    room,
+		Message: []byte(text),
+	})
+	if err != nil {
+		log.Printf("[userClient.syncSent] json.Marshal() returned error: %+v\n", err)
+		return
+	}
+
+	err = c.send(func() (*chatmessage.ChatMessage, error) {
+		um := user_message.NewUserMessage(
+			user_message.WithType(user_message.SYNC_MESSAGE),
+			user_message.WithFromPublicKey(c.pair.PublicKey()),
+			user_message.WithToPublicKey(c.pair.PublicKey()),
+		)
+
+		_, err := um.GetEncryptedMessage(payload)
+		if err != nil {
+			log.Printf("[userClient.syncSent] um.GetEncryptedMessage() returned error: %+v\n", err)
+			return nil, err
+		}
+
+		signed, err := c.signMessage(um)
+		if err != nil {
+			return nil, err
+		}
+
+		return &chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, Payload: signed}, nil
+	})
+	if err != nil {
+		log.Printf("[userClient.syncSent] c.send() returned error: %+v\n", err)
+	}
+}
+
+// showSynced renders a message this key sent from another device
+func (c *userClient) showSynced(message []byte) {
+	sync := &user_message.SyncPayload{}
+	err := json.Unmarshal(message, sync)
+	if err != nil {
+		c.appendHistory(c.GetUsername(), "[ERROR] could not read message sent from another device")
+		return
+	}
+
+	to := key.ShortFingerprint(sync.To)
+	if sync.Room != "" {
+		to = sync.Room
+	} else if c.receiver != nil && bytes.Equal(sync.To, c.receiver.PublicKey()) {
+		to = c.receiverName
+	}
+
+	c.appendHistory(fmt.Sprintf("%s -> %s", c.GetUsername(), to), string(sync.Message))
+}
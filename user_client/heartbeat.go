@@ -0,0 +1,147 @@
+package userclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"time"
+)
+
+const (
+	DEFAULT_HEARTBEAT_INTERVAL = 15 * time.Second
+	DEFAULT_HEARTBEAT_MISSES   = 3
+	// DEFAULT_READ_TIMEOUT gives the heartbeat one more interval before a
+	// silent connection is closed by its read deadline
+	DEFAULT_READ_TIMEOUT = DEFAULT_HEARTBEAT_INTERVAL * (DEFAULT_HEARTBEAT_MISSES + 1)
+)
+
+// ServerState is what the client knows about its connection to the server
+type ServerState string
+
+const (
+	SERVER_CONNECTED      ServerState = "connected"
+	SERVER_NOT_RESPONDING ServerState = "not responding"
+	SERVER_RECONNECTING   ServerState = "reconnecting"
+	SERVER_DISCONNECTED   ServerState = "disconnected"
+)
+
+// reachable reports whether frames can be written right away, anything
+// sent to a server that is not responding could be lost with no error so
+// it waits in the outbox instead
+func (s ServerState) reachable() bool {
+	return s == SERVER_CONNECTED
+}
+
+// WithHeartbeat pings the server after interval without hearing from it,
+// it is reported as not responding after misses intervals
+func WithHeartbeat(interval time.Duration, misses int) UserClientOpts {
+	return func(uc *userClient) {
+		uc.heartbeatInterval = interval
+		uc.heartbeatMisses = misses
+		if misses < 1 {
+			uc.heartbeatMisses = 1
+		}
+	}
+}
+
+// heartbeat watches a connection until it closes, a half open connection
+// never errors so silence is the only way to notice a dead server, once it
+// is noticed the connection is closed and reconnecting takes over
+func (c *userClient) heartbeat(cl client.Client) {
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+
+	deadline := c.heartbeatInterval * time.Duration(c.heartbeatMisses)
+	var seq uint64
+	for {
+		select {
+		case <-cl.Done():
+			return
+		case now := <-ticker.C:
+			idle := now.Sub(cl.LastRead())
+			if idle < c.heartbeatInterval {
+				c.setResponding(true)
+				continue
+			}
+			if idle >= deadline {
+				c.setResponding(false)
+				cl.Close()
+				return
+			}
+
+			seq++
+			err := c.ping(cl, seq, now)
+			if err != nil {
+				log.Printf("[userClient.heartbeat] c.ping() returned error: %+v\n", err)
+			}
+		}
+	}
+}
+
+func (c *userClient) ping(cl client.Client, seq uint64, now time.Time) error {
+	ping, err := chatmessage.NewPing(seq, now.Unix())
+	if err != nil {
+		return err
+	}
+
+	msg, err := json.Marshal(ping)
+	if err != nil {
+		return err
+	}
+
+	return cl.WriteFrame(msg)
+}
+
+func (c *userClient) ServerState() ServerState {
+	c.serverMu.Lock()
+	defer c.serverMu.Unlock()
+	return c.serverState
+}
+
+// setResponding is how the heartbeat reports, it only moves between
+// connected and not responding and leaves a connection being replaced alone
+func (c *userClient) setResponding(responding bool) {
+	state := SERVER_NOT_RESPONDING
+	if responding {
+		state = SERVER_CONNECTED
+	}
+	c.changeServerState(state, func(current ServerState) bool {
+		return current == SERVER_CONNECTED || current == SERVER_NOT_RESPONDING
+	})
+}
+
+func (c *userClient) setServerState(state ServerState) {
+	c.changeServerState(state, func(ServerState) bool {
+		return true
+	})
+}
+
+// changeServerState shows every change of the connection state in the
+// header and the history, allowed decides from the current state whether
+// the change applies
+func (c *userClient) changeServerState(state ServerState, allowed func(current ServerState) bool) {
+	c.serverMu.Lock()
+	changed := c.serverState != state && allowed(c.serverState)
+	if changed {
+		c.serverState = state
+	}
+	c.serverMu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	c.appendHistory("server", fmt.Sprintf("[STATUS] server %s", state))
+	if c.serverLabel == nil {
+		return
+	}
+	c.ui.Update(func() {
+		c.serverLabel.SetText(serverLabel(state))
+	})
+}
+
+func serverLabel(state ServerState) string {
+	return fmt.Sprintf("server: %s", state)
+}
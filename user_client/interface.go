@@ -1,12 +1,24 @@
 package userclient
 
-import "pogchat/key"
+import (
+	chatmessage "pogchat/chat_message"
+	"pogchat/key"
+)
 
 type UserClient interface {
 	GetUsername() string
 	GetPeername() string
+	GetSafetyNumber() string
 	SetReceiver(r key.KeyPair)
 	SendMessage(text string) error
+	CreateRoom(room string) error
+	Invite(room string, member []byte) error
+	Remove(room string, member []byte) error
+	Leave(room string) error
+	SendRoomMessage(room string, text string) error
+	ListDevices() error
+	RevokeDevice(id string) error
+	SetPresence(status chatmessage.PresenceStatus, visibility chatmessage.Visibility) error
 	Login() error
 	BuildUI() error
 	Run() error
@@ -0,0 +1,31 @@
+package userclient
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// envPassphrase takes the passphrase from SENDER_PASSPHRASE so the client can
+// run unattended, otherwise it asks on the terminal
+func envPassphrase(fileName string) ([]byte, error) {
+	if p, ok := os.LookupEnv("SENDER_PASSPHRASE"); ok {
+		return []byte(p), nil
+	}
+
+	return ReadPassphrase(fmt.Sprintf("passphrase for %s: ", fileName))
+}
+
+// ReadPassphrase asks for a passphrase on the terminal without echoing it
+func ReadPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, NoTerminalError
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	return term.ReadPassword(fd)
+}
@@ -0,0 +1,183 @@
+package userclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	chatmessage "pogchat/chat_message"
+	"pogchat/key"
+	"sort"
+	"time"
+
+	"github.com/marcusolsson/tui-go"
+)
+
+// contacts is every key this client talks to, the receiver and the members
+// of its rooms, it is both what presence is watched for and who may see it
+// when visibility is restricted
+func (c *userClient) contacts() [][]byte {
+	var keys [][]byte
+	seen := map[string]bool{}
+	add := func(k []byte) {
+		id := base64.RawStdEncoding.EncodeToString(k)
+		if seen[id] || bytes.Equal(k, c.pair.PublicKey()) {
+			return
+		}
+		seen[id] = true
+		keys = append(keys, k)
+	}
+
+	if c.receiver != nil {
+		add(c.receiver.PublicKey())
+	}
+
+	c.roomsMu.Lock()
+	for _, info := range c.rooms {
+		for _, member := range info.Members {
+			add(member)
+		}
+	}
+	c.roomsMu.Unlock()
+
+	return keys
+}
+
+// subscribePresence is called whenever the contacts change, a restricted
+// visibility is refreshed too so new contacts can see this client
+func (c *userClient) subscribePresence() error {
+	msg, err := chatmessage.NewChatMessage(chatmessage.PRESENCE_SUB_MSG, &chatmessage.PresenceSubscribe{
+		Keys: c.contacts(),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.writeMessage(msg.Type, msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	c.presenceMu.Lock()
+	status, visibility := c.status, c.visibility
+	c.presenceMu.Unlock()
+
+	if visibility != chatmessage.VISIBLE_TO_ALLOWED {
+		return nil
+	}
+	return c.SetPresence(status, visibility)
+}
+
+// SetPresence changes the status others see, with VISIBLE_TO_ALLOWED only
+// the current contacts can see it
+func (c *userClient) SetPresence(status chatmessage.PresenceStatus, visibility chatmessage.Visibility) error {
+	set := &chatmessage.PresenceSet{
+		Status:     status,
+		Visibility: visibility,
+	}
+	if visibility == chatmessage.VISIBLE_TO_ALLOWED {
+		set.Allowed = c.contacts()
+	}
+
+	msg, err := chatmessage.NewChatMessage(chatmessage.PRESENCE_SET_MSG, set)
+	if err != nil {
+		return err
+	}
+
+	err = c.writeMessage(msg.Type, msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	c.presenceMu.Lock()
+	c.status = status
+	c.visibility = visibility
+	c.presenceMu.Unlock()
+
+	return nil
+}
+
+func (c *userClient) handlePresence(msg *chatmessage.ChatMessage) error {
+	presence, err := chatmessage.ParsePresence(msg)
+	if err != nil {
+		return err
+	}
+
+	c.presenceMu.Lock()
+	c.presence[base64.RawStdEncoding.EncodeToString(presence.Key)] = presence
+	c.presenceMu.Unlock()
+
+	c.refreshPeers()
+	return nil
+}
+
+func (c *userClient) contactName(pk []byte) string {
+	if c.receiver != nil && bytes.Equal(pk, c.receiver.PublicKey()) {
+		return c.receiverName
+	}
+	return key.ShortFingerprint(pk)
+}
+
+func describePresence(p *chatmessage.Presence) string {
+	if p.Status == chatmessage.OFFLINE && p.LastSeen != 0 {
+		return fmt.Sprintf("offline, last seen %s", time.Unix(p.LastSeen, 0).Format("Jan 2 15:04"))
+	}
+	switch p.Status {
+	case chatmessage.ONLINE:
+		return "online"
+	case chatmessage.AWAY:
+		return "away"
+	case chatmessage.OFFLINE:
+		return "offline"
+	default:
+		return "unknown"
+	}
+}
+
+// refreshPeers redraws the peer list with the latest presence of every
+// contact
+func (c *userClient) refreshPeers() {
+	if c.peers == nil {
+		return
+	}
+
+	type line struct{ name, status string }
+	var lines []line
+	c.presenceMu.Lock()
+	for _, p := range c.presence {
+		lines = append(lines, line{c.contactName(p.Key), describePresence(p)})
+	}
+	c.presenceMu.Unlock()
+	sort.Slice(lines, func(i, j int) bool { return lines[i].name < lines[j].name })
+
+	c.ui.Update(func() {
+		for c.peers.Length() > 0 {
+			c.peers.Remove(0)
+		}
+		for _, l := range lines {
+			c.peers.Append(tui.NewLabel(fmt.Sprintf("%s: %s", l.name, l.status)))
+		}
+		c.peers.Append(tui.NewSpacer())
+	})
+}
+
+func (c *userClient) setStatus(status chatmessage.PresenceStatus) error {
+	c.presenceMu.Lock()
+	visibility := c.visibility
+	c.presenceMu.Unlock()
+
+	return c.SetPresence(status, visibility)
+}
+
+func (c *userClient) setVisibility(visibility chatmessage.Visibility) error {
+	switch visibility {
+	case chatmessage.VISIBLE_TO_EVERYONE, chatmessage.VISIBLE_TO_ALLOWED, chatmessage.VISIBLE_TO_NOBODY:
+	default:
+		return UnknownCommandError
+	}
+
+	c.presenceMu.Lock()
+	status := c.status
+	c.presenceMu.Unlock()
+
+	return c.SetPresence(status, visibility)
+}
@@ -0,0 +1,270 @@
+package userclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	mathrand "math/rand"
+	chatmessage "pogchat/chat_message"
+	"pogchat/client"
+	"time"
+)
+
+const (
+	DEFAULT_MIN_BACKOFF = 500 * time.Millisecond
+	DEFAULT_MAX_BACKOFF = 30 * time.Second
+	DEFAULT_OUTBOX_SIZE = 256
+	// OUTBOX_RESEND_WINDOW is how long a frame that failed to write may be
+	// sent again as is, the server drops it if the first try got through,
+	// past that it is built again before its timestamp goes stale
+	OUTBOX_RESEND_WINDOW = time.Minute
+)
+
+var (
+	NotConnectedError = errors.New("not connected to the server")
+	OutboxFullError   = errors.New("too many messages waiting for the server")
+)
+
+// frameBuilder makes a frame right before it is written, signed messages
+// are built by one so those waiting in the outbox get their timestamp and
+// signature when they finally go out
+type frameBuilder func() (*chatmessage.ChatMessage, error)
+
+// pending is a message waiting in the outbox, frame is set when it was
+// already tried on a connection that failed
+type pending struct {
+	build frameBuilder
+	frame []byte
+	built time.Time
+}
+
+func (p *pending) encode() ([]byte, error) {
+	if p.frame != nil && time.Since(p.built) < OUTBOX_RESEND_WINDOW {
+		return p.frame, nil
+	}
+
+	msg, err := p.build()
+	if err != nil {
+		return nil, err
+	}
+
+	p.frame, err = json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	p.built = time.Now()
+
+	return p.frame, nil
+}
+
+// Dialer opens a new connection to the server, it is used to come back
+// after the current one is lost
+type Dialer func() (client.Client, error)
+
+// WithDialer turns on reconnects, without it a lost connection is final
+func WithDialer(dial Dialer) UserClientOpts {
+	return func(uc *userClient) {
+		uc.dial = dial
+	}
+}
+
+// WithBackoff bounds the wait between reconnect attempts, it doubles from
+// min up to max
+func WithBackoff(min time.Duration, max time.Duration) UserClientOpts {
+	return func(uc *userClient) {
+		uc.minBackoff = min
+		uc.maxBackoff = max
+	}
+}
+
+// WithOutboxSize bounds how many messages are kept while the server is
+// unreachable
+func WithOutboxSize(size int) UserClientOpts {
+	return func(uc *userClient) {
+		uc.outboxSize = size
+	}
+}
+
+// backoff is how long to wait before the given attempt, half of it is
+// random so clients dropped together do not all come back at once
+func backoff(attempt int, min time.Duration, max time.Duration) time.Duration {
+	d := max
+	if attempt < 32 && min<<attempt > 0 && min<<attempt < max {
+		d = min << attempt
+	}
+
+	half := d / 2
+	return half + time.Duration(mathrand.Int63n(int64(half)+1))
+}
+
+func (c *userClient) conn() client.Client {
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+	return c.client
+}
+
+// attach makes cl the connection everything goes through and starts
+// reading from it
+func (c *userClient) attach(cl client.Client) {
+	cl.SetPublicKey(c.pair.PublicKey())
+	cl.SetReplayCache(c.seen)
+	if c.sessions != nil {
+		cl.SetSessions(c.sessions)
+	}
+
+	cl.Handle(chatmessage.CHALLENGE_MSG, c.handleChallenge)
+	cl.Handle(chatmessage.STATUS_MSG, c.handleStatus)
+	cl.Handle(chatmessage.ROOM_INFO_MSG, c.handleRoomInfo)
+	cl.Handle(chatmessage.PRESENCE_MSG, c.handlePresence)
+	cl.Handle(chatmessage.DEVICE_LIST_MSG, c.handleDeviceList)
+
+	c.clientMu.Lock()
+	c.client = cl
+	c.clientMu.Unlock()
+
+	go cl.ReceiveAndDecrypt(c.pair.PrivateKey(), c.recChan)
+	if c.heartbeatInterval > 0 {
+		go c.heartbeat(cl)
+	}
+}
+
+// supervise waits for the connection to drop and replaces it for as long
+// as the client runs
+func (c *userClient) supervise() {
+	for {
+		<-c.conn().Done()
+
+		if c.dial == nil {
+			c.setServerState(SERVER_DISCONNECTED)
+			return
+		}
+
+		c.setServerState(SERVER_RECONNECTING)
+		c.reconnect()
+	}
+}
+
+func (c *userClient) reconnect() {
+	for attempt := 0; ; attempt++ {
+		time.Sleep(backoff(attempt, c.minBackoff, c.maxBackoff))
+
+		cl, err := c.dial()
+		if err != nil {
+			log.Printf("[userClient.reconnect] attempt %d: c.dial() returned error: %+v\n", attempt+1, err)
+			continue
+		}
+
+		// whatever the old connection left behind must not be taken for
+		// an answer on the new one
+		select {
+		case <-c.challenges:
+		default:
+		}
+		select {
+		case <-c.loginResult:
+		default:
+		}
+
+		c.attach(cl)
+		err = c.Login()
+		if err != nil {
+			log.Printf("[userClient.reconnect] attempt %d: c.Login() returned error: %+v\n", attempt+1, err)
+			cl.Close()
+			continue
+		}
+
+		c.resume()
+		return
+	}
+}
+
+// resume sends what was typed while offline, in order, and restores the
+// presence the server forgot when the last connection dropped
+func (c *userClient) resume() {
+	c.outboxMu.Lock()
+	for len(c.outbox) > 0 {
+		frame, err := c.outbox[0].encode()
+		if err != nil {
+			log.Printf("[userClient.resume] could not build queued message: %+v\n", err)
+			c.appendHistory("outbox", fmt.Sprintf("[ERROR] queued message could not be sent: %v", err))
+			c.outbox = c.outbox[1:]
+			continue
+		}
+
+		err = c.conn().WriteFrame(frame)
+		if err != nil {
+			log.Printf("[userClient.resume] c.conn().WriteFrame() returned error: %+v\n", err)
+			c.outboxMu.Unlock()
+			// supervise notices and starts over
+			c.conn().Close()
+			return
+		}
+		c.outbox = c.outbox[1:]
+	}
+	c.setServerState(SERVER_CONNECTED)
+	c.outboxMu.Unlock()
+
+	err := c.subscribePresence()
+	if err != nil {
+		log.Printf("[userClient.resume] c.subscribePresence() returned error: %+v\n", err)
+		return
+	}
+
+	c.presenceMu.Lock()
+	status, visibility := c.status, c.visibility
+	c.presenceMu.Unlock()
+
+	if status == chatmessage.ONLINE && visibility == chatmessage.VISIBLE_TO_EVERYONE {
+		return
+	}
+	err = c.SetPresence(status, visibility)
+	if err != nil {
+		log.Printf("[userClient.resume] c.SetPresence() returned error: %+v\n", err)
+	}
+}
+
+// send writes a frame or keeps it for later when the server is out of
+// reach, frames keep their order either way
+func (c *userClient) send(build frameBuilder) error {
+	c.outboxMu.Lock()
+	defer c.outboxMu.Unlock()
+
+	p := &pending{build: build}
+	if !c.ServerState().reachable() {
+		return c.queue(p)
+	}
+
+	frame, err := p.encode()
+	if err != nil {
+		return err
+	}
+
+	err = c.conn().WriteFrame(frame)
+	if err == nil {
+		return nil
+	}
+
+	log.Printf("[userClient.send] c.conn().WriteFrame() returned error: %+v\n", err)
+	if c.dial == nil {
+		return err
+	}
+
+	// a failed write leaves the connection in an unknown state, replacing
+	// it is the only way forward and the server drops a duplicate by id
+	c.conn().Close()
+	return c.queue(p)
+}
+
+func (c *userClient) queue(p *pending) error {
+	if c.dial == nil {
+		return NotConnectedError
+	}
+	if len(c.outbox) >= c.outboxSize {
+		return OutboxFullError
+	}
+
+	c.outbox = append(c.outbox, p)
+	c.appendHistory("outbox", fmt.Sprintf("[QUEUED] server is unreachable, %d message(s) will be sent once it is back", len(c.outbox)))
+	return nil
+}
@@ -0,0 +1,367 @@
+package userclient
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	chatmessage "pogchat/chat_message"
+	"pogchat/key"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	UnknownRoomError    = errors.New("not a member of this room")
+	UnknownCommandError = errors.New("unknown command")
+	InvalidRoomOpError  = errors.New("room operation is not signed by its actor")
+	UnverifiedRoomError = errors.New("room members are not backed by signed operations")
+)
+
+func (c *userClient) CreateRoom(room string) error {
+	return c.sendRoomOp(chatmessage.CREATE_ROOM, room, nil)
+}
+
+func (c *userClient) Invite(room string, member []byte) error {
+	return c.sendRoomOp(chatmessage.INVITE_MEMBER, room, member)
+}
+
+func (c *userClient) Remove(room string, member []byte) error {
+	return c.sendRoomOp(chatmessage.REMOVE_MEMBER, room, member)
+}
+
+func (c *userClient) Leave(room string) error {
+	return c.sendRoomOp(chatmessage.LEAVE_ROOM, room, nil)
+}
+
+func (c *userClient) sendRoomOp(opType chatmessage.RoomOpType, room string, member []byte) error {
+	return c.send(func() (*chatmessage.ChatMessage, error) {
+		id := make([]byte, 16)
+		_, err := rand.Read(id)
+		if err != nil {
+			return nil, err
+		}
+
+		op := &chatmessage.RoomOp{
+			Op:        opType,
+			Room:      room,
+			Member:    member,
+			Actor:     c.pair.PublicKey(),
+			ID:        hex.EncodeToString(id),
+			Timestamp: time.Now().Unix(),
+		}
+
+		op.Signature, err = c.signer.Sign(c.pair.PrivateKey(), op.SigningBytes())
+		if err != nil {
+			log.Printf("[userClient.sendRoomOp] signer.Sign() returned error: %+v\n", err)
+			return nil, err
+		}
+
+		return chatmessage.NewChatMessage(chatmessage.ROOM_OP_MSG, op)
+	})
+}
+
+// SendRoomMessage encrypts one copy of text for every other member of the
+// room and hands them to the server in a single envelope, the copies are
+// made when the envelope goes out so they follow the members at that time
+func (c *userClient) SendRoomMessage(room string, text string) error {
+	others, err := c.roomRecipients(room)
+	if err != nil {
+		return err
+	}
+	if len(others) == 0 {
+		return nil
+	}
+
+	err = c.send(func() (*chatmessage.ChatMessage, error) {
+		others, err := c.roomRecipients(room)
+		if err != nil {
+			return nil, err
+		}
+
+		envelope := &chatmessage.RoomEnvelope{Room: room}
+		for _, member := range others {
+			um, err := c.buildMessage(member, room, text)
+			if err != nil {
+				return nil, err
+			}
+
+			payload, err := c.signMessage(um)
+			if err != nil {
+				return nil, err
+			}
+			envelope.Messages = append(envelope.Messages, payload)
+		}
+
+		return chatmessage.NewChatMessage(chatmessage.ROOM_MSG, envelope)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.syncSent(nil, room, text)
+	return nil
+}
+
+// roomRecipients is every member of room but this key
+func (c *userClient) roomRecipients(room string) ([][]byte, error) {
+	c.roomsMu.Lock()
+	defer c.roomsMu.Unlock()
+
+	info, ok := c.rooms[room]
+	if !ok {
+		return nil, UnknownRoomError
+	}
+
+	others := make([][]byte, 0, len(info.Members))
+	for _, member := range info.Members {
+		if !bytes.Equal(member, c.pair.PublicKey()) {
+			others = append(others, member)
+		}
+	}
+
+	return others, nil
+}
+
+// handleRoomInfo keeps the member list of every room up to date, the list
+// sent by the server is never used as is, it is rebuilt from the signed
+// changes that come with it
+func (c *userClient) handleRoomInfo(msg *chatmessage.ChatMessage) error {
+	info, err := chatmessage.ParseRoomInfo(msg)
+	if err != nil {
+		return err
+	}
+
+	info.Owner, info.Members, err = c.replayRoom(info.Room, info.Ops)
+	if err != nil {
+		c.appendHistory("room "+info.Room, "[ERROR] ignored membership change that is not backed by signed operations")
+		return err
+	}
+
+	member := false
+	for _, m := range info.Members {
+		if bytes.Equal(m, c.pair.PublicKey()) {
+			member = true
+		}
+	}
+
+	c.roomsMu.Lock()
+	// the server could hand out an older history to undo a removal, a
+	// room we know about or were in only moves forward
+	known := c.left[info.Room]
+	if current, ok := c.rooms[info.Room]; ok {
+		known = current.Ops
+	}
+	if known != nil && !follows(info.Ops, known) {
+		c.roomsMu.Unlock()
+		c.appendHistory("room "+info.Room, "[ERROR] ignored membership change that rewrites the room history")
+		return UnverifiedRoomError
+	}
+
+	if member {
+		c.rooms[info.Room] = info
+		delete(c.left, info.Room)
+	} else {
+		delete(c.rooms, info.Room)
+		c.left[info.Room] = info.Ops
+		if c.activeRoom == info.Room {
+			c.activeRoom = ""
+		}
+	}
+	c.roomsMu.Unlock()
+
+	if info.Op != nil {
+		c.appendHistory("room "+info.Room, describeRoomOp(info.Ops[len(info.Ops)-1]))
+	}
+
+	return c.subscribePresence()
+}
+
+// replayRoom applies the history of a room from its CREATE_ROOM onwards
+// with the same rules the server enforces, every operation must be signed
+// by its actor and allowed at the point it appears
+func (c *userClient) replayRoom(room string, ops []*chatmessage.RoomOp) ([]byte, [][]byte, error) {
+	if len(ops) == 0 || ops[0].Op != chatmessage.CREATE_ROOM {
+		return nil, nil, UnverifiedRoomError
+	}
+
+	owner := ops[0].Actor
+	members := make(map[string][]byte)
+	ids := make(map[string]struct{}, len(ops))
+	closed := false
+
+	for i, op := range ops {
+		_, err := c.signer.Verify(op.Actor, op.SigningBytes(), op.Signature)
+		if err != nil || op.Room != room {
+			return nil, nil, InvalidRoomOpError
+		}
+
+		if _, ok := ids[op.ID]; ok || closed {
+			return nil, nil, UnverifiedRoomError
+		}
+		ids[op.ID] = struct{}{}
+
+		actor := hex.EncodeToString(op.Actor)
+		member := hex.EncodeToString(op.Member)
+		_, actorIn := members[actor]
+		_, memberIn := members[member]
+		isOwner := bytes.Equal(op.Actor, owner)
+
+		switch {
+		case op.Op == chatmessage.CREATE_ROOM && i == 0:
+			members[actor] = op.Actor
+		case op.Op == chatmessage.INVITE_MEMBER && isOwner && len(op.Member) > 0 && !memberIn:
+			members[member] = op.Member
+		case op.Op == chatmessage.REMOVE_MEMBER && isOwner && !bytes.Equal(op.Member, owner) && memberIn:
+			delete(members, member)
+		case op.Op == chatmessage.LEAVE_ROOM && actorIn:
+			delete(members, actor)
+			// the owner leaving closes the room for everyone
+			if isOwner {
+				members = map[string][]byte{}
+				closed = true
+			}
+		default:
+			return nil, nil, UnverifiedRoomError
+		}
+	}
+
+	keys := make([]string, 0, len(members))
+	for k := range members {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	list := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, members[k])
+	}
+
+	return owner, list, nil
+}
+
+// follows tells whether ops can come after the history known, it either
+// extends it or, once known ended with the owner closing the room, starts
+// a room of the same name created later
+func follows(ops []*chatmessage.RoomOp, known []*chatmessage.RoomOp) bool {
+	if extends(ops, known) {
+		return true
+	}
+
+	last := known[len(known)-1]
+	closed := last.Op == chatmessage.LEAVE_ROOM && bytes.Equal(last.Actor, known[0].Actor)
+	return closed && ops[0].Timestamp >= last.Timestamp && ops[0].ID != known[0].ID
+}
+
+// extends tells whether ops starts with every operation of known
+func extends(ops []*chatmessage.RoomOp, known []*chatmessage.RoomOp) bool {
+	if len(ops) < len(known) {
+		return false
+	}
+
+	for i := range known {
+		if ops[i].ID != known[i].ID {
+			return false
+		}
+	}
+
+	return true
+}
+
+func describeRoomOp(op *chatmessage.RoomOp) string {
+	actor := key.ShortFingerprint(op.Actor)
+	switch op.Op {
+	case chatmessage.CREATE_ROOM:
+		return fmt.Sprintf("%s created the room", actor)
+	case chatmessage.INVITE_MEMBER:
+		return fmt.Sprintf("%s invited %s", actor, key.ShortFingerprint(op.Member))
+	case chatmessage.REMOVE_MEMBER:
+		return fmt.Sprintf("%s removed %s", actor, key.ShortFingerprint(op.Member))
+	case chatmessage.LEAVE_ROOM:
+		return fmt.Sprintf("%s left the room", actor)
+	default:
+		return fmt.Sprintf("%s changed the room", actor)
+	}
+}
+
+// submit sends what was typed in the input box, lines starting with a
+// slash are commands
+func (c *userClient) submit(text string) error {
+	if !strings.HasPrefix(text, "/") {
+		c.roomsMu.Lock()
+		room := c.activeRoom
+		c.roomsMu.Unlock()
+
+		if room != "" {
+			return c.SendRoomMessage(room, text)
+		}
+		return c.SendMessage(text)
+	}
+
+	args := strings.Fields(text)
+	switch {
+	case args[0] == "/create" && len(args) == 2:
+		return c.CreateRoom(args[1])
+	case args[0] == "/invite" && len(args) == 3:
+		member, err := key.LoadKeyPair(key.WithPublicKey(args[2]))
+		if err != nil {
+			return err
+		}
+		return c.Invite(args[1], member.PublicKey())
+	case args[0] == "/remove" && len(args) == 3:
+		member, err := key.LoadKeyPair(key.WithPublicKey(args[2]))
+		if err != nil {
+			return err
+		}
+		return c.Remove(args[1], member.PublicKey())
+	case args[0] == "/leave" && len(args) == 2:
+		return c.Leave(args[1])
+	case args[0] == "/room" && len(args) == 2:
+		c.roomsMu.Lock()
+		defer c.roomsMu.Unlock()
+		if _, ok := c.rooms[args[1]]; !ok {
+			return UnknownRoomError
+		}
+		c.activeRoom = args[1]
+		return nil
+	case args[0] == "/direct" && len(args) == 1:
+		c.roomsMu.Lock()
+		c.activeRoom = ""
+		c.roomsMu.Unlock()
+		return nil
+	case args[0] == "/away" && len(args) == 1:
+		return c.setStatus(chatmessage.AWAY)
+	case args[0] == "/online" && len(args) == 1:
+		return c.setStatus(chatmessage.ONLINE)
+	case args[0] == "/visibility" && len(args) == 2:
+		return c.setVisibility(chatmessage.Visibility(strings.ToUpper(args[1])))
+	case args[0] == "/devices" && len(args) == 1:
+		return c.ListDevices()
+	case args[0] == "/revoke" && len(args) == 2:
+		return c.RevokeDevice(args[1])
+	case args[0] == "/rooms" && len(args) == 1:
+		c.appendHistory("rooms", c.listRooms())
+		return nil
+	}
+
+	return UnknownCommandError
+}
+
+func (c *userClient) listRooms() string {
+	c.roomsMu.Lock()
+	defer c.roomsMu.Unlock()
+
+	rooms := make([]string, 0, len(c.rooms))
+	for name, info := range c.rooms {
+		rooms = append(rooms, fmt.Sprintf("%s (%d members)", name, len(info.Members)))
+	}
+	sort.Strings(rooms)
+
+	if len(rooms) == 0 {
+		return "no rooms"
+	}
+	return strings.Join(rooms, ", ")
+}
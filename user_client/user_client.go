@@ -1,7 +1,9 @@
 package userclient
 
 import (
-	"encoding/base64"
+	"bytes"
+	"crypto"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,22 +11,77 @@ import (
 	"os"
 	chatmessage "pogchat/chat_message"
 	"pogchat/client"
+	"pogchat/cryptography"
 	"pogchat/key"
+	"pogchat/ratchet"
+	"pogchat/trust"
 	"pogchat/user_message"
+	"sync"
 	"time"
 
 	"github.com/marcusolsson/tui-go"
 )
 
+const LOGIN_TIMEOUT = 10 * time.Second
+
+var (
+	LoginTimeoutError     = errors.New("login timed out")
+	LoginRejectedError    = errors.New("login rejected by server")
+	UnexpectedServerError = errors.New("challenge was issued by an unexpected server")
+	NoTerminalError       = errors.New("can not prompt for a passphrase without a terminal")
+	SigningKeyError       = errors.New("identity key can not sign, use an rsa or ed25519 key")
+	SessionKeyError       = errors.New("forward secret sessions need an ed25519 identity key")
+)
+
 type userClient struct {
 	pair           key.KeyPair
 	receiver       key.KeyPair
 	publicKeyFile  string
 	privateKeyFile string
-	client         client.Client
-	recChan        chan []byte
-	ui             tui.UI
-	history        *tui.Box
+	passphrase     key.PassphrasePrompt
+	// client is replaced on every reconnect, read it through conn
+	clientMu   sync.RWMutex
+	client     client.Client
+	dial       Dialer
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	outboxMu   sync.Mutex
+	outbox     []*pending
+	outboxSize int
+	signer     cryptography.Signer
+	serverID   string
+	sessionDir string
+	sessions   ratchet.Manager
+	// seen is handed to every connection so a message replayed after a
+	// reconnect is still recognised
+	seen           user_message.ReplayCache
+	knownPeers     trust.KnownPeers
+	receiverName   string
+	deviceID       string
+	deviceKey      key.KeyPair
+	receiverStatus trust.Status
+	roomsMu        sync.Mutex
+	rooms          map[string]*chatmessage.RoomInfo
+	// left keeps the last history of every room this key is no longer in
+	// so an older one can not put it back
+	left        map[string][]*chatmessage.RoomOp
+	activeRoom  string
+	presenceMu  sync.Mutex
+	presence    map[string]*chatmessage.Presence
+	status      chatmessage.PresenceStatus
+	visibility  chatmessage.Visibility
+	recChan     chan *client.Incoming
+	challenges  chan *chatmessage.Challenge
+	loginResult chan *chatmessage.Status
+	ui          tui.UI
+	history     *tui.Box
+	peers       *tui.Box
+	serverLabel *tui.Label
+	serverMu    sync.Mutex
+	serverState ServerState
+	// heartbeatInterval of zero turns off pings and dead server detection
+	heartbeatInterval time.Duration
+	heartbeatMisses   int
 }
 
 func WithPublicKeyFile(file string) UserClientOpts {
@@ -39,6 +96,62 @@ func WithPrivateKeyFile(file string) UserClientOpts {
 	}
 }
 
+// WithPassphrasePrompt overrides how the passphrase of an encrypted private
+// key file is obtained
+func WithPassphrasePrompt(prompt key.PassphrasePrompt) UserClientOpts {
+	return func(uc *userClient) {
+		uc.passphrase = prompt
+	}
+}
+
+// WithServerID pins the server identity, challenges issued by any other
+// server are refused instead of signed
+func WithServerID(id string) UserClientOpts {
+	return func(uc *userClient) {
+		uc.serverID = id
+	}
+}
+
+// WithSessionDir turns on forward secret sessions, ratchet state for every
+// peer is kept under dir
+func WithSessionDir(dir string) UserClientOpts {
+	return func(uc *userClient) {
+		uc.sessionDir = dir
+	}
+}
+
+// WithKnownPeers sets where contact keys are remembered, by default they are
+// kept in trust.DefaultFile
+func WithKnownPeers(k trust.KnownPeers) UserClientOpts {
+	return func(uc *userClient) {
+		uc.knownPeers = k
+	}
+}
+
+// WithReceiverName names the contact, its key is pinned under that name the
+// first time it is used
+func WithReceiverName(name string) UserClientOpts {
+	return func(uc *userClient) {
+		uc.receiverName = name
+	}
+}
+
+// WithDeviceID overrides the id this machine logs in with, by default it
+// is kept in ~/.pogchat/device_id
+func WithDeviceID(id string) UserClientOpts {
+	return func(uc *userClient) {
+		uc.deviceID = id
+	}
+}
+
+// WithDeviceKey overrides the ed25519 key this device logs in with, by
+// default one is kept per device id under ~/.pogchat/devices
+func WithDeviceKey(pair key.KeyPair) UserClientOpts {
+	return func(uc *userClient) {
+		uc.deviceKey = pair
+	}
+}
+
 func WithClient(c client.Client) UserClientOpts {
 	return func(uc *userClient) {
 		uc.client = c
@@ -46,105 +159,282 @@ func WithClient(c client.Client) UserClientOpts {
 }
 
 func (c *userClient) GetUsername() string {
-	pk := c.pair.PublicKey()
-	return string(base64.RawStdEncoding.EncodeToString(pk[len(pk)-10:]))
+	return key.ShortFingerprint(c.pair.PublicKey())
 }
 
 func (c *userClient) GetPeername() string {
-	pk := c.receiver.PublicKey()
-	return string(base64.RawStdEncoding.EncodeToString(pk[len(pk)-10:]))
+	return key.ShortFingerprint(c.receiver.PublicKey())
+}
+
+// GetSafetyNumber is the number both sides of the conversation compare out
+// of band, it only matches when neither key was swapped
+func (c *userClient) GetSafetyNumber() string {
+	return key.SafetyNumber(c.pair.PublicKey(), c.receiver.PublicKey())
 }
 
+// senderName labels a message with the key that actually signed it, the
+// configured peer is just the most likely one
+func (c *userClient) senderName(from []byte) string {
+	if c.receiver != nil && bytes.Equal(from, c.receiver.PublicKey()) {
+		return c.GetPeername()
+	}
+	return key.ShortFingerprint(from)
+}
+
+// SetReceiver checks the receiver key against the one seen the first time
+// this contact was used, sending stays blocked if it changed
 func (c *userClient) SetReceiver(receiver key.KeyPair) {
 	c.receiver = receiver
+
+	if c.receiverName == "" {
+		c.receiverName = key.ShortFingerprint(receiver.PublicKey())
+	}
+
+	status, err := c.knownPeers.Check(c.receiverName, receiver.PublicKey())
+	if err != nil {
+		log.Printf("[userClient.SetReceiver] knownPeers.Check() returned error: %+v\n", err)
+	}
+	c.receiverStatus = status
+
+	if status == trust.CHANGED_KEY {
+		log.Printf("[userClient.SetReceiver] WARNING: the key of %s has changed, run verify once you compared the new safety number\n", c.receiverName)
+	}
+
+	err = c.subscribePresence()
+	if err != nil {
+		log.Printf("[userClient.SetReceiver] c.subscribePresence() returned error: %+v\n", err)
+	}
+}
+
+func (c *userClient) trustLabel() string {
+	switch c.receiverStatus {
+	case trust.VERIFIED_PEER:
+		return "verified"
+	case trust.CHANGED_KEY:
+		return "KEY CHANGED, SENDING BLOCKED"
+	default:
+		return "unverified"
+	}
 }
 
 func (c *userClient) SendMessage(text string) error {
-	userInputMsg := user_message.NewUserMessage(
-		user_message.WithFromPublicKey(c.pair.PublicKey()),
-		user_message.WithToPublicKey(c.receiver.PublicKey()),
-	)
+	if c.receiverStatus == trust.CHANGED_KEY {
+		return trust.KeyChangedError
+	}
+
+	to := c.receiver.PublicKey()
+	err := c.send(func() (*chatmessage.ChatMessage, error) {
+		userInputMsg, err := c.buildMessage(to, "", text)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err := c.signMessage(userInputMsg)
+		if err != nil {
+			return nil, err
+		}
 
-	encryptedMsg, err := userInputMsg.GetEncryptedMessage([]byte(text))
+		return &chatmessage.ChatMessage{Type: chatmessage.PEER_MSG, Payload: payload}, nil
+	})
 	if err != nil {
-		log.Printf("[server.StartClient] userInputMsg.GetEncryptedMessage() returned error: %+v\n", err)
+		log.Printf("[userClient.SendMessage] c.send() returned error: %+v\n", err)
 		return err
 	}
 
-	_, err = userInputMsg.GetSignature(c.pair.PrivateKey(), encryptedMsg)
+	c.syncSent(to, "", text)
+	return nil
+}
+
+// signMessage signs a user message and returns it in its wire encoding
+func (c *userClient) signMessage(um user_message.UserMessage) (string, error) {
+	_, err := um.Sign(c.pair.PrivateKey())
 	if err != nil {
-		log.Printf("[userClient.SendMessage] userInputMsg.GetSignature() returned error: %+v\n", err)
-		return err
+		log.Printf("[userClient.signMessage] um.Sign() returned error: %+v\n", err)
+		return "", err
 	}
 
-	Msg, err := userInputMsg.MarshalJSON()
+	b, err := um.MarshalJSON()
 	if err != nil {
-		log.Println("[userClient.SendMessage] could not msrhal json")
-		return err
+		log.Println("[userClient.signMessage] could not marshal json")
+		return "", err
 	}
 
-	msg, err := json.Marshal(&chatmessage.ChatMessage{
-		Type:    "PEER_MSG",
-		Payload: string(Msg),
+	return string(b), nil
+}
+
+// writeMessage sends a chat message whose payload is already encoded
+func (c *userClient) writeMessage(msgType string, payload string) error {
+	err := c.send(func() (*chatmessage.ChatMessage, error) {
+		return &chatmessage.ChatMessage{Type: msgType, Payload: payload}, nil
 	})
 	if err != nil {
-		log.Println("[userClient.SendMessage] could not marshal json")
+		log.Printf("[userClient.writeMessage] c.send() returned error: %+v\n", err)
 		return err
 	}
 
-	_, err = c.client.Write(msg)
+	return nil
+}
+
+// buildMessage encrypts text for a single recipient, room is set on every
+// copy of a room message
+func (c *userClient) buildMessage(to []byte, room string, text string) (user_message.UserMessage, error) {
+	if c.sessions != nil {
+		encryptedMsg, err := c.sessions.Encrypt(to, []byte(text))
+		if err != nil {
+			log.Printf("[userClient.buildMessage] c.sessions.Encrypt() returned error: %+v\n", err)
+			return nil, err
+		}
+
+		return user_message.NewUserMessage(
+			user_message.WithType(user_message.RATCHET_MESSAGE),
+			user_message.WithFromPublicKey(c.pair.PublicKey()),
+			user_message.WithToPublicKey(to),
+			user_message.WithRoom(room),
+			user_message.WithMessage(encryptedMsg),
+		), nil
+	}
+
+	userInputMsg := user_message.NewUserMessage(
+		user_message.WithFromPublicKey(c.pair.PublicKey()),
+		user_message.WithToPublicKey(to),
+		user_message.WithRoom(room),
+	)
+
+	_, err := userInputMsg.GetEncryptedMessage([]byte(text))
 	if err != nil {
-		log.Println("[userClient.SendMessage] could not marshal json")
-		return err
+		log.Printf("[userClient.buildMessage] userInputMsg.GetEncryptedMessage() returned error: %+v\n", err)
+		return nil, err
 	}
 
-	return nil
+	return userInputMsg, nil
 }
 
 func (c *userClient) Login() error {
-	um := user_message.NewUserMessage(
-		user_message.WithFromPublicKey(c.pair.PublicKey()),
-		user_message.WithToPublicKey(c.pair.PublicKey()),
-	)
+	var challenge *chatmessage.Challenge
+	select {
+	case challenge = <-c.challenges:
+	case <-time.After(LOGIN_TIMEOUT):
+		log.Println("[Login] server did not send a challenge")
+		return LoginTimeoutError
+	}
+
+	if c.serverID != "" && c.serverID != challenge.ServerID {
+		log.Printf("[Login] challenge came from unexpected server %s\n", challenge.ServerID)
+		return UnexpectedServerError
+	}
 
-	encryptedMsg, err := um.GetEncryptedMessage([]byte("GAMER"))
+	login := &chatmessage.Login{
+		PublicKey: c.pair.PublicKey(),
+		Nonce:     challenge.Nonce,
+		ServerID:  challenge.ServerID,
+		Timestamp: time.Now().Unix(),
+		DeviceID:  c.deviceID,
+		DeviceKey: c.deviceKey.PublicKey(),
+	}
+
+	sig, err := c.signer.Sign(c.pair.PrivateKey(), login.SigningBytes())
 	if err != nil {
-		log.Println("[Login] could not encrypt msg")
+		log.Println("[Login] could not sign challenge")
 		return err
 	}
+	login.Signature = sig
 
-	_, err = um.GetSignature(c.pair.PrivateKey(), encryptedMsg)
+	login.DeviceSignature, err = c.signer.Sign(c.deviceKey.PrivateKey(), login.DeviceSigningBytes())
 	if err != nil {
-		log.Println("[Login] could not sign message")
+		log.Println("[Login] could not sign challenge with the device key")
 		return err
 	}
 
-	userMsg, err := um.MarshalJSON()
+	chatMsg, err := chatmessage.NewChatMessage(chatmessage.LOGIN_MSG, login)
 	if err != nil {
-		log.Println("[server.StartClient] could not msrhal json")
+		log.Println("[Login] could not build login message")
 		return err
 	}
 
-	msg, err := json.Marshal(&chatmessage.ChatMessage{
-		Type:    "LOGIN_MSG",
-		Payload: string(userMsg),
-	})
+	msg, err := json.Marshal(chatMsg)
 	if err != nil {
 		log.Println("[Login] could not marshal json")
 		return err
 	}
 
-	_, err = c.client.Write(msg)
+	err = c.conn().WriteFrame(msg)
 	if err != nil {
-		log.Printf("[Login] c.client.Write() returned error: %+v\n", err)
+		log.Printf("[Login] c.conn().WriteFrame() returned error: %+v\n", err)
 		return err
+	}
 
+	select {
+	case status := <-c.loginResult:
+		if status.Code != chatmessage.LOGGED_IN {
+			log.Printf("[Login] server rejected login: %s\n", status.Reason)
+			return fmt.Errorf("%w: %s", LoginRejectedError, status.Reason)
+		}
+	case <-time.After(LOGIN_TIMEOUT):
+		log.Println("[Login] server did not answer login")
+		return LoginTimeoutError
 	}
 
 	log.Println("[Login] user is now logged in")
 	return nil
 }
 
+func (c *userClient) handleChallenge(msg *chatmessage.ChatMessage) error {
+	challenge, err := chatmessage.ParseChallenge(msg)
+	if err != nil {
+		return err
+	}
+
+	// only the latest challenge is worth answering, an older one has been
+	// consumed or replaced on the server already
+	select {
+	case <-c.challenges:
+	default:
+	}
+	c.challenges <- challenge
+
+	return nil
+}
+
+func (c *userClient) handleStatus(msg *chatmessage.ChatMessage) error {
+	status, err := chatmessage.ParseStatus(msg)
+	if err != nil {
+		return err
+	}
+
+	switch status.Code {
+	case chatmessage.LOGGED_IN, chatmessage.LOGIN_FAILED:
+		select {
+		case c.loginResult <- status:
+		default:
+			log.Printf("[userClient.handleStatus] unexpected login status %s: %s\n", status.Code, status.Reason)
+		}
+	default:
+		log.Printf("[userClient.handleStatus] server returned status %s: %s\n", status.Code, status.Reason)
+		if status.IsError() {
+			c.appendHistory("server", fmt.Sprintf("[ERROR] %s: %s", status.Code, status.Reason))
+		} else {
+			c.appendHistory("server", fmt.Sprintf("[%s] %s", status.Code, status.Reason))
+		}
+	}
+
+	return nil
+}
+
+func (c *userClient) appendHistory(from string, text string) {
+	if c.history == nil {
+		return
+	}
+
+	c.ui.Update(func() {
+		c.history.Append(tui.NewHBox(
+			tui.NewLabel(time.Now().String()),
+			tui.NewPadder(1, 0, tui.NewLabel(fmt.Sprintf("<%s>", from))),
+			tui.NewLabel(text),
+			tui.NewSpacer(),
+		))
+	})
+}
+
 func (c *userClient) BuildUI() error {
 	history := tui.NewVBox()
 
@@ -162,11 +452,21 @@ func (c *userClient) BuildUI() error {
 	inputBox.SetBorder(true)
 	inputBox.SetSizePolicy(tui.Expanding, tui.Maximum)
 
-	chat := tui.NewVBox(historyBox, inputBox)
+	connection := tui.NewLabel(serverLabel(c.ServerState()))
+	header := tui.NewHBox(
+		tui.NewLabel(fmt.Sprintf("<%s> talking to %s <%s> (%s)", c.GetUsername(), c.receiverName, c.GetPeername(), c.trustLabel())),
+		tui.NewSpacer(),
+		connection,
+		tui.NewPadder(1, 0, tui.NewLabel(fmt.Sprintf("safety number: %s", c.GetSafetyNumber()))),
+	)
+	header.SetBorder(true)
+	header.SetSizePolicy(tui.Expanding, tui.Maximum)
+
+	chat := tui.NewVBox(header, historyBox, inputBox)
 	chat.SetSizePolicy(tui.Expanding, tui.Expanding)
 
 	input.OnSubmit(func(e *tui.Entry) {
-		err := c.SendMessage(e.Text())
+		err := c.submit(e.Text())
 		if err != nil {
 			history.Append(tui.NewHBox(
 				tui.NewLabel(time.Now().String()),
@@ -185,7 +485,11 @@ func (c *userClient) BuildUI() error {
 		input.SetText("")
 	})
 
-	root := tui.NewHBox(chat)
+	peers := tui.NewVBox(tui.NewSpacer())
+	peers.SetBorder(true)
+	peers.SetTitle("peers")
+
+	root := tui.NewHBox(peers, chat)
 
 	ui, err := tui.New(root)
 	if err != nil {
@@ -194,6 +498,18 @@ func (c *userClient) BuildUI() error {
 
 	c.ui = ui
 	c.history = history
+	c.peers = peers
+	c.serverLabel = connection
+	c.refreshPeers()
+
+	if c.receiverStatus == trust.CHANGED_KEY {
+		history.Append(tui.NewHBox(
+			tui.NewLabel(time.Now().String()),
+			tui.NewPadder(1, 0, tui.NewLabel("<trust>")),
+			tui.NewLabel(fmt.Sprintf("[WARNING] the key of %s changed since you last talked, compare the safety number and run verify before sending", c.receiverName)),
+			tui.NewSpacer(),
+		))
+	}
 
 	ui.SetKeybinding("Esc", func() { ui.Quit() })
 
@@ -204,22 +520,23 @@ func (u *userClient) Run() error {
 	go func() {
 		for {
 			select {
-			case message, ok := <-u.recChan:
+			case incoming, ok := <-u.recChan:
 				if !ok {
-					u.history.Append(tui.NewHBox(
-						tui.NewLabel(time.Now().String()),
-						tui.NewPadder(1, 0, tui.NewLabel(fmt.Sprintf("<%s>", u.GetPeername()))),
-						tui.NewLabel(fmt.Sprintf("[ERROR] could not receive message: %+v", errors.New("something went wrong decrypting message"))),
-						tui.NewSpacer(),
-					))
+					return
+				}
+				if incoming.Err != nil {
+					u.appendHistory(u.senderName(incoming.From), fmt.Sprintf("[ERROR] rejected message: %+v", incoming.Err))
+					continue
+				}
+				if incoming.Type == user_message.SYNC_MESSAGE {
+					u.showSynced(incoming.Message)
+					continue
+				}
+				if incoming.Room != "" {
+					u.appendHistory(fmt.Sprintf("%s@%s", u.senderName(incoming.From), incoming.Room), string(incoming.Message))
+					continue
 				}
-				u.history.Append(tui.NewHBox(
-					tui.NewLabel(time.Now().String()),
-					tui.NewPadder(1, 0, tui.NewLabel(fmt.Sprintf("<%s>", u.GetPeername()))),
-					tui.NewLabel(string(message)),
-					tui.NewSpacer(),
-				))
-				u.ui.Repaint()
+				u.appendHistory(u.senderName(incoming.From), string(incoming.Message))
 			}
 		}
 	}()
@@ -233,22 +550,108 @@ func NewUserClient(opts ...UserClientOpts) (*userClient, error) {
 	c := &userClient{
 		publicKeyFile:  os.Getenv("SENDER_PUBLIC"),
 		privateKeyFile: os.Getenv("SENDER_PRIVATE"),
-		recChan:        make(chan []byte),
+		signer: cryptography.NewSigner(
+			cryptography.WithSignerHasher(crypto.SHA256),
+			cryptography.WithSignerRandomizer(rand.Reader)),
+		serverID:     os.Getenv("SERVER_ID"),
+		sessionDir:   os.Getenv("SESSION_DIR"),
+		receiverName: os.Getenv("RECEIVER_NAME"),
+		passphrase:   envPassphrase,
+		seen:         user_message.NewReplayCache(client.REPLAY_CACHE_SIZE),
+		recChan:      make(chan *client.Incoming),
+		challenges:   make(chan *chatmessage.Challenge, 1),
+		loginResult:  make(chan *chatmessage.Status, 1),
+		rooms:        make(map[string]*chatmessage.RoomInfo),
+		left:         make(map[string][]*chatmessage.RoomOp),
+		presence:     make(map[string]*chatmessage.Presence),
+		status:       chatmessage.ONLINE,
+		visibility:   chatmessage.VISIBLE_TO_EVERYONE,
+		serverState:  SERVER_CONNECTED,
+
+		minBackoff: DEFAULT_MIN_BACKOFF,
+		maxBackoff: DEFAULT_MAX_BACKOFF,
+		outboxSize: DEFAULT_OUTBOX_SIZE,
+
+		heartbeatInterval: DEFAULT_HEARTBEAT_INTERVAL,
+		heartbeatMisses:   DEFAULT_HEARTBEAT_MISSES,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.deviceID == "" {
+		id, err := loadDeviceID()
+		if err != nil {
+			log.Println("[NewUserClient] could not load device id")
+			return nil, err
+		}
+		c.deviceID = id
+	}
+
+	if c.deviceKey == nil {
+		pair, err := loadDeviceKey(c.deviceID)
+		if err != nil {
+			log.Println("[NewUserClient] could not load device key")
+			return nil, err
+		}
+		c.deviceKey = pair
+	}
+
+	if c.knownPeers == nil {
+		fileName, err := trust.DefaultFile()
+		if err != nil {
+			log.Println("[NewUserClient] could not find known peers")
+			return nil, err
+		}
+
+		k, err := trust.NewKnownPeers(fileName)
+		if err != nil {
+			log.Println("[NewUserClient] could not open known peers")
+			return nil, err
+		}
+		c.knownPeers = k
 	}
 
-	pair, err := key.LoadKeyPair(key.WithPublicKey(c.publicKeyFile), key.WithPrivateKey(c.privateKeyFile))
+	pair, err := key.LoadKeyPair(
+		key.WithPassphrasePrompt(c.passphrase),
+		key.WithPublicKey(c.publicKeyFile),
+		key.WithPrivateKey(c.privateKeyFile))
 	if err != nil {
 		log.Println("[NewUserClient] could not load key pair")
 		return nil, err
 	}
 
-	for _, opt := range opts {
-		opt(c)
+	// logins and messages are signed, a key agreement only key would be
+	// refused by the server on every attempt
+	if pair.PrivateKeyType() == key.X25519_PRIVATE_KEY {
+		log.Println("[NewUserClient] x25519 keys can not be used as an identity")
+		return nil, SigningKeyError
 	}
 
 	c.pair = pair
 
-	go c.client.ReceiveAndDecrypt(c.pair.PrivateKey(), c.recChan)
+	if c.sessionDir != "" {
+		// sessions are agreed with DH on the identity keys, RSA can not
+		// take part in that
+		if pair.PrivateKeyType() != key.ED25519_PRIVATE_KEY {
+			log.Println("[NewUserClient] sessions need an ed25519 identity")
+			return nil, SessionKeyError
+		}
+
+		store, err := ratchet.NewFileStore(c.sessionDir)
+		if err != nil {
+			log.Println("[NewUserClient] could not open session store")
+			return nil, err
+		}
+
+		c.sessions = ratchet.NewManager(
+			ratchet.WithStore(store),
+			ratchet.WithIdentity(pair.PublicKey(), pair.PrivateKey()))
+	}
+
+	c.attach(c.client)
+	go c.supervise()
 
 	return c, nil
 }
@@ -1,14 +1,50 @@
 package user_message
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+)
+
+var (
+	UnsupportedVersionError = errors.New("unsupported user message version")
+	MissingSignatureError   = errors.New("user message is not signed")
+)
+
+const (
+	// VERSION is the current layout of the signed message, messages from
+	// before versioning decode with version zero and are refused
+	VERSION = 1
+
+	TEXT_MESSAGE = "TEXT"
+	// RATCHET_MESSAGE carries a double ratchet message instead of a plain
+	// envelope to the recipient long term key
+	RATCHET_MESSAGE = "RATCHET"
+	// SYNC_MESSAGE is a copy of an outgoing message sent by a key to
+	// itself so its other devices see it, the envelope holds a SyncPayload
+	SYNC_MESSAGE = "SYNC"
+)
+
+// SyncPayload is the plaintext of a SYNC_MESSAGE
+type SyncPayload struct {
+	To      []byte `json:"to,omitempty"`
+	Room    string `json:"room,omitempty"`
+	Message []byte `json:"message"`
+}
 
 type UserMessage interface {
+	Version() int
+	Type() string
+	ID() string
+	Timestamp() int64
 	Signature() []byte
 	FromPublicKey() []byte
 	ToPublicKey() []byte
 	Message() []byte
+	Room() string
+	SignedData() []byte
 	GetEncryptedMessage(msg []byte) ([]byte, error)
-	GetSignature(fromPrivateKey []byte, encryptedMsg []byte) ([]byte, error)
+	Sign(fromPrivateKey []byte) ([]byte, error)
+	Verify() error
 	json.Marshaler
 }
 
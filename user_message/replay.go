@@ -0,0 +1,47 @@
+package user_message
+
+import "sync"
+
+// ReplayCache remembers the most recent message ids so a message delivered
+// twice, by a retrying relay or by an attacker, is only accepted once
+type ReplayCache interface {
+	Seen(id string) bool
+}
+
+type replayCache struct {
+	mu    sync.Mutex
+	size  int
+	ids   map[string]struct{}
+	order []string
+}
+
+var _ ReplayCache = (*replayCache)(nil)
+
+// Seen reports whether id was already recorded and records it otherwise,
+// once full the oldest id is forgotten
+func (r *replayCache) Seen(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.ids[id]; ok {
+		return true
+	}
+
+	if len(r.order) >= r.size {
+		delete(r.ids, r.order[0])
+		r.order = r.order[1:]
+	}
+
+	r.ids[id] = struct{}{}
+	r.order = append(r.order, id)
+
+	return false
+}
+
+func NewReplayCache(size int) ReplayCache {
+	return &replayCache{
+		size:  size,
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, 0, size),
+	}
+}
@@ -4,23 +4,49 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"pogchat/cryptography"
+	"time"
 )
 
 type user_message struct {
+	Ver     int                  `json:"version"`
+	MsgType string               `json:"type"`
+	MsgID   string               `json:"id"`
+	Time    int64                `json:"timestamp"`
 	Sig     []byte               `json:"signature"`
 	FromPK  []byte               `json:"from_public_key"`
 	ToPK    []byte               `json:"to_public_key"`
 	Msg     []byte               `json:"message"`
+	RoomID  string               `json:"room,omitempty"`
 	cryptor cryptography.Cryptor `json:"-"`
 	signer  cryptography.Signer  `json:"-"`
 }
 
+const signedDomain = "POGCHAT_USER_MESSAGE"
+
 func (m *user_message) MarshalJSON() ([]byte, error) {
 	return json.Marshal(*m)
 }
 
+func (m *user_message) Version() int {
+	return m.Ver
+}
+
+func (m *user_message) Type() string {
+	return m.MsgType
+}
+
+func (m *user_message) ID() string {
+	return m.MsgID
+}
+
+func (m *user_message) Timestamp() int64 {
+	return m.Time
+}
+
 func (m *user_message) Signature() []byte {
 	return m.Sig
 }
@@ -37,6 +63,10 @@ func (m *user_message) Message() []byte {
 	return m.Msg
 }
 
+func (m *user_message) Room() string {
+	return m.RoomID
+}
+
 func (m *user_message) GetEncryptedMessage(msg []byte) ([]byte, error) {
 	encryptedMsg, err := m.cryptor.Encrypt(m.ToPK, msg)
 	if err != nil {
@@ -48,8 +78,34 @@ func (m *user_message) GetEncryptedMessage(msg []byte) ([]byte, error) {
 	return m.Msg, nil
 }
 
-func (m *user_message) GetSignature(fromPrivateKey []byte, encryptedMsg []byte) ([]byte, error) {
-	sig, err := m.signer.Sign(fromPrivateKey, encryptedMsg)
+// SignedData returns the canonical encoding covered by the signature, every
+// routing field is included so a relay can neither re-address nor re-date a
+// signed ciphertext
+func (m *user_message) SignedData() []byte {
+	buf := make([]byte, 0, len(signedDomain)+len(m.MsgType)+len(m.FromPK)+len(m.ToPK)+len(m.MsgID)+len(m.Msg)+32)
+	buf = append(buf, signedDomain...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(m.Ver))
+	buf = appendField(buf, []byte(m.MsgType))
+	buf = appendField(buf, m.FromPK)
+	buf = appendField(buf, m.ToPK)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(m.Time))
+	buf = appendField(buf, []byte(m.MsgID))
+	buf = appendField(buf, m.Msg)
+	// direct messages predate rooms, leaving the field out keeps their
+	// encoding unchanged
+	if m.RoomID != "" {
+		buf = appendField(buf, []byte(m.RoomID))
+	}
+	return buf
+}
+
+func appendField(buf []byte, field []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(field)))
+	return append(buf, field...)
+}
+
+func (m *user_message) Sign(fromPrivateKey []byte) ([]byte, error) {
+	sig, err := m.signer.Sign(fromPrivateKey, m.SignedData())
 	if err != nil {
 		return nil, err
 	}
@@ -59,8 +115,30 @@ func (m *user_message) GetSignature(fromPrivateKey []byte, encryptedMsg []byte)
 	return m.Sig, nil
 }
 
-func ParseFromJSON(um string) (UserMessage, error) {
-	m := &user_message{}
+func (m *user_message) Verify() error {
+	if m.Ver != VERSION {
+		return UnsupportedVersionError
+	}
+
+	if len(m.Sig) == 0 {
+		return MissingSignatureError
+	}
+
+	_, err := m.signer.Verify(m.FromPK, m.SignedData(), m.Sig)
+	return err
+}
+
+func newMessageID() string {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+func ParseFromJSON(um string, opts ...UserMessageOptions) (UserMessage, error) {
+	m := newUserMessage(opts...)
 	err := json.Unmarshal([]byte(um), m)
 	if err != nil {
 		return nil, err
@@ -68,6 +146,14 @@ func ParseFromJSON(um string) (UserMessage, error) {
 	return m, nil
 }
 
+// WithVersion rebuilds a message received in another encoding, new
+// messages always get VERSION
+func WithVersion(version int) UserMessageOptions {
+	return func(u *user_message) {
+		u.Ver = version
+	}
+}
+
 func WithSigner(signer cryptography.Signer) UserMessageOptions {
 	return func(u *user_message) {
 		u.signer = signer
@@ -98,13 +184,41 @@ func WithFromPublicKey(publicKey []byte) UserMessageOptions {
 	}
 }
 
+func WithType(msgType string) UserMessageOptions {
+	return func(u *user_message) {
+		u.MsgType = msgType
+	}
+}
+
+func WithID(id string) UserMessageOptions {
+	return func(u *user_message) {
+		u.MsgID = id
+	}
+}
+
+func WithTimestamp(timestamp int64) UserMessageOptions {
+	return func(u *user_message) {
+		u.Time = timestamp
+	}
+}
+
 func WithMessage(message []byte) UserMessageOptions {
 	return func(u *user_message) {
 		u.Msg = message
 	}
 }
 
-func NewUserMessage(opts ...UserMessageOptions) UserMessage {
+// WithRoom marks a copy of a room message, the room is signed so the relay
+// can not move a copy into another room
+func WithRoom(room string) UserMessageOptions {
+	return func(u *user_message) {
+		u.RoomID = room
+	}
+}
+
+// newUserMessage only wires the crypto defaults, metadata is left empty so
+// parsed messages keep exactly what was on the wire
+func newUserMessage(opts ...UserMessageOptions) *user_message {
 	um := &user_message{
 		cryptor: cryptography.NewCryptor(
 			cryptography.WithHasher(sha256.New()),
@@ -120,3 +234,14 @@ func NewUserMessage(opts ...UserMessageOptions) UserMessage {
 
 	return um
 }
+
+func NewUserMessage(opts ...UserMessageOptions) UserMessage {
+	defaults := []UserMessageOptions{
+		func(u *user_message) { u.Ver = VERSION },
+		WithType(TEXT_MESSAGE),
+		WithID(newMessageID()),
+		WithTimestamp(time.Now().Unix()),
+	}
+
+	return newUserMessage(append(defaults, opts...)...)
+}
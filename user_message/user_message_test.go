@@ -91,11 +91,98 @@ func TestUserMessage(t *testing.T) {
 			assert.Nil(t, err, "decoding must be possible")
 			assert.Equal(t, tt.msg, string(decryptedMsg), "decryption must be possible")
 
-			sig, err := um.GetSignature(pairReceiver.PrivateKey(), encryptedMsg)
+			sig, err := um.Sign(pairSender.PrivateKey())
 			assert.Nil(t, err, "could not sign encrypted message")
 
-			_, err = s.Verify(pairReceiver.PublicKey(), encryptedMsg, sig)
+			_, err = s.Verify(pairSender.PublicKey(), um.SignedData(), sig)
 			assert.Nil(t, err, "could not validate signature")
+			assert.Nil(t, um.Verify(), "message must verify against its sender key")
 		})
 	}
 }
+
+func TestSignedMetadata(t *testing.T) {
+	pairSender, _ := key.NewKeyPair(2048)
+	pairReceiver, _ := key.NewKeyPair(2048)
+	pairOther, _ := key.NewKeyPair(2048)
+
+	sign := func(t *testing.T) string {
+		um := NewUserMessage(
+			WithFromPublicKey(pairSender.PublicKey()),
+			WithToPublicKey(pairReceiver.PublicKey()),
+		)
+		_, err := um.GetEncryptedMessage([]byte("TIRAICHBADFTHR"))
+		assert.Nil(t, err, "could not encrypt message")
+		_, err = um.Sign(pairSender.PrivateKey())
+		assert.Nil(t, err, "could not sign message")
+
+		b, err := um.MarshalJSON()
+		assert.Nil(t, err, "could not marshal message")
+		return string(b)
+	}
+
+	test := []struct {
+		name   string
+		tamper func(*user_message)
+		err    bool
+	}{
+		{
+			name:   "untouched message verifies",
+			tamper: func(m *user_message) {},
+		},
+		{
+			name:   "re-addressed message fails",
+			tamper: func(m *user_message) { m.ToPK = pairOther.PublicKey() },
+			err:    true,
+		},
+		{
+			name:   "re-dated message fails",
+			tamper: func(m *user_message) { m.Time++ },
+			err:    true,
+		},
+		{
+			name:   "message with new id fails",
+			tamper: func(m *user_message) { m.MsgID = "TIRAICHBADFTHR" },
+			err:    true,
+		},
+		{
+			name:   "message with other type fails",
+			tamper: func(m *user_message) { m.MsgType = "TIRAICHBADFTHR" },
+			err:    true,
+		},
+		{
+			name:   "message moved into a room fails",
+			tamper: func(m *user_message) { m.RoomID = "TIRAICHBADFTHR" },
+			err:    true,
+		},
+		{
+			name:   "unversioned message fails",
+			tamper: func(m *user_message) { m.Ver = 0 },
+			err:    true,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			um, err := ParseFromJSON(sign(t))
+			assert.Nil(t, err, "could not parse message")
+
+			tt.tamper(um.(*user_message))
+			err = um.Verify()
+			if tt.err {
+				assert.NotNil(t, err, "verification must fail")
+			} else {
+				assert.Nil(t, err, "verification must pass")
+			}
+		})
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	cache := NewReplayCache(2)
+	assert.False(t, cache.Seen("a"), "first sight must not be a replay")
+	assert.True(t, cache.Seen("a"), "second sight must be a replay")
+	assert.False(t, cache.Seen("b"))
+	assert.False(t, cache.Seen("c"))
+	assert.False(t, cache.Seen("a"), "oldest id must have been forgotten")
+}
@@ -0,0 +1,189 @@
+package ws
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"pogchat/client"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DEFAULT_PATH is where the server accepts WebSocket connections
+	DEFAULT_PATH   = "/ws"
+	HEADER_TIMEOUT = 10 * time.Second
+)
+
+var UnexpectedMessageError = errors.New("websocket message is neither text nor binary")
+
+// conn carries one frame per WebSocket message
+type conn struct {
+	ws *websocket.Conn
+}
+
+var _ client.Conn = (*conn)(nil)
+
+func NewConn(ws *websocket.Conn) client.Conn {
+	return &conn{ws: ws}
+}
+
+func (c *conn) ReadFrame() ([]byte, error) {
+	msgType, payload, err := c.ws.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+		return nil, UnexpectedMessageError
+	}
+	return payload, nil
+}
+
+// WriteFrame sends JSON as text so browsers can read it as is, anything
+// else goes out as binary
+func (c *conn) WriteFrame(payload []byte) error {
+	msgType := websocket.BinaryMessage
+	if utf8.Valid(payload) {
+		msgType = websocket.TextMessage
+	}
+	return c.ws.WriteMessage(msgType, payload)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *conn) Close() error {
+	return c.ws.Close()
+}
+
+// upgrader accepts any origin, logins are signed challenges and no cookie
+// ever authenticates a connection so a foreign page gains nothing
+var upgrader = websocket.Upgrader{
+	HandshakeTimeout: HEADER_TIMEOUT,
+	CheckOrigin:      func(*http.Request) bool { return true },
+}
+
+// Upgrade turns an HTTP request into a connection, messages larger than
+// maxMessageSize close it
+func Upgrade(w http.ResponseWriter, r *http.Request, maxMessageSize int64) (client.Conn, error) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ws.SetReadLimit(maxMessageSize)
+	return NewConn(ws), nil
+}
+
+// Dial connects to a ws:// or wss:// url, config is only used for wss
+func Dial(url string, config *tls.Config, maxMessageSize int64) (client.Conn, error) {
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: HEADER_TIMEOUT,
+		TLSClientConfig:  config,
+	}
+
+	ws, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ws.SetReadLimit(maxMessageSize)
+	return NewConn(ws), nil
+}
+
+// Listener hands out the connections upgraded by an HTTP server of its own
+type Listener struct {
+	listener       net.Listener
+	srv            *http.Server
+	maxMessageSize int64
+	conns          chan client.Conn
+	done           chan struct{}
+	once           sync.Once
+}
+
+// Listen accepts WebSocket connections on address at path, config turns it
+// into wss when set
+func Listen(address string, path string, config *tls.Config, maxMessageSize int64) (*Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+	if path == "" {
+		path = DEFAULT_PATH
+	}
+
+	l := &Listener{
+		listener:       listener,
+		maxMessageSize: maxMessageSize,
+		conns:          make(chan client.Conn),
+		done:           make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, l.upgrade)
+	l.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: HEADER_TIMEOUT,
+	}
+
+	go func() {
+		err := l.srv.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[ws.Listen] srv.Serve() returned error: %+v\n", err)
+		}
+		l.Close()
+	}()
+
+	return l, nil
+}
+
+func (l *Listener) upgrade(w http.ResponseWriter, r *http.Request) {
+	conn, err := Upgrade(w, r, l.maxMessageSize)
+	if err != nil {
+		// the upgrader already answered the request
+		log.Printf("[ws.upgrade] Upgrade() returned error: %+v\n", err)
+		return
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *Listener) Accept() (client.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting, connections already handed out stay open
+func (l *Listener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.srv.Close()
+	})
+	return err
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}